@@ -0,0 +1,217 @@
+package radar
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vela-ssoc/vela-radar/port"
+)
+
+const (
+	anomalyCanaries    = 3                      // 每个主机先探测的随机高端口数
+	anomalyCanaryMin   = 40000                  // 随机高端口的范围
+	anomalyRatioProbes = 100                    // 开放比例判断需要的最少探测端口数
+	anomalyRatio       = 0.9                    // 开放比例超过该值认为所有端口开放
+	anomalyBanners     = 5                      // 相同 banner 出现在多少个端口上认为是蜜罐
+	anomalyBannerRatio = 0.3                    // 相同 banner 还需要开放比例超过该值(或者随机高端口开放)佐证
+	anomalyTimingPorts = 50                     // 连接耗时判断需要的最少开放端口数
+	anomalyTimingSpan  = 500 * time.Microsecond // 所有端口连接耗时的波动小于该值认为可疑, 需要其它信号佐证
+	anomalyDefaultCap  = 20
+)
+
+// hostAnomaly 单个主机的异常检测状态
+type hostAnomaly struct {
+	canaries   map[uint16]bool
+	canaryOpen int
+	probed     uint32
+	open       uint32
+	rttMin     time.Duration
+	rttMax     time.Duration
+	rttCount   int
+	banners    map[string]int
+	reason     string // 为空表示正常
+	passed     int    // 标记后仍然放行的开放端口数
+	suppressed int    // 标记后丢弃的开放端口数
+}
+
+// anomalyTable tarpit/蜜罐检测, 被标记的主机只保留前 cap 个开放端口
+type anomalyTable struct {
+	mu    sync.Mutex
+	cap   int
+	ports map[uint16]bool
+	hosts map[string]*hostAnomaly
+}
+
+func newAnomalyTable(ports []uint16, limit int) *anomalyTable {
+	if limit <= 0 {
+		limit = anomalyDefaultCap
+	}
+	set := make(map[uint16]bool, len(ports))
+	for _, p := range ports {
+		set[p] = true
+	}
+	return &anomalyTable{cap: limit, ports: set, hosts: make(map[string]*hostAnomaly)}
+}
+
+func (at *anomalyTable) host(ip net.IP) *hostAnomaly {
+	key := ip.String()
+	h, ok := at.hosts[key]
+	if !ok {
+		h = &hostAnomaly{canaries: make(map[uint16]bool), banners: make(map[string]int)}
+		at.hosts[key] = h
+	}
+	return h
+}
+
+// flag 标记主机, 之前已经放行的开放端口计入 passed, 标记后总共只放行 cap 个
+func (h *hostAnomaly) flag(reason string) {
+	if h.reason == "" {
+		h.reason = reason
+		h.passed = int(h.open)
+	}
+}
+
+// Canaries 选取不在任务端口中的随机高端口, 端口列表覆盖全部高端口时返回空
+func (at *anomalyTable) Canaries(ip net.IP) []uint16 {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	h := at.host(ip)
+	for tries := 0; len(h.canaries) < anomalyCanaries && tries < 100; tries++ {
+		p := uint16(anomalyCanaryMin + rand.Intn(65536-anomalyCanaryMin))
+		if at.ports[p] || h.canaries[p] {
+			continue
+		}
+		h.canaries[p] = true
+	}
+
+	canaries := make([]uint16, 0, len(h.canaries))
+	for p := range h.canaries {
+		canaries = append(canaries, p)
+	}
+	return canaries
+}
+
+// CheckCanaries 随机高端口全部开放时标记主机
+func (at *anomalyTable) CheckCanaries(ip net.IP) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	h := at.host(ip)
+	if len(h.canaries) > 0 && h.canaryOpen >= len(h.canaries) {
+		h.flag(fmt.Sprintf("tarpit: all %d random high ports open", len(h.canaries)))
+	}
+}
+
+func (at *anomalyTable) Probe(ip net.IP) {
+	at.mu.Lock()
+	at.host(ip).probed++
+	at.mu.Unlock()
+}
+
+// Record 记录一个端口结果, canary 表示是随机探测端口, pass 表示是否需要继续识别
+func (at *anomalyTable) Record(v port.OpenIpPort) (canary bool, pass bool) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	h := at.host(v.Ip)
+	if h.canaries[v.Port] {
+		if v.State == port.Open {
+			h.canaryOpen++
+		}
+		return true, false
+	}
+	if v.State != port.Open {
+		return false, true
+	}
+
+	if v.RTT > 0 {
+		if h.rttCount == 0 || v.RTT < h.rttMin {
+			h.rttMin = v.RTT
+		}
+		if v.RTT > h.rttMax {
+			h.rttMax = v.RTT
+		}
+		h.rttCount++
+	}
+
+	// 当前端口还没有放行, 标记之后再计入 open
+	open := h.open + 1
+	if h.probed >= anomalyRatioProbes && float64(open)/float64(h.probed) >= anomalyRatio {
+		h.flag(fmt.Sprintf("tarpit: %d of %d probed ports open", open, h.probed))
+	}
+	// 局域网内 SYN-ACK 的耗时本来就很接近, 耗时一致只作为佐证
+	if h.rttCount >= anomalyTimingPorts && h.rttMax-h.rttMin < anomalyTimingSpan && h.corroborated() {
+		h.flag(fmt.Sprintf("tarpit: %d open ports answer within %s", h.rttCount, h.rttMax-h.rttMin))
+	}
+	h.open = open
+
+	if h.reason == "" {
+		return false, true
+	}
+	if h.passed < at.cap {
+		h.passed++
+		return false, true
+	}
+	h.suppressed++
+	return false, false
+}
+
+// Service 记录识别后的 banner, 返回主机的异常标记
+func (at *anomalyTable) Service(s *Service) string {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	h := at.host(s.IP)
+	if len(s.Banner) > 0 {
+		key := s.Protocol + "|" + string(s.Banner)
+		h.banners[key]++
+		if h.banners[key] >= anomalyBanners && h.corroborated() {
+			h.flag(fmt.Sprintf("honeypot: identical %s banner on %d ports", s.Protocol, h.banners[key]))
+		}
+	}
+	return h.reason
+}
+
+// corroborated 相同 banner 和一致的连接耗时只在有其它异常信号时才算异常,
+// 同一台服务器在多个端口上提供相同的服务(web 集群, 管理口)很常见, 局域网主机的耗时也很接近
+func (h *hostAnomaly) corroborated() bool {
+	if h.canaryOpen > 0 {
+		return true
+	}
+	return h.probed >= anomalyRatioProbes && float64(h.open)/float64(h.probed) >= anomalyBannerRatio
+}
+
+// Get 主机的异常标记以及被丢弃的开放端口数
+func (at *anomalyTable) Get(ip net.IP) (string, int) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	h, ok := at.hosts[ip.String()]
+	if !ok {
+		return "", 0
+	}
+	return h.reason, h.suppressed
+}
+
+// Summary 被标记的主机数以及被丢弃的开放端口数
+func (at *anomalyTable) Summary() map[string]interface{} {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	flagged, suppressed := 0, 0
+	for _, h := range at.hosts {
+		if h.reason != "" {
+			flagged++
+		}
+		suppressed += h.suppressed
+	}
+	return map[string]interface{}{
+		"flagged":    flagged,
+		"suppressed": suppressed,
+		"cap":        at.cap,
+	}
+}
@@ -0,0 +1,47 @@
+package radar
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/vela-ssoc/vela-radar/port"
+)
+
+func TestAnomaly_TimingNeedsCorroboration(t *testing.T) {
+	at := newAnomalyTable(nil, 5)
+	ip := net.ParseIP("10.0.0.1")
+	for p := uint16(1); p <= 200; p++ {
+		at.Probe(ip)
+	}
+	// 局域网服务器: 60 个开放端口耗时一致, 但开放比例不高, 也没有随机高端口开放
+	for p := uint16(1); p <= 60; p++ {
+		at.Record(port.OpenIpPort{Ip: ip, Port: p, State: port.Open, RTT: 200 * time.Microsecond})
+	}
+	if reason, _ := at.Get(ip); reason != "" {
+		t.Errorf("lan server flagged: %s", reason)
+	}
+}
+
+func TestAnomaly_PassedCap(t *testing.T) {
+	at := newAnomalyTable(nil, 5)
+	ip := net.ParseIP("10.0.0.1")
+	for p := uint16(1); p <= 100; p++ {
+		at.Probe(ip)
+	}
+
+	passed := 0
+	for p := uint16(1); p <= 100; p++ {
+		if _, pass := at.Record(port.OpenIpPort{Ip: ip, Port: p, State: port.Open}); pass {
+			passed++
+		}
+	}
+	reason, suppressed := at.Get(ip)
+	if reason == "" {
+		t.Fatal("all ports open should be flagged")
+	}
+	// 第 90 个端口触发标记, 之前放行的 89 个已经超过上限, 之后全部丢弃
+	if passed != 89 || suppressed != 11 {
+		t.Errorf("passed %d suppressed %d", passed, suppressed)
+	}
+}
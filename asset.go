@@ -0,0 +1,316 @@
+package radar
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vela-ssoc/vela-kit/kind"
+	"github.com/vela-ssoc/vela-radar/fingerprintx/plugins"
+)
+
+// Asset 标识前缀
+const (
+	identIP      = "ip:"
+	identSSH     = "ssh:"     // ssh host key 指纹
+	identTLS     = "tls:"     // 证书 CommonName 以及 DNSNames
+	identHost    = "host:"    // SMB/RDP 中的 DNS 计算机名
+	identNetbios = "netbios:" // SMB/RDP 中的 NetBIOS 域\计算机名
+)
+
+// AssetGroup 共享同一标识的ip组成的逻辑资产
+type AssetGroup struct {
+	Id          string   `json:"id"`
+	IPs         []string `json:"ips"`
+	Identifiers []string `json:"identifiers"`
+	issued      bool     // ID 已经在结果中上报过
+}
+
+// canonical 生成资产ID的节点: 字典序最小的标识, 没有标识时使用最小的ip
+// 与扫描顺序无关, 同一台机器在不同扫描以及重启后得到同样的ID
+func (g *AssetGroup) canonical() string {
+	if len(g.Identifiers) > 0 {
+		min := g.Identifiers[0]
+		for _, v := range g.Identifiers[1:] {
+			if v < min {
+				min = v
+			}
+		}
+		return min
+	}
+	min := g.IPs[0]
+	for _, v := range g.IPs[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return identIP + min
+}
+
+// assetTable 并查集, 节点为ip或者标识, 合并后的资产ID由组内的规范节点生成
+type assetTable struct {
+	mu     sync.Mutex
+	parent map[string]string
+	groups map[string]*AssetGroup // 根节点 -> 资产
+	ids    map[string]string      // 资产ID(包括被合并的旧ID) -> 组内节点
+}
+
+func newAssetTable() *assetTable {
+	return &assetTable{
+		parent: make(map[string]string),
+		groups: make(map[string]*AssetGroup),
+		ids:    make(map[string]string),
+	}
+}
+
+// assetId 由规范节点生成, 同样的标识在重启后得到同样的ID
+func assetId(node string) string {
+	sum := sha1.Sum([]byte(node))
+	return "asset-" + hex.EncodeToString(sum[:8])
+}
+
+func (at *assetTable) find(n string) string {
+	root := n
+	for at.parent[root] != root {
+		root = at.parent[root]
+	}
+	// 路径压缩
+	for n != root {
+		next := at.parent[n]
+		at.parent[n] = root
+		n = next
+	}
+	return root
+}
+
+func (at *assetTable) add(node string) {
+	if _, ok := at.parent[node]; ok {
+		return
+	}
+	at.parent[node] = node
+	g := &AssetGroup{Id: assetId(node)}
+	if strings.HasPrefix(node, identIP) {
+		g.IPs = []string{strings.TrimPrefix(node, identIP)}
+	} else {
+		g.Identifiers = []string{node}
+	}
+	at.groups[node] = g
+	at.ids[g.Id] = node
+}
+
+// union 合并两个组, 返回合并前已经上报过的旧ID
+func (at *assetTable) union(a, b string) []string {
+	ra, rb := at.find(a), at.find(b)
+	if ra == rb {
+		return nil
+	}
+
+	// 小的组合并到大的组
+	ga, gb := at.groups[ra], at.groups[rb]
+	var old []string
+	for _, g := range []*AssetGroup{ga, gb} {
+		if g.issued {
+			old = append(old, g.Id)
+		}
+	}
+	if len(ga.IPs)+len(ga.Identifiers) < len(gb.IPs)+len(gb.Identifiers) {
+		ra, rb = rb, ra
+		ga, gb = gb, ga
+	}
+
+	ga.IPs = append(ga.IPs, gb.IPs...)
+	ga.Identifiers = append(ga.Identifiers, gb.Identifiers...)
+	at.parent[rb] = ra
+	delete(at.groups, rb)
+
+	// 旧ID仍然可以查询到合并后的资产
+	ga.Id = assetId(ga.canonical())
+	at.ids[ga.Id] = ra
+	return old
+}
+
+// AssetMerge 资产合并记录, 已经上报的结果中 Aliases 里的ID从此属于资产 Id
+type AssetMerge struct {
+	Id      string   `json:"id"`
+	Aliases []string `json:"aliases"`
+	IP      string   `json:"ip"` // 触发合并的ip
+	TaskId  string   `json:"task_id"`
+}
+
+func (m *AssetMerge) Bytes() []byte {
+	enc := kind.NewJsonEncoder()
+	enc.Tab("")
+	enc.KV("kind", "asset_merge")
+	enc.KV("id", m.Id)
+	enc.KV("aliases", m.Aliases)
+	enc.KV("ip", m.IP)
+	enc.KV("task_id", m.TaskId)
+	enc.End("}")
+	return enc.Bytes()
+}
+
+// Correlate 记录ip的标识, 返回ip所属的资产ID
+// 标识把两个已经有ip的资产合并时ID会变化, merge 不为空, 需要上报给下游关联旧ID
+func (at *assetTable) Correlate(ip net.IP, idents []string) (id string, merge *AssetMerge) {
+	node := identIP + ip.String()
+
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	at.add(node)
+	var old []string
+	for _, ident := range idents {
+		at.add(ident)
+		old = append(old, at.union(node, ident)...)
+	}
+	g := at.groups[at.find(node)]
+	g.issued = true
+	id = g.Id
+
+	seen := map[string]bool{id: true}
+	for _, v := range old {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		if merge == nil {
+			merge = &AssetMerge{Id: id, IP: ip.String()}
+		}
+		merge.Aliases = append(merge.Aliases, v)
+	}
+	if merge != nil {
+		sort.Strings(merge.Aliases)
+	}
+	return id, merge
+}
+
+// Lookup ip 所属的资产ID, 没有记录过返回空
+func (at *assetTable) Lookup(ip net.IP) string {
+	node := identIP + ip.String()
+
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	if _, ok := at.parent[node]; !ok {
+		return ""
+	}
+	g := at.groups[at.find(node)]
+	g.issued = true // 主机记录中上报
+	return g.Id
+}
+
+func (at *assetTable) snapshot(root string) AssetGroup {
+	g := at.groups[root]
+	dup := AssetGroup{
+		Id:          g.Id,
+		IPs:         append([]string(nil), g.IPs...),
+		Identifiers: append([]string(nil), g.Identifiers...),
+	}
+	sort.Strings(dup.IPs)
+	sort.Strings(dup.Identifiers)
+	return dup
+}
+
+// Get 按资产ID或者ip查询, 被合并的旧ID返回合并后的资产
+func (at *assetTable) Get(key string) (AssetGroup, bool) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	node, ok := at.ids[key]
+	if !ok {
+		node = identIP + key
+		if _, ok = at.parent[node]; !ok {
+			return AssetGroup{}, false
+		}
+	}
+	return at.snapshot(at.find(node)), true
+}
+
+// All 所有包含多个ip的资产, all 为 true 时包含单个ip的资产
+func (at *assetTable) All(all bool) []AssetGroup {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	groups := make([]AssetGroup, 0, len(at.groups))
+	for root, g := range at.groups {
+		if len(g.IPs) == 0 || (!all && len(g.IPs) < 2) {
+			continue
+		}
+		groups = append(groups, at.snapshot(root))
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Id < groups[j].Id })
+	return groups
+}
+
+// identifiers 从服务的指纹信息中提取可以跨ip关联的标识
+func identifiers(s *Service) []string {
+	var idents []string
+
+	switch s.Protocol {
+	case plugins.ProtoSSH:
+		var ssh plugins.ServiceSSH
+		if json.Unmarshal(s.Banner, &ssh) == nil && ssh.HostKeyFingerprint != "" {
+			idents = append(idents, identSSH+ssh.HostKeyFingerprint)
+		}
+
+	case plugins.ProtoSMB:
+		var smb plugins.ServiceSMB
+		if json.Unmarshal(s.Banner, &smb) == nil {
+			idents = append(idents, hostIdents(smb.DNSComputerName, smb.NetBIOSDomainName, smb.NetBIOSComputerName)...)
+		}
+
+	case plugins.ProtoRDP:
+		var rdp plugins.ServiceRDP
+		if json.Unmarshal(s.Banner, &rdp) == nil {
+			idents = append(idents, hostIdents(rdp.DNSComputerName, rdp.NetBIOSDomainName, rdp.NetBIOSComputerName)...)
+		}
+	}
+
+	if s.HTTPInfo != nil && !weakTLSName(s.HTTPInfo.TLSCommonName) {
+		// 使用证书的完整名称集合, 避免共用 CN 的不同证书被关联
+		names := append([]string(nil), s.HTTPInfo.TLSDNSNames...)
+		sort.Strings(names)
+		idents = append(idents, identTLS+strings.ToLower(s.HTTPInfo.TLSCommonName+"|"+strings.Join(names, ",")))
+	}
+	return idents
+}
+
+// tlsDefaultNames 设备/软件默认证书常见的 CN, 不同主机共用, 不能作为标识
+var tlsDefaultNames = map[string]bool{
+	"localhost.localdomain": true,
+	"example.com":           true,
+	"www.example.com":       true,
+	"kubernetes.default":    true,
+	"ingress.local":         true,
+	"router.asus.com":       true,
+	"routerlogin.net":       true,
+	"mikrotik.com":          true,
+	"unifi.local":           true,
+	"fritz.box":             true,
+}
+
+// weakTLSName 通配符, ip, 没有域名后缀的名称(localhost, 设备型号等)以及默认证书名称不作为标识
+func weakTLSName(cn string) bool {
+	cn = strings.ToLower(strings.TrimSpace(cn))
+	if cn == "" || strings.HasPrefix(cn, "*.") || !strings.Contains(cn, ".") || strings.Contains(cn, " ") {
+		return true
+	}
+	if net.ParseIP(cn) != nil {
+		return true
+	}
+	return tlsDefaultNames[cn]
+}
+
+func hostIdents(dnsName, domain, netbios string) []string {
+	var idents []string
+	if dnsName != "" {
+		idents = append(idents, identHost+strings.ToLower(dnsName))
+	}
+	if netbios != "" {
+		idents = append(idents, identNetbios+strings.ToUpper(domain+`\`+netbios))
+	}
+	return idents
+}
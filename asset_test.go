@@ -0,0 +1,86 @@
+package radar
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAssetTable_Correlate(t *testing.T) {
+	type obs struct {
+		ip     string
+		idents []string
+	}
+	scan := []obs{
+		{"10.0.0.1", []string{identSSH + "SHA256:aaa"}},
+		{"10.0.0.2", []string{identSSH + "SHA256:aaa", identHost + "db01.corp"}},
+		{"10.0.0.3", []string{identHost + "db01.corp"}},
+		{"10.0.0.9", []string{identSSH + "SHA256:bbb"}},
+	}
+
+	// 扫描顺序不同, 资产ID相同
+	forward, backward := newAssetTable(), newAssetTable()
+	for _, o := range scan {
+		forward.Correlate(net.ParseIP(o.ip), o.idents)
+	}
+	for i := len(scan) - 1; i >= 0; i-- {
+		backward.Correlate(net.ParseIP(scan[i].ip), scan[i].idents)
+	}
+
+	id := forward.Lookup(net.ParseIP("10.0.0.1"))
+	if id == "" || id != forward.Lookup(net.ParseIP("10.0.0.3")) {
+		t.Fatalf("10.0.0.1 and 10.0.0.3 should share an asset, got %s", id)
+	}
+	if id != backward.Lookup(net.ParseIP("10.0.0.1")) {
+		t.Errorf("asset id depends on scan order")
+	}
+	if id != assetId(identHost+"db01.corp") {
+		t.Errorf("asset id should come from the smallest identifier")
+	}
+	if forward.Lookup(net.ParseIP("10.0.0.9")) == id {
+		t.Errorf("unrelated host merged")
+	}
+
+	// 合并前的旧ID仍然可以查询
+	old := assetId(identSSH + "SHA256:aaa")
+	if g, ok := forward.Get(old); !ok || len(g.IPs) != 3 {
+		t.Errorf("old id lookup got %+v %v", g, ok)
+	}
+}
+
+func TestAssetTable_Merge(t *testing.T) {
+	at := newAssetTable()
+	a, merge := at.Correlate(net.ParseIP("10.0.0.1"), []string{identSSH + "SHA256:aaa"})
+	if merge != nil {
+		t.Fatalf("new asset should not merge, got %+v", merge)
+	}
+	b, _ := at.Correlate(net.ParseIP("10.0.0.2"), []string{identHost + "db01.corp"})
+
+	// 同时带有两个标识的ip把两个已经上报过的资产合并
+	id, merge := at.Correlate(net.ParseIP("10.0.0.3"), []string{identSSH + "SHA256:aaa", identHost + "db01.corp"})
+	if merge == nil || merge.Id != id {
+		t.Fatalf("want merge record for %s, got %+v", id, merge)
+	}
+	for _, old := range []string{a, b} {
+		if old == id {
+			continue
+		}
+		found := false
+		for _, v := range merge.Aliases {
+			found = found || v == old
+		}
+		if !found {
+			t.Errorf("alias %s missing in %v", old, merge.Aliases)
+		}
+	}
+}
+
+func TestWeakTLSName(t *testing.T) {
+	for _, cn := range []string{"", "localhost", "*.corp.com", "10.0.0.1", "FortiGate", "TRAEFIK DEFAULT CERT", "localhost.localdomain"} {
+		if !weakTLSName(cn) {
+			t.Errorf("%q should be weak", cn)
+		}
+	}
+	if weakTLSName("portal.corp.com") {
+		t.Error("fqdn should be a valid identifier")
+	}
+}
@@ -1,11 +1,16 @@
 package radar
 
 import (
+	"strings"
 	"time"
 
 	"github.com/vela-ssoc/vela-kit/lua"
 	"github.com/vela-ssoc/vela-kit/pipe"
 	"github.com/vela-ssoc/vela-radar/fingerprintx/scan"
+	"github.com/vela-ssoc/vela-radar/host"
+	"github.com/vela-ssoc/vela-radar/report"
+	"github.com/vela-ssoc/vela-radar/rule"
+	"github.com/vela-ssoc/vela-radar/store"
 	"github.com/vela-ssoc/vela-radar/util"
 )
 
@@ -18,8 +23,17 @@ type Config struct {
 	MinioCfg   *util.MinioCfg
 	ReportDoer string
 	ReportUri  string
-	Debug      bool
-	Chains     *pipe.Chains
+	// 主机维度结果(端口状态统计)的上报地址, 为空则只发送到 pipe
+	ReportHostUri string
+	DNSServer     string // 主机名 PTR 查询使用的 DNS 服务器
+	SNMP          []host.SNMPCredential
+	Report        report.Option // 上报队列, 批量, 重试以及 spool
+	Sinks         []report.SinkConfig
+	Store         *store.Option // 本地结果库, 为空表示不保存
+	Rules         []rule.Rule   // 结果过滤规则, 在 pipe 和输出之前处理
+	Policy        *Policy       // 扫描范围策略, 为空不限制
+	Debug         bool
+	Chains        *pipe.Chains
 }
 
 func NewConfig(L *lua.LState) *Config {
@@ -35,8 +49,9 @@ func NewConfig(L *lua.LState) *Config {
 		MinioCfg:   &util.MinioCfg{},
 		ReportDoer: "/api/v1/broker/proxy/siem/",
 		ReportUri:  "/api/netapp/mono",
+		SNMP:       []host.SNMPCredential{{Version: "v2c", Community: "public"}},
+		Report:     report.DefaultOption(),
 	}
-
 	tab := L.CheckTable(1)
 
 	tab.Range(func(s string, value lua.LValue) {
@@ -108,6 +123,286 @@ func (cfg *Config) MinioConfig(L *lua.LState, val lua.LValue) {
 
 }
 
+// ReportConfig eg: report = {queue = 10000, batch = 100, interval = 5, gzip = true, retry = 3, spool = "radar_spool", spool_size = 256, replay = 20}
+func (cfg *Config) ReportConfig(L *lua.LState, val lua.LValue) {
+	if val.Type() != lua.LTTable {
+		L.RaiseError("report config must table , got %s", val.Type().String())
+		return
+	}
+	tab := val.(*lua.LTable)
+	tab.Range(func(key string, value lua.LValue) {
+		switch key {
+		case "queue":
+			cfg.Report.Queue = lua.IsInt(value)
+		case "batch":
+			cfg.Report.Batch = lua.IsInt(value)
+		case "interval":
+			cfg.Report.Interval = time.Duration(lua.IsInt(value)) * time.Second
+		case "gzip":
+			cfg.Report.Gzip = lua.IsTrue(value)
+		case "retry":
+			cfg.Report.Retry = lua.IsInt(value)
+		case "backoff":
+			cfg.Report.Backoff = time.Duration(lua.IsInt(value)) * time.Millisecond
+		case "spool":
+			cfg.Report.SpoolDir = lua.IsString(value)
+		case "spool_size":
+			cfg.Report.SpoolSize = int64(lua.IsInt(value)) << 20
+		case "replay":
+			cfg.Report.Replay = lua.IsInt(value)
+		}
+	})
+}
+
+// SinksConfig 多个结果输出, 每个输出可以单独设置过滤和格式
+// eg: sinks = {{type = "file", path = "radar.jsonl", kind = {"service"}, filter = {protocol = {"http", "https"}}}, {type = "syslog", addr = "udp://10.0.0.1:514", format = "kv"}}
+func (cfg *Config) SinksConfig(L *lua.LState, val lua.LValue) {
+	if val.Type() != lua.LTTable {
+		L.RaiseError("sinks config must table , got %s", val.Type().String())
+		return
+	}
+
+	tab := val.(*lua.LTable)
+	for i := 1; i <= tab.Len(); i++ {
+		item := tab.RawGetInt(i)
+		if item.Type() != lua.LTTable {
+			L.RaiseError("sink config must table , got %s", item.Type().String())
+			return
+		}
+
+		// 队列参数只记录单独设置的 batch/interval, 其余在创建时使用 report 配置
+		var sc report.SinkConfig
+		item.(*lua.LTable).Range(func(key string, value lua.LValue) {
+			switch key {
+			case "type":
+				sc.Type = lua.IsString(value)
+			case "name":
+				sc.Name = lua.IsString(value)
+			case "kind":
+				sc.Kinds = luaStrings(value)
+			case "filter":
+				if value.Type() != lua.LTTable {
+					L.RaiseError("sink filter must table , got %s", value.Type().String())
+					return
+				}
+				sc.Filter = make(map[string][]string)
+				value.(*lua.LTable).Range(func(field string, v lua.LValue) {
+					sc.Filter[field] = luaStrings(v)
+				})
+			case "format":
+				sc.Format = lua.IsString(value)
+			case "batch":
+				sc.Queue.Batch = lua.IsInt(value)
+			case "interval":
+				sc.Queue.Interval = time.Duration(lua.IsInt(value)) * time.Second
+			case "timeout":
+				sc.Timeout = time.Duration(lua.IsInt(value)) * time.Millisecond
+			case "path":
+				sc.Path = lua.IsString(value)
+			case "max_size":
+				sc.MaxSize = int64(lua.IsInt(value)) << 20
+			case "backups":
+				sc.Backups = lua.IsInt(value)
+			case "addr":
+				sc.Addr = lua.IsString(value)
+			case "facility":
+				sc.Facility = lua.IsInt(value)
+			case "app":
+				sc.AppName = lua.IsString(value)
+			case "hostname":
+				sc.Hostname = lua.IsString(value)
+			case "brokers":
+				sc.Brokers = luaStrings(value)
+			case "topic":
+				sc.Topic = lua.IsString(value)
+			case "url":
+				sc.URL = lua.IsString(value)
+			case "index":
+				sc.Index = lua.IsString(value)
+			case "user":
+				sc.User = lua.IsString(value)
+			case "password":
+				sc.Password = lua.IsString(value)
+			}
+		})
+
+		if sc.Type == "" {
+			L.RaiseError("sink type is empty")
+			return
+		}
+		cfg.Sinks = append(cfg.Sinks, sc)
+	}
+}
+
+// StoreConfig 本地结果库, 默认不开启, true 使用默认参数
+// eg: store = {path = "radar.db", max_age = 30, max_records = 1000000}
+func (cfg *Config) StoreConfig(L *lua.LState, val lua.LValue) {
+	switch val.Type() {
+	case lua.LTBool:
+		cfg.Store = nil
+		if lua.IsTrue(val) {
+			opt := store.DefaultOption()
+			cfg.Store = &opt
+		}
+		return
+	case lua.LTTable:
+	default:
+		L.RaiseError("store config must table or bool , got %s", val.Type().String())
+		return
+	}
+
+	opt := store.DefaultOption()
+	val.(*lua.LTable).Range(func(key string, value lua.LValue) {
+		switch key {
+		case "path":
+			opt.Path = lua.IsString(value)
+		case "max_age":
+			opt.MaxAge = time.Duration(lua.IsInt(value)) * 24 * time.Hour
+		case "max_records":
+			opt.MaxRecords = lua.IsInt(value)
+		}
+	})
+	cfg.Store = &opt
+}
+
+// PolicyConfig 扫描范围策略
+// eg: policy = {allow = {"10.0.0.0/8", "scan.example.com"}, deny = "10.0.0.1,10.255.0.0/16", max_rate = 2000, max_ports = 1000, modes = {"tcp"}, hours = {"08:00-20:00"}, clip = true}
+func (cfg *Config) PolicyConfig(L *lua.LState, val lua.LValue) {
+	if val.Type() != lua.LTTable {
+		L.RaiseError("policy config must table , got %s", val.Type().String())
+		return
+	}
+
+	p := &Policy{}
+	val.(*lua.LTable).Range(func(key string, value lua.LValue) {
+		switch key {
+		case "allow":
+			p.Allow = luaStrings(value)
+		case "deny":
+			p.Deny = strings.Join(luaStrings(value), ",")
+		case "max_rate":
+			p.MaxRate = lua.IsInt(value)
+		case "max_ports":
+			p.MaxPorts = lua.IsInt(value)
+		case "max_pool":
+			p.MaxPool = lua.IsInt(value)
+		case "modes":
+			p.Modes = luaStrings(value)
+		case "hours":
+			p.Hours = luaStrings(value)
+		case "clip":
+			p.Clip = lua.IsTrue(value)
+		}
+	})
+	if err := p.Check(); err != nil {
+		L.RaiseError("%v", err)
+		return
+	}
+	cfg.Policy = p
+}
+
+// FilterRulesConfig eg: filter = {{name = "self", expr = "ip = 10.0.0.1 and port in 5000,5001"}, {expr = "port in 9100,515", action = "tag", tag = "printer"}}
+func (cfg *Config) FilterRulesConfig(L *lua.LState, val lua.LValue) {
+	if val.Type() != lua.LTTable {
+		L.RaiseError("filter config must table , got %s", val.Type().String())
+		return
+	}
+
+	tab := val.(*lua.LTable)
+	for i := 1; i <= tab.Len(); i++ {
+		item := tab.RawGetInt(i)
+		var r rule.Rule
+		switch item.Type() {
+		case lua.LTString:
+			// 只有表达式时丢弃命中的结果
+			r.Expr = item.String()
+		case lua.LTTable:
+			item.(*lua.LTable).Range(func(key string, value lua.LValue) {
+				switch key {
+				case "name":
+					r.Name = lua.IsString(value)
+				case "expr":
+					r.Expr = lua.IsString(value)
+				case "kind":
+					r.Kind = luaStrings(value)
+				case "action":
+					r.Action = lua.IsString(value)
+				case "tag":
+					r.Tag = lua.IsString(value)
+				case "sink":
+					r.Sink = lua.IsString(value)
+				}
+			})
+		default:
+			L.RaiseError("filter rule must string or table , got %s", item.Type().String())
+			return
+		}
+
+		if err := r.Compile(); err != nil {
+			L.RaiseError("%v", err)
+			return
+		}
+		cfg.Rules = append(cfg.Rules, r)
+	}
+}
+
+// luaStrings 字符串或者数组转换为字符串列表
+func luaStrings(val lua.LValue) []string {
+	tab, ok := val.(*lua.LTable)
+	if !ok {
+		return []string{val.String()}
+	}
+
+	var out []string
+	for i := 1; i <= tab.Len(); i++ {
+		out = append(out, tab.RawGetInt(i).String())
+	}
+	return out
+}
+
+// SNMPConfig 字符串为 v2c community, 表为完整的认证信息
+// eg: snmp = {"public", {version = "v1", community = "private"}, {version = "v3", user = "admin", auth = "sha", auth_pass = "xxx", priv = "aes", priv_pass = "xxx"}}
+func (cfg *Config) SNMPConfig(L *lua.LState, val lua.LValue) {
+	if val.Type() != lua.LTTable {
+		L.RaiseError("snmp config must table , got %s", val.Type().String())
+		return
+	}
+
+	tab := val.(*lua.LTable)
+	cfg.SNMP = nil
+	for i := 1; i <= tab.Len(); i++ {
+		item := tab.RawGetInt(i)
+		switch item.Type() {
+		case lua.LTString:
+			cfg.SNMP = append(cfg.SNMP, host.SNMPCredential{Version: "v2c", Community: item.String()})
+		case lua.LTTable:
+			var cred host.SNMPCredential
+			item.(*lua.LTable).Range(func(key string, value lua.LValue) {
+				switch key {
+				case "version":
+					cred.Version = lua.IsString(value)
+				case "community":
+					cred.Community = lua.IsString(value)
+				case "user":
+					cred.User = lua.IsString(value)
+				case "auth":
+					cred.AuthProto = lua.IsString(value)
+				case "auth_pass":
+					cred.AuthPass = lua.IsString(value)
+				case "priv":
+					cred.PrivProto = lua.IsString(value)
+				case "priv_pass":
+					cred.PrivPass = lua.IsString(value)
+				}
+			})
+			cfg.SNMP = append(cfg.SNMP, cred)
+		default:
+			L.RaiseError("snmp credential must string or table , got %s", item.Type().String())
+			return
+		}
+	}
+}
+
 func (cfg *Config) NewIndex(L *lua.LState, key string, val lua.LValue) {
 	switch key {
 	case "name":
@@ -126,6 +421,22 @@ func (cfg *Config) NewIndex(L *lua.LState, key string, val lua.LValue) {
 		cfg.ReportDoer = val.String()
 	case "reportUri":
 		cfg.ReportUri = val.String()
+	case "reportHostUri":
+		cfg.ReportHostUri = val.String()
+	case "dns":
+		cfg.DNSServer = val.String()
+	case "snmp":
+		cfg.SNMPConfig(L, val)
+	case "report":
+		cfg.ReportConfig(L, val)
+	case "sinks":
+		cfg.SinksConfig(L, val)
+	case "store":
+		cfg.StoreConfig(L, val)
+	case "filter":
+		cfg.FilterRulesConfig(L, val)
+	case "policy":
+		cfg.PolicyConfig(L, val)
 	case "debug":
 		cfg.Debug = lua.CheckBool(L, val)
 	//todo
@@ -1,8 +1,10 @@
 package radar
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -37,6 +39,18 @@ func (rad *Radar) ResumePath() string {
 	return "/api/v1/arr/agent/radar/resume"
 }
 
+func (rad *Radar) PassivePath() string {
+	return "/api/v1/arr/agent/radar/passive"
+}
+
+func (rad *Radar) AssetPath() string {
+	return "/api/v1/arr/agent/radar/asset"
+}
+
+func (rad *Radar) ExportPath() string {
+	return "/api/v1/arr/agent/radar/tasks/{id}/export"
+}
+
 func (rad *Radar) TaskHandle(ctx *fasthttp.RequestCtx) error {
 	if rad.TaskStatus() == "working" {
 		return errors.New("there are already scanning tasks running")
@@ -51,134 +65,29 @@ func (rad *Radar) TaskHandle(ctx *fasthttp.RequestCtx) error {
 		ctx.SetStatusCode(fasthttp.StatusBadRequest)
 		return err
 	}
-	if v, ok := data["target"].(string); ok && v != "" {
-		rad.NewTask(v)
-	} else {
+	v, ok := data["target"].(string)
+	if !ok || v == "" {
 		return errors.New(taskParameterInitErr + "target")
 	}
-	for key, value := range data {
-		switch key {
-		case "location":
-			if v, ok := value.(string); ok {
-				rad.task.Option.Location = v
-			} else {
-				return errors.New(taskParameterInitErr + key)
-			}
-		case "name":
-			if v, ok := value.(string); ok {
-				rad.task.Name = v
-			} else {
-				return errors.New(taskParameterInitErr + key)
-			}
-		case "mode":
-			if v, ok := value.(string); ok {
-				rad.task.Option.Mode = v
-			} else {
-				// return errors.New(taskParameterInitErr)
-			}
-		case "port":
-			if v, ok := value.(string); ok {
-				rad.task.Option.Port = v
-			} else {
-				// return errors.New(taskParameterInitErr)
-			}
-		case "rate":
-			if v, ok := value.(float64); ok {
-				rad.task.Option.set_rate(int(v))
-			} else {
-				// return errors.New(taskParameterInitErr)
-			}
-		case "timeout":
-			if v, ok := value.(float64); ok {
-				rad.task.Option.set_timeout(int(v))
-			} else {
-				// return errors.New(taskParameterInitErr)
-			}
-		case "httpx":
-			if v, ok := value.(bool); ok {
-				rad.task.Option.Httpx = v
-			} else {
-				// return errors.New(taskParameterInitErr)
-			}
-		case "fingerDB":
-			if v, ok := value.(string); ok {
-				rad.task.Option.FingerDB = v
-			} else {
-				// return errors.New(taskParameterInitErr)
-			}
-		case "ping":
-			if v, ok := value.(bool); ok {
-				rad.task.Option.Ping = v
-			} else {
-				// return errors.New(taskParameterInitErr)
-			}
-		case "screenshot":
-			if v, ok := value.(bool); ok {
-				rad.task.Option.Screenshot = v
-			} else {
-				// return errors.New(taskParameterInitErr)
-			}
-		case "pool_ping":
-			if v, ok := value.(float64); ok {
-				rad.task.Option.set_pool_ping(int(v))
-			} else {
-				// return errors.New(taskParameterInitErr)
-			}
-		case "pool_scan":
-			if v, ok := value.(float64); ok {
-				rad.task.Option.set_pool_scan(int(v))
-			} else {
-				// return errors.New(taskParameterInitErr)
-			}
-		case "pool_finger":
-			if v, ok := value.(float64); ok {
-				rad.task.Option.set_pool_finger(int(v))
-			} else {
-				// return errors.New(taskParameterInitErr)
-			}
-		case "debug":
-			if v, ok := value.(bool); ok {
-				rad.task.Debug = v
-			} else {
-				// return errors.New(taskParameterInitErr)
-			}
-		case "report":
-			if v, ok := value.(bool); ok {
-				rad.task.Report = v
-			} else {
-				// return errors.New(taskParameterInitErr)
-			}
-		case "exclude_target":
-			if v, ok := value.(string); ok {
-				rad.task.Option.set_exclude_target(v)
-			} else {
-				// return errors.New(taskParameterInitErr)
-			}
-		case "excludeTimeRange":
-			if v, ok := value.(string); ok {
-				elements := strings.Split(v, ",")
-				if len(elements) == 3 {
-					err := rad.task.Option.set_ExcludeTimeRange_Daily(elements[0])
-					if err != nil {
-						return err
-					}
-					err = rad.task.Option.set_ExcludeTimeRange_Begin(elements[0])
-					if err != nil {
-						return err
-					}
-					err = rad.task.Option.set_ExcludeTimeRange_End(elements[0])
-					if err != nil {
-						return err
-					}
-				} else {
-					return errors.New(taskParameterInitErr + key)
-				}
-			} else {
-				// return errors.New(taskParameterInitErr)
-			}
-
+	t := rad.NewTask(v)
+	// 之后的错误都需要丢弃未启动的任务, 否则任务状态一直是 working
+	if name, ok := data["profile"].(string); ok && name != "" {
+		if err := t.useProfile(name); err != nil {
+			rad.discard(t)
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			return err
 		}
 	}
+	if err := t.apply(data, false); err != nil {
+		rad.discard(t)
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return err
+	}
+	if err := rad.enforce(t, "http"); err != nil {
+		rad.discard(t)
+		ctx.SetStatusCode(fasthttp.StatusForbidden)
+		return err
+	}
 	rad.task.Start_time = time.Now()
 	rad.task.Id = uuid.NewString()
 	go rad.task.GenRun()
@@ -188,6 +97,243 @@ func (rad *Radar) TaskHandle(ctx *fasthttp.RequestCtx) error {
 	return nil
 }
 
+// set 按 runscan 的字段名设置任务参数, 未知字段返回 false
+func (t *Task) set(key string, value interface{}) (bool, error) {
+	switch key {
+	case "location":
+		if v, ok := value.(string); ok {
+			t.Option.Location = v
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "name":
+		if v, ok := value.(string); ok {
+			t.Name = v
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "mode":
+		if v, ok := value.(string); ok {
+			t.Option.Mode = v
+		} else {
+			// return errors.New(taskParameterInitErr)
+		}
+	case "port":
+		if v, ok := value.(string); ok {
+			t.Option.Port = v
+		} else {
+			// return errors.New(taskParameterInitErr)
+		}
+	case "rate":
+		if v, ok := value.(float64); ok {
+			t.Option.set_rate(int(v))
+		} else {
+			// return errors.New(taskParameterInitErr)
+		}
+	case "timeout":
+		if v, ok := value.(float64); ok {
+			t.Option.set_timeout(int(v))
+		} else {
+			// return errors.New(taskParameterInitErr)
+		}
+	case "httpx":
+		if v, ok := value.(bool); ok {
+			t.Option.Httpx = v
+		} else {
+			// return errors.New(taskParameterInitErr)
+		}
+	case "fingerDB":
+		if v, ok := value.(string); ok {
+			t.Option.FingerDB = v
+		} else {
+			// return errors.New(taskParameterInitErr)
+		}
+	case "ping":
+		if v, ok := value.(bool); ok {
+			t.Option.Ping = v
+		} else {
+			// return errors.New(taskParameterInitErr)
+		}
+	case "screenshot":
+		if v, ok := value.(bool); ok {
+			t.Option.Screenshot = v
+		} else {
+			// return errors.New(taskParameterInitErr)
+		}
+	case "pool_ping":
+		if v, ok := value.(float64); ok {
+			t.Option.set_pool_ping(int(v))
+		} else {
+			// return errors.New(taskParameterInitErr)
+		}
+	case "pool_scan":
+		if v, ok := value.(float64); ok {
+			t.Option.set_pool_scan(int(v))
+		} else {
+			// return errors.New(taskParameterInitErr)
+		}
+	case "pool_finger":
+		if v, ok := value.(float64); ok {
+			t.Option.set_pool_finger(int(v))
+		} else {
+			// return errors.New(taskParameterInitErr)
+		}
+	case "debug":
+		if v, ok := value.(bool); ok {
+			t.Debug = v
+		} else {
+			// return errors.New(taskParameterInitErr)
+		}
+	case "report":
+		if v, ok := value.(bool); ok {
+			t.Report = v
+		} else {
+			// return errors.New(taskParameterInitErr)
+		}
+	case "state":
+		if v, ok := value.(bool); ok {
+			t.Option.State = v
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "state_ports":
+		if v, ok := value.(string); ok {
+			if err := t.Option.set_state(t.Option.State, v); err != nil {
+				return true, errors.New(taskParameterInitErr + key)
+			}
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "trace":
+		if v, ok := value.(string); ok {
+			if err := t.Option.set_trace(v, t.Option.TraceHops); err != nil {
+				return true, errors.New(taskParameterInitErr + key)
+			}
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "trace_hops":
+		if v, ok := value.(float64); ok {
+			if err := t.Option.set_trace(t.Option.Trace, int(v)); err != nil {
+				return true, errors.New(taskParameterInitErr + key)
+			}
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "names":
+		if v, ok := value.(bool); ok {
+			t.Option.Names = v
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "snmp":
+		if v, ok := value.(bool); ok {
+			t.Option.SNMP = v
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "snmp_learn":
+		if v, ok := value.(bool); ok {
+			t.Option.SNMPLearn = v
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "anomaly":
+		if v, ok := value.(bool); ok {
+			t.Option.set_anomaly(v, t.Option.AnomalyCap)
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "anomaly_cap":
+		if v, ok := value.(float64); ok {
+			t.Option.set_anomaly(t.Option.Anomaly, int(v))
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "safe":
+		if v, ok := value.(bool); ok {
+			t.Option.Safe = v
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "safe_target":
+		if v, ok := value.(string); ok {
+			t.Option.SafeTarget = v
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "safe_auto":
+		if v, ok := value.(bool); ok {
+			t.Option.SafeAuto = v
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "safe_delay":
+		if v, ok := value.(float64); ok {
+			t.Option.set_safe_delay(int(v))
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "skip_self":
+		if v, ok := value.(bool); ok {
+			t.Option.SkipSelf = v
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "skip_gateway":
+		if v, ok := value.(bool); ok {
+			t.Option.SkipGateway = v
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "skip_boundary":
+		if v, ok := value.(bool); ok {
+			t.Option.SkipBoundary = v
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "discover":
+		if v, ok := value.(string); ok {
+			if err := t.Option.set_discover(v); err != nil {
+				return true, errors.New(taskParameterInitErr + key)
+			}
+		} else {
+			return true, errors.New(taskParameterInitErr + key)
+		}
+	case "exclude_target":
+		if v, ok := value.(string); ok {
+			t.Option.set_exclude_target(v)
+		} else {
+			// return errors.New(taskParameterInitErr)
+		}
+	case "excludeTimeRange":
+		if v, ok := value.(string); ok {
+			elements := strings.Split(v, ",")
+			if len(elements) == 3 {
+				err := t.Option.set_ExcludeTimeRange_Daily(elements[0])
+				if err != nil {
+					return true, err
+				}
+				err = t.Option.set_ExcludeTimeRange_Begin(elements[0])
+				if err != nil {
+					return true, err
+				}
+				err = t.Option.set_ExcludeTimeRange_End(elements[0])
+				if err != nil {
+					return true, err
+				}
+			} else {
+				return true, errors.New(taskParameterInitErr + key)
+			}
+		} else {
+			// return errors.New(taskParameterInitErr)
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
 func (rad *Radar) StatusHandle(ctx *fasthttp.RequestCtx) error {
 	info := rad.Info()
 	// fmt.Println(string(info))
@@ -200,15 +346,8 @@ func (rad *Radar) PauseHandle(ctx *fasthttp.RequestCtx) error {
 	if rad.task == nil {
 		return errors.New("当前没有扫描任务")
 	}
-	switch rad.task.Status {
-	case Task_Status_Running:
-		rad.task.Status = Task_Status_Paused_Artificial
-	case Task_Status_Paused_Artificial:
-		return errors.New("任务已经处于暂停状态")
-	case Task_Status_Paused_By_Program:
-		rad.task.Status = Task_Status_Paused_Artificial
-	default:
-		return errors.New("无法暂停任务, 任务现在是[" + rad.task.Status.Detail() + "] 状态")
+	if err := rad.task.Pause(); err != nil {
+		return err
 	}
 	ctx.Response.SetBody([]byte("ok"))
 	return nil
@@ -218,27 +357,73 @@ func (rad *Radar) ResumeHandle(ctx *fasthttp.RequestCtx) error {
 	if rad.task == nil {
 		return errors.New("当前没有扫描任务")
 	}
-	switch rad.task.Status {
-	case Task_Status_Running:
-		return errors.New("task is already running")
-	case Task_Status_Paused_Artificial:
-		isInTimeRange, err := util.IsWithinRange(rad.task.Option.ExcludeTimeRange)
-		if err != nil {
-			return errors.New("无法恢复任务, 排除时间范围设置错误")
-		}
-		if !isInTimeRange {
-			rad.task.Status = Task_Status_Running
-		} else {
-			rad.task.Status = Task_Status_Paused_By_Program
-			ctx.Response.SetBody([]byte("ok, 但是处于排除时间范围内，不能立即恢复执行, 需等待到排除时间外执行"))
-			return nil
-		}
-	case Task_Status_Paused_By_Program:
-		rad.task.Status = Task_Status_Paused_Artificial
-	default:
-		return errors.New("无法恢复任务, 任务现在是[" + rad.task.Status.Detail() + "] 状态")
+	msg, err := rad.task.Resume()
+	if err != nil {
+		return err
 	}
-	ctx.Response.SetBody([]byte("ok"))
+	ctx.Response.SetBody([]byte(msg))
+	return nil
+}
+
+// PassiveHandle 被动监听发现的主机清单
+func (rad *Radar) PassiveHandle(ctx *fasthttp.RequestCtx) error {
+	if rad.passive == nil {
+		return errors.New("passive listener not running")
+	}
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.SetBody(util.ToJsonBytes(rad.passive.Assets()))
+	return nil
+}
+
+// AssetHandle 按资产ID或者ip查询关联的资产, 不带参数返回所有多ip资产
+func (rad *Radar) AssetHandle(ctx *fasthttp.RequestCtx) error {
+	args := ctx.QueryArgs()
+	ctx.Response.Header.SetContentType("application/json")
+
+	if key := string(args.Peek("id")); key != "" {
+		g, ok := rad.assets.Get(key)
+		if !ok {
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+			return errors.New("asset not found")
+		}
+		ctx.Response.SetBody(util.ToJsonBytes(g))
+		return nil
+	}
+
+	ctx.Response.SetBody(util.ToJsonBytes(rad.assets.All(args.Has("all"))))
+	return nil
+}
+
+// ExportHandle 导出当前或者上一次任务的结果, format 为 nmap/csv/jsonl/html
+func (rad *Radar) ExportHandle(ctx *fasthttp.RequestCtx) error {
+	id, _ := ctx.UserValue("id").(string)
+	t := rad.taskById(id)
+	if t == nil {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		return errors.New("task not found")
+	}
+
+	format := exportFormat(string(ctx.QueryArgs().Peek("format")))
+	if format == "" {
+		format = exportJSONL
+	}
+	contentType, ok := exportContentType(format)
+	if !ok {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return errors.New("export format not support, use nmap/csv/jsonl/html")
+	}
+
+	var buf bytes.Buffer
+	if err := t.Export(&buf, format); err != nil {
+		return err
+	}
+	ext := format
+	if format == exportNmap {
+		ext = "xml"
+	}
+	ctx.Response.Header.SetContentType(contentType)
+	ctx.Response.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"radar-%s.%s\"", t.Id, ext))
+	ctx.Response.SetBody(buf.Bytes())
 	return nil
 }
 
@@ -248,6 +433,18 @@ func (rad *Radar) Define() {
 	r.GET(rad.StatusPath(), xEnv.Then(rad.StatusHandle))
 	r.GET(rad.PausePath(), xEnv.Then(rad.PauseHandle))
 	r.GET(rad.ResumePath(), xEnv.Then(rad.ResumeHandle))
+	r.GET(rad.PassivePath(), xEnv.Then(rad.PassiveHandle))
+	r.GET(rad.AssetPath(), xEnv.Then(rad.AssetHandle))
+	r.GET(rad.ExportPath(), xEnv.Then(rad.ExportHandle))
+	r.GET(rad.QueryPath(), xEnv.Then(rad.QueryHandle))
+	r.POST(rad.ProbePath(), xEnv.Then(rad.ProbeHandle))
+	r.GET(rad.ProfilePath(), xEnv.Then(rad.ProfileListHandle))
+	r.POST(rad.ProfilePath(), xEnv.Then(rad.ProfilePutHandle))
+	r.POST(rad.ProfileDeletePath(), xEnv.Then(rad.ProfileDeleteHandle))
+	r.GET(rad.MetricsPath(), xEnv.Then(rad.MetricsHandle))
+	r.GET(rad.FilterPath(), xEnv.Then(rad.FilterListHandle))
+	r.POST(rad.FilterPath(), xEnv.Then(rad.FilterPutHandle))
+	r.POST(rad.FilterDeletePath(), xEnv.Then(rad.FilterDeleteHandle))
 }
 
 func (rad *Radar) UndoDefine() {
@@ -256,4 +453,16 @@ func (rad *Radar) UndoDefine() {
 	r.Undo(fasthttp.MethodGet, rad.StatusPath())
 	r.Undo(fasthttp.MethodGet, rad.PausePath())
 	r.Undo(fasthttp.MethodGet, rad.ResumePath())
+	r.Undo(fasthttp.MethodGet, rad.PassivePath())
+	r.Undo(fasthttp.MethodGet, rad.AssetPath())
+	r.Undo(fasthttp.MethodGet, rad.ExportPath())
+	r.Undo(fasthttp.MethodGet, rad.QueryPath())
+	r.Undo(fasthttp.MethodPost, rad.ProbePath())
+	r.Undo(fasthttp.MethodGet, rad.ProfilePath())
+	r.Undo(fasthttp.MethodPost, rad.ProfilePath())
+	r.Undo(fasthttp.MethodPost, rad.ProfileDeletePath())
+	r.Undo(fasthttp.MethodGet, rad.MetricsPath())
+	r.Undo(fasthttp.MethodGet, rad.FilterPath())
+	r.Undo(fasthttp.MethodPost, rad.FilterPath())
+	r.Undo(fasthttp.MethodPost, rad.FilterDeletePath())
 }
@@ -0,0 +1,148 @@
+package radar
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/vela-ssoc/vela-kit/iputil"
+	"github.com/vela-ssoc/vela-radar/discover"
+)
+
+const discoverWait = 3 * time.Second
+
+// deviceTable 组播发现的设备, 发现阶段结束后只读
+type deviceTable struct {
+	devices map[string]*discover.Device
+	extra   int // 不在任务目标中的新ip数量
+}
+
+func (dt *deviceTable) Get(ip net.IP) *discover.Device {
+	return dt.devices[ip.String()]
+}
+
+// Ports 设备公布的服务端口中不在任务端口列表里的部分
+func (dt *deviceTable) Ports(ip net.IP, ports []uint16) []uint16 {
+	d, ok := dt.devices[ip.String()]
+	if !ok {
+		return nil
+	}
+
+	var extra []uint16
+	for _, p := range d.Ports {
+		found := false
+		for _, v := range ports {
+			if v == p {
+				found = true
+				break
+			}
+		}
+		if !found {
+			extra = append(extra, p)
+		}
+	}
+	return extra
+}
+
+func (dt *deviceTable) Len() int {
+	return len(dt.devices)
+}
+
+// inTargets 判断ip是否在任务目标中, iputil 的每一项都是连续的地址段
+func inTargets(items []string, ip net.IP) bool {
+	ip4 := ip.To4()
+	for _, item := range items {
+		it, _, err := iputil.NewIter(item)
+		if err != nil || it.TotalNum() == 0 {
+			continue
+		}
+		first := it.GetIpByIndex(0).To4()
+		last := it.GetIpByIndex(it.TotalNum() - 1).To4()
+		if first == nil || last == nil || ip4 == nil {
+			continue
+		}
+		if bytes.Compare(ip4, first) >= 0 && bytes.Compare(ip4, last) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// linkGroups 零散ip按本机直连的网段分组, 不在直连网段的ip经过路由转发, 放在同一组
+// 同一组使用一个扫描器, 路由按组内第一个ip选择
+func linkGroups(ips []string) [][]net.IP {
+	var nets []*net.IPNet
+	for _, ipn := range localNets() {
+		if ipn.IP.To4() != nil && !ipn.IP.IsLoopback() {
+			nets = append(nets, ipn)
+		}
+	}
+
+	index := make(map[int]int) // 网段序号 -> 分组序号, -1 为路由转发
+	var groups [][]net.IP
+	for _, item := range ips {
+		ip := net.ParseIP(strings.TrimSpace(item))
+		if ip == nil {
+			continue
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+
+		key := -1
+		for i, n := range nets {
+			if n.Contains(ip) {
+				key = i
+				break
+			}
+		}
+		g, ok := index[key]
+		if !ok {
+			g = len(groups)
+			index[key] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], ip)
+	}
+	return groups
+}
+
+// discoverDevices 组播发现阶段, 返回不在任务目标中的新ip, 作为额外的扫描目标
+func (t *Task) discoverDevices(items []string) []string {
+	opt := discover.Option{Wait: discoverWait}
+	for _, v := range strings.Split(t.Option.Discover, ",") {
+		switch strings.TrimSpace(v) {
+		case "all":
+			opt.SSDP, opt.MDNS, opt.WSD = true, true, true
+		case discover.SourceSSDP:
+			opt.SSDP = true
+		case discover.SourceMDNS:
+			opt.MDNS = true
+		case discover.SourceWSD:
+			opt.WSD = true
+		}
+	}
+
+	t.devices = &deviceTable{devices: make(map[string]*discover.Device)}
+	devices, err := discover.Sweep(opt)
+	if err != nil {
+		xEnv.Errorf("task %s multicast discovery fail %v", t.Id, err)
+		return nil
+	}
+
+	var extra []string
+	for _, d := range devices {
+		key := d.IP.String()
+		t.devices.devices[key] = d
+		if !inTargets(items, d.IP) {
+			extra = append(extra, key)
+		}
+	}
+	t.devices.extra = len(extra)
+
+	if t.rad.cfg.Debug || t.Debug {
+		xEnv.Infof("task %s multicast discovery end, %d devices, %d new targets", t.Id, len(devices), len(extra))
+	}
+	return extra
+}
@@ -0,0 +1,217 @@
+package discover
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	SourceSSDP = "ssdp"
+	SourceMDNS = "mdns"
+	SourceWSD  = "wsd"
+)
+
+// Device 通过组播发现的设备
+type Device struct {
+	IP       net.IP   `json:"ip"`
+	Sources  []string `json:"sources"`  // ssdp/mdns/wsd
+	Type     string   `json:"type"`     // 设备类型, eg: urn:schemas-upnp-org:device:MediaRenderer:1
+	Model    string   `json:"model"`    // 型号
+	Vendor   string   `json:"vendor"`   // 厂商
+	Name     string   `json:"name"`     // 设备名称
+	Server   string   `json:"server"`   // SSDP SERVER 头
+	Location string   `json:"location"` // 描述文件或者服务地址
+	Services []string `json:"services"` // 服务列表
+	Ports    []uint16 `json:"ports"`    // 发现的服务端口
+}
+
+func (d *Device) addSource(s string) {
+	for _, v := range d.Sources {
+		if v == s {
+			return
+		}
+	}
+	d.Sources = append(d.Sources, s)
+}
+
+func (d *Device) addService(s string) {
+	if s == "" {
+		return
+	}
+	for _, v := range d.Services {
+		if v == s {
+			return
+		}
+	}
+	d.Services = append(d.Services, s)
+}
+
+func (d *Device) addPort(p uint16) {
+	if p == 0 {
+		return
+	}
+	for _, v := range d.Ports {
+		if v == p {
+			return
+		}
+	}
+	d.Ports = append(d.Ports, p)
+}
+
+func setIfEmpty(dst *string, v string) {
+	if *dst == "" {
+		*dst = v
+	}
+}
+
+// Option 组播发现参数
+type Option struct {
+	Wait time.Duration // 发送探测后等待响应的时间
+	SSDP bool
+	MDNS bool
+	WSD  bool
+}
+
+// Result 一次组播发现的结果, 按ip合并
+type Result struct {
+	mu      sync.Mutex
+	devices map[string]*Device
+}
+
+func (r *Result) device(ip net.IP) *Device {
+	key := ip.String()
+	d, ok := r.devices[key]
+	if !ok {
+		dup := make(net.IP, len(ip))
+		copy(dup, ip)
+		d = &Device{IP: dup}
+		r.devices[key] = d
+	}
+	return d
+}
+
+// update 在锁内修改ip对应的设备信息
+func (r *Result) update(ip net.IP, fn func(*Device)) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return
+	}
+	r.mu.Lock()
+	fn(r.device(ip4))
+	r.mu.Unlock()
+}
+
+func (r *Result) Devices() []*Device {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	devices := make([]*Device, 0, len(r.devices))
+	for _, d := range r.devices {
+		sort.Slice(d.Ports, func(i, j int) bool { return d.Ports[i] < d.Ports[j] })
+		devices = append(devices, d)
+	}
+	return devices
+}
+
+// Interfaces 可以发送组播的本地网卡以及对应的ipv4地址
+func Interfaces() map[*net.Interface]net.IP {
+	ret := make(map[*net.Interface]net.IP)
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ret
+	}
+	for i := range ifaces {
+		iface := &ifaces[i]
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if n, ok := addr.(*net.IPNet); ok && n.IP.To4() != nil {
+				ret[iface] = n.IP.To4()
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// Sweep 在所有本地网卡上发送 SSDP/mDNS/WS-Discovery 探测, 收集 Wait 时间内的响应
+func Sweep(opt Option) ([]*Device, error) {
+	if opt.Wait <= 0 {
+		opt.Wait = 3 * time.Second
+	}
+
+	ifaces := Interfaces()
+	if len(ifaces) == 0 {
+		return nil, errors.New("no multicast interface")
+	}
+
+	r := &Result{devices: make(map[string]*Device)}
+	var wg sync.WaitGroup
+	run := func(iface *net.Interface, src net.IP, fn func(*net.Interface, net.IP, time.Duration, *Result) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = fn(iface, src, opt.Wait, r)
+		}()
+	}
+
+	for iface, src := range ifaces {
+		if opt.SSDP {
+			run(iface, src, ssdp)
+		}
+		if opt.MDNS {
+			run(iface, src, mdns)
+		}
+		if opt.WSD {
+			run(iface, src, wsd)
+		}
+	}
+	wg.Wait()
+	return r.Devices(), nil
+}
+
+// multicast 从指定网卡发送组播报文, 并在 wait 时间内把收到的响应交给 fn 处理
+func multicast(iface *net.Interface, src net.IP, group *net.UDPAddr, payload [][]byte, wait time.Duration, fn func(from net.IP, data []byte)) error {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: src})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	pc := ipv4.NewPacketConn(conn)
+	if err = pc.SetMulticastInterface(iface); err != nil {
+		return err
+	}
+	_ = pc.SetMulticastTTL(2)
+
+	for _, p := range payload {
+		if _, err = conn.WriteToUDP(p, group); err != nil {
+			return err
+		}
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(wait))
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				return nil
+			}
+			return err
+		}
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		fn(from.IP, data)
+	}
+}
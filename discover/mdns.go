@@ -0,0 +1,108 @@
+package discover
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+const mdnsServices = "_services._dns-sd._udp.local"
+
+// mdns 先枚举服务类型, 再查询每种服务的实例, 通过 SRV/TXT 获取端口和型号
+func mdns(iface *net.Interface, src net.IP, wait time.Duration, r *Result) error {
+	half := wait / 2
+
+	types := make(map[string]bool)
+	query, err := mdnsQuery(mdnsServices)
+	if err != nil {
+		return err
+	}
+	err = multicast(iface, src, mdnsGroup, [][]byte{query}, half, func(from net.IP, data []byte) {
+		for _, rr := range mdnsRecords(data) {
+			if rr.Type == layers.DNSTypePTR && strings.EqualFold(string(rr.Name), mdnsServices) {
+				types[string(rr.PTR)] = true
+			}
+		}
+	})
+	if err != nil || len(types) == 0 {
+		return err
+	}
+
+	names := make([]string, 0, len(types))
+	for t := range types {
+		names = append(names, t)
+	}
+	query, err = mdnsQuery(names...)
+	if err != nil {
+		return err
+	}
+
+	return multicast(iface, src, mdnsGroup, [][]byte{query}, wait-half, func(from net.IP, data []byte) {
+		records := mdnsRecords(data)
+		r.update(from, func(d *Device) {
+			d.addSource(SourceMDNS)
+			for _, rr := range records {
+				switch rr.Type {
+				case layers.DNSTypePTR:
+					if types[string(rr.Name)] {
+						d.addService(strings.TrimSuffix(string(rr.Name), ".local"))
+					}
+				case layers.DNSTypeSRV:
+					d.addPort(rr.SRV.Port)
+					setIfEmpty(&d.Name, strings.TrimSuffix(string(rr.SRV.Name), ".local"))
+				case layers.DNSTypeTXT:
+					mdnsTXT(d, rr.TXTs)
+				}
+			}
+		})
+	})
+}
+
+func mdnsQuery(names ...string) ([]byte, error) {
+	req := layers.DNS{QDCount: uint16(len(names))}
+	for _, name := range names {
+		req.Questions = append(req.Questions, layers.DNSQuestion{
+			Name:  []byte(name),
+			Type:  layers.DNSTypePTR,
+			Class: layers.DNSClassIN,
+		})
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := req.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func mdnsRecords(data []byte) []layers.DNSResourceRecord {
+	var resp layers.DNS
+	if err := resp.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil || !resp.QR {
+		return nil
+	}
+	records := make([]layers.DNSResourceRecord, 0, len(resp.Answers)+len(resp.Additionals))
+	records = append(records, resp.Answers...)
+	return append(records, resp.Additionals...)
+}
+
+// mdnsTXT 从 TXT 记录中提取型号和厂商, eg: md=HP LaserJet, ty=..., usb_MFG=HP
+func mdnsTXT(d *Device, txts [][]byte) {
+	for _, txt := range txts {
+		k, v, ok := strings.Cut(string(txt), "=")
+		if !ok || v == "" {
+			continue
+		}
+		switch strings.ToLower(k) {
+		case "md", "model", "ty", "usb_mdl":
+			setIfEmpty(&d.Model, v)
+		case "usb_mfg", "manufacturer", "vendor":
+			setIfEmpty(&d.Vendor, v)
+		case "fn", "name":
+			setIfEmpty(&d.Name, v)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package discover
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ssdpGroup = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+// ssdpFetchLimit 同时获取描述文件的数量
+const ssdpFetchLimit = 8
+
+const ssdpSearch = "M-SEARCH * HTTP/1.1\r\n" +
+	"HOST: 239.255.255.250:1900\r\n" +
+	"MAN: \"ssdp:discover\"\r\n" +
+	"MX: 2\r\n" +
+	"ST: ssdp:all\r\n\r\n"
+
+// upnpDesc UPnP 设备描述文件
+type upnpDesc struct {
+	Device struct {
+		DeviceType   string `xml:"deviceType"`
+		FriendlyName string `xml:"friendlyName"`
+		Manufacturer string `xml:"manufacturer"`
+		ModelName    string `xml:"modelName"`
+		ModelNumber  string `xml:"modelNumber"`
+		ServiceList  []struct {
+			ServiceType string `xml:"serviceType"`
+		} `xml:"serviceList>service"`
+	} `xml:"device"`
+}
+
+func ssdp(iface *net.Interface, src net.IP, wait time.Duration, r *Result) error {
+	locations := make(map[string]net.IP)
+	err := multicast(iface, src, ssdpGroup, [][]byte{[]byte(ssdpSearch)}, wait, func(from net.IP, data []byte) {
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+		if err != nil {
+			return
+		}
+		resp.Body.Close()
+
+		location := resp.Header.Get("Location")
+		// 只采用响应方自己的描述文件地址, 不访问组播报文中指向其他地址的 URL
+		allowed := descAllowed(location, from)
+		r.update(from, func(d *Device) {
+			d.addSource(SourceSSDP)
+			setIfEmpty(&d.Server, resp.Header.Get("Server"))
+			setIfEmpty(&d.Location, location)
+			d.addService(resp.Header.Get("St"))
+			if allowed {
+				d.addPort(urlPort(location))
+			}
+		})
+		if allowed {
+			locations[location] = from
+		}
+	})
+
+	// 获取描述文件, 补充型号和服务列表, 并发获取且总时间不超过 wait
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	client := &http.Client{
+		Transport: &http.Transport{}, // 不使用环境变量中的代理
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	sem := make(chan struct{}, ssdpFetchLimit)
+	var wg sync.WaitGroup
+	for location, from := range locations {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(location string, from net.IP) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			desc, e := fetchDesc(ctx, client, location)
+			if e != nil {
+				return
+			}
+			r.update(from, func(d *Device) {
+				setIfEmpty(&d.Type, desc.Device.DeviceType)
+				setIfEmpty(&d.Name, desc.Device.FriendlyName)
+				setIfEmpty(&d.Vendor, desc.Device.Manufacturer)
+				model := strings.TrimSpace(desc.Device.ModelName + " " + desc.Device.ModelNumber)
+				setIfEmpty(&d.Model, model)
+				for _, s := range desc.Device.ServiceList {
+					d.addService(s.ServiceType)
+				}
+			})
+		}(location, from)
+	}
+	wg.Wait()
+	return err
+}
+
+// descAllowed 描述文件地址必须是 http(s) 并且主机为响应方的ip
+func descAllowed(location string, from net.IP) bool {
+	u, err := url.Parse(strings.TrimSpace(location))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	ip := net.ParseIP(u.Hostname())
+	return ip != nil && ip.Equal(from)
+}
+
+func fetchDesc(ctx context.Context, client *http.Client, location string) (*upnpDesc, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var desc upnpDesc
+	if err = xml.Unmarshal(body, &desc); err != nil {
+		return nil, err
+	}
+	return &desc, nil
+}
+
+// urlPort 地址中的端口, 没有写明时按协议取默认端口
+func urlPort(raw string) uint16 {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return 0
+	}
+	if p := u.Port(); p != "" {
+		n, _ := strconv.ParseUint(p, 10, 16)
+		return uint16(n)
+	}
+	switch u.Scheme {
+	case "http":
+		return 80
+	case "https":
+		return 443
+	}
+	return 0
+}
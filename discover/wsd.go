@@ -0,0 +1,87 @@
+package discover
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var wsdGroup = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 3702}
+
+const wsdProbe = `<?xml version="1.0" encoding="UTF-8"?>` +
+	`<e:Envelope xmlns:e="http://www.w3.org/2003/05/soap-envelope" ` +
+	`xmlns:w="http://schemas.xmlsoap.org/ws/2004/08/addressing" ` +
+	`xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">` +
+	`<e:Header>` +
+	`<w:MessageID>uuid:%s</w:MessageID>` +
+	`<w:To e:mustUnderstand="true">urn:schemas-xmlsoap-org:ws:2005:04:discovery</w:To>` +
+	`<w:Action e:mustUnderstand="true">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</w:Action>` +
+	`</e:Header>` +
+	`<e:Body><d:Probe/></e:Body>` +
+	`</e:Envelope>`
+
+// wsdMatches WS-Discovery ProbeMatches 响应, 只按 local name 匹配
+type wsdMatches struct {
+	Matches []struct {
+		Types  string `xml:"Types"`
+		Scopes string `xml:"Scopes"`
+		XAddrs string `xml:"XAddrs"`
+	} `xml:"Body>ProbeMatches>ProbeMatch"`
+}
+
+func wsd(iface *net.Interface, src net.IP, wait time.Duration, r *Result) error {
+	probe := []byte(fmt.Sprintf(wsdProbe, uuid.NewString()))
+	return multicast(iface, src, wsdGroup, [][]byte{probe}, wait, func(from net.IP, data []byte) {
+		var m wsdMatches
+		if err := xml.Unmarshal(data, &m); err != nil || len(m.Matches) == 0 {
+			return
+		}
+
+		r.update(from, func(d *Device) {
+			d.addSource(SourceWSD)
+			for _, match := range m.Matches {
+				types := strings.Fields(match.Types)
+				for _, t := range types {
+					d.addService(t)
+				}
+				if len(types) > 0 {
+					setIfEmpty(&d.Type, types[0])
+				}
+
+				for _, addr := range strings.Fields(match.XAddrs) {
+					setIfEmpty(&d.Location, addr)
+					d.addPort(urlPort(addr))
+				}
+				wsdScopes(d, match.Scopes)
+			}
+		})
+	})
+}
+
+// wsdScopes 解析 onvif scope, eg: onvif://www.onvif.org/hardware/DS-2CD2T45
+func wsdScopes(d *Device, scopes string) {
+	for _, scope := range strings.Fields(scopes) {
+		u, err := url.Parse(scope)
+		if err != nil || u.Scheme != "onvif" {
+			continue
+		}
+		k, v, ok := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+		if !ok || v == "" {
+			continue
+		}
+		v, _ = url.PathUnescape(v)
+		switch k {
+		case "hardware":
+			setIfEmpty(&d.Model, v)
+		case "name":
+			setIfEmpty(&d.Name, v)
+		case "mfr", "manufacturer":
+			setIfEmpty(&d.Vendor, v)
+		}
+	}
+}
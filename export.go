@@ -0,0 +1,209 @@
+package radar
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vela-ssoc/vela-radar/host"
+)
+
+// 导出格式
+const (
+	exportNmap  = "nmap"
+	exportCSV   = "csv"
+	exportJSONL = "jsonl"
+	exportHTML  = "html"
+)
+
+func exportContentType(format string) (string, bool) {
+	switch format {
+	case exportNmap:
+		return "application/xml; charset=utf-8", true
+	case exportCSV:
+		return "text/csv; charset=utf-8", true
+	case exportJSONL:
+		return "application/x-ndjson", true
+	case exportHTML:
+		return "text/html; charset=utf-8", true
+	}
+	return "", false
+}
+
+// exportFormat 统一格式名称, xml 等同于 nmap
+func exportFormat(format string) string {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "xml":
+		return exportNmap
+	case "json", "ndjson":
+		return exportJSONL
+	case "htm":
+		return exportHTML
+	}
+	return format
+}
+
+// exportHost 按ip汇总的服务以及主机维度结果
+type exportHost struct {
+	IP       net.IP
+	Names    []host.Name
+	Host     *Host // 开启 state/trace/names 时才有
+	Services []*Service
+}
+
+func (eh *exportHost) name() string {
+	if len(eh.Names) == 0 {
+		return ""
+	}
+	return eh.Names[0].Name
+}
+
+type exportData struct {
+	task     *Task
+	hosts    []*exportHost
+	services []*Service
+	dropped  int
+}
+
+func (t *Task) exportData() *exportData {
+	services, hosts, dropped := t.results.Snapshot()
+
+	index := make(map[string]*exportHost)
+	get := func(ip net.IP) *exportHost {
+		key := ip.String()
+		eh, ok := index[key]
+		if !ok {
+			eh = &exportHost{IP: ip}
+			index[key] = eh
+		}
+		return eh
+	}
+
+	for _, h := range hosts {
+		eh := get(h.IP)
+		eh.Host = h
+		if len(h.Names) > 0 {
+			eh.Names = h.Names
+		}
+	}
+	for _, s := range services {
+		eh := get(s.IP)
+		eh.Services = append(eh.Services, s)
+		if len(eh.Names) == 0 && len(s.Names) > 0 {
+			eh.Names = s.Names
+		}
+	}
+
+	data := &exportData{task: t, dropped: dropped}
+	for _, eh := range index {
+		sort.Slice(eh.Services, func(i, j int) bool { return eh.Services[i].Port < eh.Services[j].Port })
+		data.hosts = append(data.hosts, eh)
+	}
+	sort.Slice(data.hosts, func(i, j int) bool {
+		return bytes.Compare(data.hosts[i].IP.To16(), data.hosts[j].IP.To16()) < 0
+	})
+	for _, eh := range data.hosts {
+		data.services = append(data.services, eh.Services...)
+	}
+	return data
+}
+
+// Export 按格式输出任务结果
+func (t *Task) Export(w io.Writer, format string) error {
+	data := t.exportData()
+	switch exportFormat(format) {
+	case exportNmap:
+		return data.nmap(w)
+	case exportCSV:
+		return data.csv(w)
+	case exportJSONL:
+		return data.jsonl(w)
+	case exportHTML:
+		return data.html(w)
+	default:
+		return fmt.Errorf("export format %q not support, use nmap/csv/jsonl/html", format)
+	}
+}
+
+// ExportFile 输出到文件, 先写临时文件再改名
+func (t *Task) ExportFile(format string, path string) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := t.Export(&buf, format); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (data *exportData) jsonl(w io.Writer) error {
+	for _, s := range data.services {
+		if _, err := w.Write(append(s.Bytes(), '\n')); err != nil {
+			return err
+		}
+	}
+	for _, eh := range data.hosts {
+		if eh.Host == nil {
+			continue
+		}
+		if _, err := w.Write(append(eh.Host.Bytes(), '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvSafe 以 = + - @ 以及制表符、回车开头的单元格加上单引号, 防止表格软件把扫描到的 title/banner 当作公式执行
+func csvSafe(row []string) []string {
+	for i, cell := range row {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			row[i] = "'" + cell
+		}
+	}
+	return row
+}
+
+func (data *exportData) csv(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"ip", "hostname", "port", "transport", "protocol", "tls", "version", "component",
+		"title", "status_code", "url", "server", "fingerprints", "screenshot_url", "asset_id", "comment", "task_id"})
+	if err != nil {
+		return err
+	}
+
+	for _, eh := range data.hosts {
+		for _, s := range eh.Services {
+			var title, code, url, server, fingerprints, screenshot string
+			if hi := s.HTTPInfo; hi != nil {
+				title, url, server, screenshot = hi.Title, hi.URL, hi.Server, hi.ScreenshotURL
+				code = strconv.Itoa(hi.StatusCode)
+				fingerprints = strings.Join(hi.Fingerprints, ";")
+			}
+			err = cw.Write(csvSafe([]string{
+				s.IP.String(), eh.name(), strconv.Itoa(int(s.Port)), s.Transport, s.Protocol,
+				strconv.FormatBool(s.TLS), s.Version, strings.Join(s.Component, ";"),
+				title, code, url, server, fingerprints, screenshot, s.AssetId, s.Comment, s.TaskId,
+			}))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,303 @@
+package radar
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vela-ssoc/vela-radar/util"
+)
+
+// html 报告: 单个文件, 内联样式和 SVG 图表, 截图以 data URI 内嵌, 离线打开也能看到
+
+const (
+	htmlBarRow   = 20  // 每行高度
+	htmlBarWidth = 230 // 最大值对应的宽度
+
+	htmlShotLimit   = 2 << 20 // 单张截图最大字节数
+	htmlShotTimeout = 10 * time.Second
+	htmlShotWorker  = 8
+)
+
+type htmlBar struct {
+	Label string
+	Count int
+	Y     int
+	Width int
+}
+
+type htmlChart struct {
+	Title  string
+	Height int
+	Bars   []htmlBar
+}
+
+type htmlReport struct {
+	Name      string
+	Id        string
+	Target    string
+	Port      string
+	Mode      string
+	Status    string
+	Start     string
+	End       string
+	Elapsed   string
+	Generated string
+	Hosts     int
+	Services  int
+	Web       int
+	Dropped   int
+	Flagged   int
+	Charts    []htmlChart
+	Rows      []*exportHost
+	Shots     []htmlShot
+}
+
+// htmlShot 截图, Data 为空表示获取失败, 只保留原始地址
+type htmlShot struct {
+	*Service
+	Data template.URL
+}
+
+// topN 按数量倒序取前 n 项
+func topN(title string, counts map[string]int, n int) htmlChart {
+	chart := htmlChart{Title: title}
+	for label, count := range counts {
+		if count <= 0 {
+			continue
+		}
+		chart.Bars = append(chart.Bars, htmlBar{Label: label, Count: count})
+	}
+	sort.Slice(chart.Bars, func(i, j int) bool {
+		if chart.Bars[i].Count == chart.Bars[j].Count {
+			return chart.Bars[i].Label < chart.Bars[j].Label
+		}
+		return chart.Bars[i].Count > chart.Bars[j].Count
+	})
+	if len(chart.Bars) > n {
+		chart.Bars = chart.Bars[:n]
+	}
+	for i := range chart.Bars {
+		chart.Bars[i].Y = i * htmlBarRow
+		chart.Bars[i].Width = chart.Bars[i].Count * htmlBarWidth / chart.Bars[0].Count
+		if chart.Bars[i].Width == 0 {
+			chart.Bars[i].Width = 1
+		}
+	}
+	chart.Height = len(chart.Bars) * htmlBarRow
+	return chart
+}
+
+func (data *exportData) html(w io.Writer) error {
+	t := data.task
+
+	end := t.End_time
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	r := htmlReport{
+		Name:      t.Name,
+		Id:        t.Id,
+		Target:    t.Option.Target,
+		Port:      t.Option.Port,
+		Mode:      t.Option.Mode,
+		Status:    t.Status.Detail(),
+		Start:     t.Start_time.Format("2006-01-02 15:04:05"),
+		Elapsed:   end.Sub(t.Start_time).Round(time.Second).String(),
+		Generated: time.Now().Format("2006-01-02 15:04:05"),
+		Hosts:     len(data.hosts),
+		Services:  len(data.services),
+		Dropped:   data.dropped,
+		Rows:      data.hosts,
+	}
+	if !t.End_time.IsZero() {
+		r.End = t.End_time.Format("2006-01-02 15:04:05")
+	}
+
+	protocols := make(map[string]int)
+	ports := make(map[string]int)
+	codes := make(map[string]int)
+	hosts := make(map[string]int)
+	for _, eh := range data.hosts {
+		hosts[eh.IP.String()] = len(eh.Services)
+		if eh.Host != nil && eh.Host.Anomaly != "" {
+			r.Flagged++
+		}
+		for _, s := range eh.Services {
+			protocols[s.Protocol]++
+			ports[strconv.Itoa(int(s.Port))]++
+			if s.HTTPInfo == nil {
+				continue
+			}
+			r.Web++
+			codes[strconv.Itoa(s.HTTPInfo.StatusCode)]++
+			if s.HTTPInfo.ScreenshotURL != "" {
+				r.Shots = append(r.Shots, htmlShot{Service: s})
+			}
+		}
+	}
+	r.Charts = []htmlChart{
+		topN("协议", protocols, 10),
+		topN("端口", ports, 10),
+		topN("开放端口最多的主机", hosts, 10),
+	}
+	if len(codes) > 0 {
+		r.Charts = append(r.Charts, topN("HTTP 状态码", codes, 10))
+	}
+
+	data.embedShots(r.Shots)
+	return htmlTemplate.Execute(w, r)
+}
+
+// embedShots 读取截图内容转为 data URI, 优先读取本地保存的文件, 其次从 minio 下载
+func (data *exportData) embedShots(shots []htmlShot) {
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, htmlShotWorker)
+	for i := range shots {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(shot *htmlShot) {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+			buf, err := data.readShot(shot.HTTPInfo.ScreenshotURL)
+			if err != nil {
+				xEnv.Errorf("task %s export screenshot %s fail %v", data.task.Id, shot.HTTPInfo.ScreenshotURL, err)
+				return
+			}
+			mime := http.DetectContentType(buf)
+			shot.Data = template.URL("data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(buf))
+		}(&shots[i])
+	}
+	wg.Wait()
+}
+
+func (data *exportData) readShot(url string) ([]byte, error) {
+	rad := data.task.rad
+	if rad.screen != nil {
+		cfg := rad.screen.Cfg
+		if name := util.MinioObjectName(cfg.Miniocfg, url); name != "" {
+			if cfg.Save {
+				if buf, err := os.ReadFile(filepath.Join(cfg.ResultDir, name)); err == nil && len(buf) <= htmlShotLimit {
+					return buf, nil
+				}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), htmlShotTimeout)
+			defer cancel()
+			return util.DownloadFromMinio(ctx, cfg.Miniocfg, name, htmlShotLimit)
+		}
+	}
+
+	// 不是当前配置上传的地址, 直接下载
+	ctx, cancel := context.WithTimeout(context.Background(), htmlShotTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, htmlShotLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) > htmlShotLimit {
+		return nil, fmt.Errorf("larger than %d bytes", htmlShotLimit)
+	}
+	return buf, nil
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>vela-radar 扫描报告 {{.Name}} {{.Id}}</title>
+<style>
+body{font-family:-apple-system,"Segoe UI","PingFang SC","Microsoft YaHei",sans-serif;margin:0;background:#f4f6f8;color:#222}
+header{background:#1f2d3d;color:#fff;padding:20px 32px}
+header h1{margin:0 0 6px;font-size:22px}
+header p{margin:0;color:#c0ccda;font-size:13px}
+main{padding:24px 32px}
+.cards{display:flex;gap:16px;flex-wrap:wrap;margin-bottom:24px}
+.card{background:#fff;border-radius:6px;padding:16px 20px;min-width:140px;box-shadow:0 1px 2px rgba(0,0,0,.08)}
+.card b{display:block;font-size:26px}
+.card span{color:#8492a6;font-size:12px}
+.charts{display:grid;grid-template-columns:repeat(auto-fill,minmax(360px,1fr));gap:16px;margin-bottom:24px}
+.chart{background:#fff;border-radius:6px;padding:16px;box-shadow:0 1px 2px rgba(0,0,0,.08)}
+.chart h3{margin:0 0 10px;font-size:14px}
+.chart text{font-size:11px;fill:#475669}
+table{width:100%;border-collapse:collapse;background:#fff;font-size:13px;margin-bottom:24px}
+th,td{border-bottom:1px solid #e5e9f2;padding:6px 8px;text-align:left;vertical-align:top}
+th{background:#eff2f7}
+.ip{font-weight:bold;white-space:nowrap}
+.warn{color:#e6a23c}
+.muted{color:#8492a6}
+.shots{display:grid;grid-template-columns:repeat(auto-fill,minmax(260px,1fr));gap:16px}
+.shot{background:#fff;border-radius:6px;padding:8px;box-shadow:0 1px 2px rgba(0,0,0,.08);font-size:12px;word-break:break-all}
+.shot img{width:100%;border:1px solid #e5e9f2}
+</style>
+</head>
+<body>
+<header>
+<h1>vela-radar 扫描报告</h1>
+<p>任务 {{.Name}} ({{.Id}}) &middot; 状态 {{.Status}} &middot; 模式 {{.Mode}} &middot; 端口 {{.Port}}</p>
+<p>开始 {{.Start}}{{if .End}} &middot; 结束 {{.End}}{{end}} &middot; 耗时 {{.Elapsed}} &middot; 生成于 {{.Generated}}</p>
+<p>目标 {{.Target}}</p>
+</header>
+<main>
+<div class="cards">
+<div class="card"><b>{{.Hosts}}</b><span>主机</span></div>
+<div class="card"><b>{{.Services}}</b><span>服务</span></div>
+<div class="card"><b>{{.Web}}</b><span>Web 服务</span></div>
+<div class="card"><b>{{len .Shots}}</b><span>截图</span></div>
+{{if .Flagged}}<div class="card"><b class="warn">{{.Flagged}}</b><span>tarpit/蜜罐主机</span></div>{{end}}
+{{if .Dropped}}<div class="card"><b class="warn">{{.Dropped}}</b><span>超过上限未保留的服务</span></div>{{end}}
+</div>
+
+<div class="charts">
+{{range .Charts}}{{if .Bars}}<div class="chart"><h3>{{.Title}}</h3>
+<svg width="100%" viewBox="0 0 400 {{.Height}}">
+{{range .Bars}}<g transform="translate(0,{{.Y}})"><text x="0" y="14">{{.Label}}</text><rect x="110" y="4" height="12" width="{{.Width}}" fill="#409eff"></rect><text x="400" y="14" text-anchor="end">{{.Count}}</text></g>
+{{end}}</svg></div>{{end}}{{end}}
+</div>
+
+<table>
+<thead><tr><th>主机</th><th>端口</th><th>协议</th><th>版本/组件</th><th>Web</th><th>备注</th></tr></thead>
+<tbody>
+{{range .Rows}}{{$h := .}}{{range $i, $s := .Services}}<tr>
+{{if eq $i 0}}<td class="ip" rowspan="{{len $h.Services}}">{{$h.IP}}{{range $h.Names}}<div class="muted">{{.Name}}</div>{{end}}{{if $h.Host}}{{if $h.Host.Anomaly}}<div class="warn">{{$h.Host.Anomaly}}</div>{{end}}{{end}}</td>{{end}}
+<td>{{$s.Port}}/{{$s.Transport}}</td>
+<td>{{$s.Protocol}}{{if $s.TLS}} (tls){{end}}</td>
+<td>{{$s.Version}}{{range $s.Component}} <span class="muted">{{.}}</span>{{end}}</td>
+<td>{{with $s.HTTPInfo}}<a href="{{.URL}}">{{.URL}}</a> [{{.StatusCode}}] {{.Title}}{{range .Fingerprints}} <span class="muted">{{.}}</span>{{end}}{{end}}</td>
+<td>{{$s.Comment}}</td>
+</tr>
+{{end}}{{end}}
+</tbody>
+</table>
+
+{{if .Shots}}<h2>截图</h2>
+<div class="shots">
+{{range .Shots}}<div class="shot">{{if .Data}}<img src="{{.Data}}" alt="{{.HTTPInfo.URL}}">{{else}}<div class="muted">截图获取失败: {{.HTTPInfo.ScreenshotURL}}</div>{{end}}<div>{{.HTTPInfo.URL}}</div><div class="muted">{{.HTTPInfo.Title}}</div></div>
+{{end}}</div>{{end}}
+</main>
+</body>
+</html>
+`))
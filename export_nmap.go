@@ -0,0 +1,298 @@
+package radar
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/vela-ssoc/vela-radar/port"
+)
+
+// Nmap XML 输出, 字段参考 nmap.dtd, 可以被 ndiff/metasploit 等工具导入
+
+type nmapRun struct {
+	XMLName          xml.Name     `xml:"nmaprun"`
+	Scanner          string       `xml:"scanner,attr"`
+	Args             string       `xml:"args,attr"`
+	Start            int64        `xml:"start,attr"`
+	StartStr         string       `xml:"startstr,attr"`
+	Version          string       `xml:"version,attr"`
+	XMLOutputVersion string       `xml:"xmloutputversion,attr"`
+	ScanInfo         nmapScanInfo `xml:"scaninfo"`
+	Hosts            []nmapHost   `xml:"host"`
+	RunStats         nmapRunStats `xml:"runstats"`
+	Comment          string       `xml:",comment"`
+}
+
+type nmapScanInfo struct {
+	Type        string `xml:"type,attr"`
+	Protocol    string `xml:"protocol,attr"`
+	NumServices int    `xml:"numservices,attr"`
+	Services    string `xml:"services,attr"`
+}
+
+type nmapHost struct {
+	StartTime int64          `xml:"starttime,attr,omitempty"`
+	EndTime   int64          `xml:"endtime,attr,omitempty"`
+	Status    nmapStatus     `xml:"status"`
+	Address   []nmapAddress  `xml:"address"`
+	Hostnames []nmapHostname `xml:"hostnames>hostname"`
+	Ports     nmapPorts      `xml:"ports"`
+	Comment   string         `xml:",comment"`
+}
+
+type nmapStatus struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+type nmapAddress struct {
+	Addr     string `xml:"addr,attr"`
+	AddrType string `xml:"addrtype,attr"`
+	Vendor   string `xml:"vendor,attr,omitempty"`
+}
+
+type nmapHostname struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type nmapPorts struct {
+	ExtraPorts []nmapExtraPorts `xml:"extraports"`
+	Ports      []nmapPort       `xml:"port"`
+}
+
+type nmapExtraPorts struct {
+	State string `xml:"state,attr"`
+	Count int    `xml:"count,attr"`
+}
+
+type nmapPort struct {
+	Protocol string       `xml:"protocol,attr"`
+	PortId   uint16       `xml:"portid,attr"`
+	State    nmapState    `xml:"state"`
+	Service  *nmapService `xml:"service"`
+}
+
+type nmapState struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+type nmapService struct {
+	Name      string `xml:"name,attr"`
+	Product   string `xml:"product,attr,omitempty"`
+	Version   string `xml:"version,attr,omitempty"`
+	ExtraInfo string `xml:"extrainfo,attr,omitempty"`
+	Tunnel    string `xml:"tunnel,attr,omitempty"`
+	Method    string `xml:"method,attr"`
+	Conf      int    `xml:"conf,attr"`
+}
+
+type nmapRunStats struct {
+	Finished nmapFinished  `xml:"finished"`
+	Hosts    nmapHostStats `xml:"hosts"`
+}
+
+type nmapFinished struct {
+	Time    int64   `xml:"time,attr"`
+	TimeStr string  `xml:"timestr,attr"`
+	Elapsed float64 `xml:"elapsed,attr"`
+	Summary string  `xml:"summary,attr"`
+	Exit    string  `xml:"exit,attr"`
+}
+
+type nmapHostStats struct {
+	Up    int `xml:"up,attr"`
+	Down  int `xml:"down,attr"`
+	Total int `xml:"total,attr"`
+}
+
+// nmapServiceName nmap 中 https 等表示为 http + tunnel=ssl
+func nmapServiceName(s *Service) (string, string) {
+	name := strings.ToLower(s.Protocol)
+	if !s.TLS {
+		return name, ""
+	}
+	switch name {
+	case "https":
+		return "http", "ssl"
+	case "imaps", "pop3s", "smtps", "ldaps", "ftps":
+		return strings.TrimSuffix(name, "s"), "ssl"
+	}
+	return name, "ssl"
+}
+
+// nmapComment xml 注释中不能出现 "--"
+func nmapComment(s string) string {
+	return " " + strings.ReplaceAll(s, "--", "- -") + " "
+}
+
+func (data *exportData) nmapHost(eh *exportHost) nmapHost {
+	t := data.task
+	nh := nmapHost{
+		StartTime: t.Start_time.Unix(),
+		Status:    nmapStatus{State: "up", Reason: "user-set"},
+	}
+	if !t.End_time.IsZero() {
+		nh.EndTime = t.End_time.Unix()
+	}
+	if t.Option.Ping {
+		nh.Status.Reason = "echo-reply"
+	}
+
+	addrType := "ipv4"
+	if eh.IP.To4() == nil {
+		addrType = "ipv6"
+	}
+	nh.Address = append(nh.Address, nmapAddress{Addr: eh.IP.String(), AddrType: addrType})
+	for _, s := range eh.Services {
+		if s.Device != nil && s.Device.Vendor != "" {
+			nh.Address[0].Vendor = s.Device.Vendor
+			break
+		}
+	}
+
+	for _, n := range eh.Names {
+		typ := "user"
+		if n.Source == "ptr" {
+			typ = "PTR"
+		}
+		nh.Hostnames = append(nh.Hostnames, nmapHostname{Name: n.Name, Type: typ})
+	}
+
+	reason := "syn-ack"
+	listed := make(map[uint16]bool)
+	for _, s := range eh.Services {
+		transport := s.Transport
+		if transport == "" {
+			transport = "tcp"
+		}
+		if transport == "udp" {
+			reason = "udp-response"
+		}
+
+		name, tunnel := nmapServiceName(s)
+		ns := &nmapService{Name: name, Version: s.Version, Tunnel: tunnel, Method: "probed", Conf: 10}
+		if s.Protocol == "" || s.Protocol == "unknown" {
+			ns.Name, ns.Method, ns.Conf = "unknown", "table", 3
+		}
+		if s.HTTPInfo != nil {
+			ns.Product = s.HTTPInfo.Server
+			ns.ExtraInfo = s.HTTPInfo.Title
+		}
+		if len(s.Component) > 0 && ns.Product == "" {
+			ns.Product = strings.Join(s.Component, ", ")
+		}
+
+		listed[s.Port] = true
+		nh.Ports.Ports = append(nh.Ports.Ports, nmapPort{
+			Protocol: transport,
+			PortId:   s.Port,
+			State:    nmapState{State: "open", Reason: reason},
+			Service:  ns,
+		})
+		if s.Comment != "" {
+			nh.Comment = nmapComment(s.Comment)
+		}
+	}
+
+	// 开启端口状态时输出指定端口的 closed/filtered 以及其余端口的统计
+	if h := eh.Host; h != nil && h.hasState {
+		closed, filtered := int(h.Closed), int(h.Filtered)
+		for _, ps := range h.Ports {
+			if listed[ps.Port] || ps.State == port.Open.String() {
+				continue
+			}
+			r := "reset"
+			if ps.State == port.Filtered.String() {
+				r = "no-response"
+				filtered--
+			} else {
+				closed--
+			}
+			nh.Ports.Ports = append(nh.Ports.Ports, nmapPort{
+				Protocol: "tcp",
+				PortId:   ps.Port,
+				State:    nmapState{State: ps.State, Reason: r},
+			})
+		}
+		if closed > 0 {
+			nh.Ports.ExtraPorts = append(nh.Ports.ExtraPorts, nmapExtraPorts{State: "closed", Count: closed})
+		}
+		if filtered > 0 {
+			nh.Ports.ExtraPorts = append(nh.Ports.ExtraPorts, nmapExtraPorts{State: "filtered", Count: filtered})
+		}
+	}
+	if h := eh.Host; h != nil && h.Anomaly != "" {
+		nh.Comment = nmapComment(h.Anomaly)
+	}
+	return nh
+}
+
+func (data *exportData) nmap(w io.Writer) error {
+	t := data.task
+
+	scanType := "connect"
+	if t.Option.Mode == "syn" {
+		scanType = "syn"
+	}
+
+	end := t.End_time
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	run := nmapRun{
+		Scanner:          "vela-radar",
+		Args:             fmt.Sprintf("vela-radar -mode %s -p %s %s", t.Option.Mode, t.Option.Port, t.Option.Target),
+		Start:            t.Start_time.Unix(),
+		StartStr:         t.Start_time.Format(time.ANSIC),
+		Version:          "0.5.4",
+		XMLOutputVersion: "1.05",
+		ScanInfo: nmapScanInfo{
+			Type:     scanType,
+			Protocol: "tcp",
+			Services: t.Option.Port,
+		},
+	}
+	if ports, err := port.ShuffleParseAndMergeTopPorts(t.Option.Port); err == nil {
+		run.ScanInfo.NumServices = len(ports)
+	}
+
+	for _, eh := range data.hosts {
+		run.Hosts = append(run.Hosts, data.nmapHost(eh))
+	}
+
+	status := "success"
+	if t.Status == Task_Status_Error {
+		status = "error"
+	}
+	run.RunStats = nmapRunStats{
+		Finished: nmapFinished{
+			Time:    end.Unix(),
+			TimeStr: end.Format(time.ANSIC),
+			Elapsed: end.Sub(t.Start_time).Seconds(),
+			Summary: fmt.Sprintf("vela-radar done at %s; %d IP addresses (%d hosts up) scanned in %.2f seconds",
+				end.Format(time.ANSIC), len(data.hosts), len(data.hosts), end.Sub(t.Start_time).Seconds()),
+			Exit: status,
+		},
+		Hosts: nmapHostStats{Up: len(data.hosts), Total: len(data.hosts)},
+	}
+	if data.dropped > 0 {
+		run.Comment = fmt.Sprintf(" result truncated, %d services dropped ", data.dropped)
+	}
+
+	if _, err := io.WriteString(w, xml.Header+"<!DOCTYPE nmaprun>\n"); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(run); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,137 @@
+package radar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+	"github.com/vela-ssoc/vela-radar/rule"
+	"github.com/vela-ssoc/vela-radar/util"
+)
+
+// filterStats 任务中被过滤规则处理的结果数量
+type filterStats struct {
+	mu      sync.Mutex
+	Dropped uint64            `json:"dropped"`
+	Tagged  uint64            `json:"tagged"`
+	Routed  uint64            `json:"routed"`
+	Rules   map[string]uint64 `json:"rules"` // 每条规则在本任务中的命中次数
+}
+
+func newFilterStats() *filterStats {
+	return &filterStats{Rules: make(map[string]uint64)}
+}
+
+func (fs *filterStats) Add(v *rule.Verdict) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, name := range v.Tagged {
+		fs.Rules[name]++
+	}
+	if len(v.Tags) > 0 {
+		fs.Tagged++
+	}
+	switch v.Action {
+	case rule.ActionDrop:
+		fs.Dropped++
+	case rule.ActionRoute:
+		fs.Routed++
+	default:
+		return
+	}
+	fs.Rules[v.Rule]++
+}
+
+func (fs *filterStats) Bytes() []byte {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return util.ToJsonBytes(fs)
+}
+
+// filter 按规则处理一条结果, 没有规则或者没有命中时返回 nil
+func (rad *Radar) filter(t *Task, kind string, body []byte) *rule.Verdict {
+	if rad.rules.Len() == 0 {
+		return nil
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		xEnv.Errorf("radar filter decode fail %v", err)
+		return nil
+	}
+
+	v := rad.rules.Eval(kind, doc)
+	if v != nil {
+		t.filters.Add(v)
+	}
+	return v
+}
+
+func (rad *Radar) FilterPath() string {
+	return "/api/v1/arr/agent/radar/filter"
+}
+
+func (rad *Radar) FilterDeletePath() string {
+	return "/api/v1/arr/agent/radar/filter/delete"
+}
+
+// FilterListHandle 规则列表以及命中次数
+func (rad *Radar) FilterListHandle(ctx *fasthttp.RequestCtx) error {
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.SetBody(util.ToJsonBytes(rad.rules.List()))
+	return nil
+}
+
+// FilterPutHandle 添加规则, 同名规则被替换
+// eg: {"name": "printer", "expr": "port in 9100,515", "action": "tag", "tag": "printer"}
+func (rad *Radar) FilterPutHandle(ctx *fasthttp.RequestCtx) error {
+	var r rule.Rule
+	if err := json.Unmarshal(ctx.PostBody(), &r); err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return err
+	}
+	if err := rad.putRule(r); err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return err
+	}
+	ctx.Response.SetBody([]byte("ok"))
+	return nil
+}
+
+// putRule 添加规则, 命中次数从0开始, route 的 sink 必须是已经配置的输出, 否则匹配的结果会全部丢失
+func (rad *Radar) putRule(r rule.Rule) error {
+	r.Hits = 0
+	if r.Sink != "" {
+		found := false
+		reporters, _ := rad.outputs()
+		for _, rp := range reporters {
+			if rp.Name() == r.Sink {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("filter rule %s sink %s not found", r.Name, r.Sink)
+		}
+	}
+	return rad.rules.Put(r)
+}
+
+// FilterDeleteHandle 按名称删除规则 eg: {"name": "printer"}
+func (rad *Radar) FilterDeleteHandle(ctx *fasthttp.RequestCtx) error {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return err
+	}
+	if !rad.rules.Remove(req.Name) {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		return errors.New("filter rule not found")
+	}
+	ctx.Response.SetBody([]byte("ok"))
+	return nil
+}
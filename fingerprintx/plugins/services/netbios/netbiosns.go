@@ -33,10 +33,27 @@ func init() {
 }
 
 func (p *Plugin) Run(conn net.Conn, timeout time.Duration, target plugins.Target) (*plugins.Service, error) {
+	name, err := QueryName(conn, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	payload := plugins.ServiceNetbios{
+		NetBIOSName: name,
+	}
+	return plugins.CreateServiceFrom(target, payload, false, "", plugins.UDP), nil
+}
+
+// QueryName sends a NetBIOS node status request over conn and returns the
+// first name of the answer, an empty name means the response was not usable.
+func QueryName(conn net.Conn, timeout time.Duration) (string, error) {
 	transactionID := make([]byte, 2)
 	_, err := rand.Read(transactionID)
 	if err != nil {
-		return nil, &utils.RandomizeError{Message: "Transaction ID"}
+		return "", &utils.RandomizeError{Message: "Transaction ID"}
 	}
 	InitialConnectionPackage := append(transactionID, []byte{ //nolint:gocritic
 		// Transaction ID
@@ -51,22 +68,19 @@ func (p *Plugin) Run(conn net.Conn, timeout time.Duration, target plugins.Target
 
 	response, err := utils.SendRecv(conn, InitialConnectionPackage, timeout)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	if len(response) == 0 {
-		return nil, nil
+		return "", nil
 	}
 
 	stringBegin := strings.Index(string(response), "\x00\x00\x00\x00\x00") + 7
 	stringEnd := strings.Index(string(response), "\x20\x20\x20")
 	if stringBegin == -1 || stringEnd == -1 || stringEnd < stringBegin ||
 		stringBegin >= len(response) || stringEnd >= len(response) {
-		return nil, nil
-	}
-	payload := plugins.ServiceNetbios{
-		NetBIOSName: string(response[stringBegin:stringEnd]),
+		return "", nil
 	}
-	return plugins.CreateServiceFrom(target, payload, false, "", plugins.UDP), nil
+	return string(response[stringBegin:stringEnd]), nil
 }
 
 func (p *Plugin) PortPriority(i uint16) bool {
@@ -0,0 +1,72 @@
+package scan
+
+import (
+	"time"
+
+	"github.com/vela-ssoc/vela-radar/fingerprintx/plugins"
+	utils "github.com/vela-ssoc/vela-radar/fingerprintx/plugins/pluginutils"
+)
+
+const (
+	BannerPassive = "passive"
+	BannerGeneric = "generic"
+)
+
+// GenericProbe is sent to services that stay silent after the connection is
+// established, most line based protocols answer it with an error or a prompt.
+var GenericProbe = []byte("\r\n\r\n")
+
+type Banner struct {
+	Raw     []byte
+	Probe   string        // passive or generic, empty when nothing was received
+	Elapsed time.Duration // time until the service answered (or the connect time if it never did)
+}
+
+// PassiveBanner connects and waits for the service to talk on its own,
+// nothing is written to the connection.
+func PassiveBanner(target plugins.Target, timeout time.Duration) (*Banner, error) {
+	b := &Banner{}
+	start := time.Now()
+	conn, err := DialTCP(target.Address.Addr().String(), target.Address.Port())
+	if err != nil {
+		return nil, err
+	}
+	b.Elapsed = time.Since(start)
+
+	start = time.Now()
+	raw, err := utils.Recv(conn, timeout)
+	conn.Close()
+	if err == nil && len(raw) > 0 {
+		b.Raw = raw
+		b.Probe = BannerPassive
+		b.Elapsed = time.Since(start)
+	}
+	return b, nil
+}
+
+// GrabBanner first waits for the service to talk on its own and, if it does
+// not, sends GenericProbe on a fresh connection and reads the reply.
+func GrabBanner(target plugins.Target, timeout time.Duration) (*Banner, error) {
+	ip := target.Address.Addr().String()
+	port := target.Address.Port()
+
+	b, err := PassiveBanner(target, timeout)
+	if err != nil || b.Probe != "" {
+		return b, err
+	}
+
+	conn, err := DialTCP(ip, port)
+	if err != nil {
+		return b, nil
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	raw, err := utils.SendRecv(conn, GenericProbe, timeout)
+	if err == nil && len(raw) > 0 {
+		b.Raw = raw
+		b.Probe = BannerGeneric
+		b.Elapsed = time.Since(start)
+	}
+	return b, nil
+}
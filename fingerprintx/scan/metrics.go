@@ -0,0 +1,12 @@
+package scan
+
+import "github.com/vela-ssoc/vela-radar/metrics"
+
+var (
+	metricPluginSeconds = metrics.NewHistogram("radar_fingerprint_plugin_seconds",
+		"Duration of a single fingerprint plugin run.", nil, "plugin")
+	metricPluginRuns = metrics.NewCounter("radar_fingerprint_plugin_runs_total",
+		"Fingerprint plugin runs by result (match, miss, error).", "plugin", "result")
+	metricTargetSeconds = metrics.NewHistogram("radar_fingerprint_target_seconds",
+		"Duration of fingerprinting one open port, all plugins included.", nil, "result")
+)
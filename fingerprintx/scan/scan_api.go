@@ -43,6 +43,15 @@ func Do(target plugins.Target, config Config) (*plugins.Service, error) {
 	return config.SimpleScanTarget(target)
 }
 
+// DoTrace works like Do but also returns the ids of the plugins that were
+// tried against the target, whether one of them matched or not.
+func DoTrace(target plugins.Target, config Config) (*plugins.Service, []string, error) {
+	var tried []string
+	config.tried = &tried
+	srv, err := Do(target, config)
+	return srv, tried, err
+}
+
 // ScanTargets fingerprints service(s) running given a list of targets.
 func ScanTargets(targets []plugins.Target, config Config) ([]plugins.Service, error) {
 	var results []plugins.Service
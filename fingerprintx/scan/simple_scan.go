@@ -110,13 +110,29 @@ func (c *Config) UDPScanTarget(target plugins.Target) (*plugins.Service, error)
 	return nil, nil
 }
 
+// SimpleScanTarget fingerprints the target and records the duration and
+// whether a plugin identified the service.
+func (c *Config) SimpleScanTarget(target plugins.Target) (*plugins.Service, error) {
+	start := time.Now()
+	result, err := c.simpleScanTarget(target)
+
+	label := "identified"
+	if err != nil {
+		label = "error"
+	} else if result == nil {
+		label = "unknown"
+	}
+	metricTargetSeconds.With(label).ObserveSince(start)
+	return result, err
+}
+
 // simpleScanTarget attempts to identify the service that is running on a given
 // port. The fingerprinter supports two modes of operation referred to as the
 // fast lane and slow lane. The fast lane aims to be as fast as possible and
 // only attempts to fingerprint services by mapping them to their default port.
 // The slow lane isn't as focused on performance and instead tries to be as
 // accurate as possible.
-func (c *Config) SimpleScanTarget(target plugins.Target) (*plugins.Service, error) {
+func (c *Config) simpleScanTarget(target plugins.Target) (*plugins.Service, error) {
 	ip := target.Address.Addr().String()
 	port := target.Address.Port()
 
@@ -216,7 +232,22 @@ func simplePluginRunner(
 		)
 	}
 
+	id := plugins.CreatePluginID(plugin).String()
+	if config.tried != nil {
+		*config.tried = append(*config.tried, id)
+	}
+
+	start := time.Now()
 	result, err := plugin.Run(conn, config.DefaultTimeout, target)
+	metricPluginSeconds.With(id).ObserveSince(start)
+	switch {
+	case err != nil:
+		metricPluginRuns.With(id, "error").Inc()
+	case result != nil:
+		metricPluginRuns.With(id, "match").Inc()
+	default:
+		metricPluginRuns.With(id, "miss").Inc()
+	}
 
 	// Log probe completion.
 	if config.Verbose {
@@ -30,4 +30,7 @@ type Config struct {
 
 	// Prints logging messages to stderr
 	Verbose bool
+
+	// collects the ids of the plugins that were run, see DoTrace
+	tried *[]string
 }
@@ -0,0 +1,131 @@
+package radar
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vela-ssoc/vela-kit/lua"
+)
+
+// taskHooks 任务级别的 lua 回调, 在任务的子虚拟机 Task.co 中串行执行
+// 回调出错只记录日志, 不影响任务以及其他回调
+type taskHooks struct {
+	mu       sync.Mutex
+	service  []*lua.LFunction
+	host     []*lua.LFunction
+	progress []*lua.LFunction
+	finish   []*lua.LFunction
+	fail     []*lua.LFunction
+	interval time.Duration // on_progress 回调间隔
+}
+
+// call 同一个 LState 不能并发使用, 所有回调共用一把锁
+func (t *Task) call(name string, fns []*lua.LFunction, args ...lua.LValue) {
+	if len(fns) == 0 {
+		return
+	}
+
+	t.hooks.mu.Lock()
+	defer t.hooks.mu.Unlock()
+	for _, fn := range fns {
+		err := t.co.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, args...)
+		if err != nil {
+			xEnv.Errorf("radar task %s %s hook fail %v", t.Id, name, err)
+		}
+	}
+}
+
+func (t *Task) onService(s *Service) {
+	if t.hooks != nil {
+		t.call("on_service", t.hooks.service, s)
+	}
+}
+
+func (t *Task) onHost(h *Host) {
+	if t.hooks != nil {
+		t.call("on_host", t.hooks.host, h)
+	}
+}
+
+func (t *Task) onFinish() {
+	if t.hooks != nil {
+		t.call("on_finish", t.hooks.finish, t)
+	}
+}
+
+func (t *Task) onError(msg string) {
+	if t.hooks != nil {
+		t.call("on_error", t.hooks.fail, t, lua.LString(msg))
+	}
+}
+
+// progressMonitor 按间隔调用 on_progress, 任务结束时退出
+func (t *Task) progressMonitor() {
+	if t.hooks == nil || len(t.hooks.progress) == 0 {
+		return
+	}
+
+	tk := time.NewTicker(t.hooks.interval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-tk.C:
+			if t.Status == Task_Status_Success || t.Status == Task_Status_Error {
+				return
+			}
+			t.call("on_progress", t.hooks.progress, t)
+		}
+	}
+}
+
+func (t *Task) hook() *taskHooks {
+	if t.hooks == nil {
+		t.hooks = &taskHooks{interval: 5 * time.Second}
+	}
+	return t.hooks
+}
+
+// task.on_service(function(s) ... end) 每个服务结果, 在全局 pipe 之后执行
+func (t *Task) onServiceL(L *lua.LState) int {
+	h := t.hook()
+	h.service = append(h.service, L.CheckFunction(1))
+	L.Push(t)
+	return 1
+}
+
+// task.on_host(function(h) ... end) 每个主机记录
+func (t *Task) onHostL(L *lua.LState) int {
+	h := t.hook()
+	h.host = append(h.host, L.CheckFunction(1))
+	L.Push(t)
+	return 1
+}
+
+// task.on_progress(function(task) ... end, 10) 每 10 秒执行一次, 默认 5 秒
+func (t *Task) onProgressL(L *lua.LState) int {
+	h := t.hook()
+	h.progress = append(h.progress, L.CheckFunction(1))
+	if n := L.IsInt(2); n > 0 {
+		h.interval = time.Duration(n) * time.Second
+	}
+	L.Push(t)
+	return 1
+}
+
+// task.on_finish(function(task) ... end) 任务正常结束
+func (t *Task) onFinishL(L *lua.LState) int {
+	h := t.hook()
+	h.finish = append(h.finish, L.CheckFunction(1))
+	L.Push(t)
+	return 1
+}
+
+// task.on_error(function(task, msg) ... end) 任务异常结束
+func (t *Task) onErrorL(L *lua.LState) int {
+	h := t.hook()
+	h.fail = append(h.fail, L.CheckFunction(1))
+	L.Push(t)
+	return 1
+}
@@ -7,24 +7,34 @@ import (
 	"github.com/vela-ssoc/vela-kit/kind"
 	"github.com/vela-ssoc/vela-kit/lua"
 	"github.com/vela-ssoc/vela-kit/strutil"
+	"github.com/vela-ssoc/vela-radar/discover"
+	"github.com/vela-ssoc/vela-radar/host"
 	"github.com/vela-ssoc/vela-radar/port"
+	"github.com/vela-ssoc/vela-radar/port/syn"
 	"github.com/vela-ssoc/vela-radar/util"
 )
 
 type Service struct {
-	IP        net.IP          `json:"ip"         bson:"ip"`   // IP
-	Port      uint16          `json:"port"       bson:"port"` // 端口
-	Host      string          `json:"host"       bson:"host"` // 主机域名 (扫内网的时候一般为空或者填 IP)
-	Location  string          `json:"location"`               // 地理位置 *
-	TLS       bool            `json:"tls"`
-	Banner    json.RawMessage `json:"banner"`                       // tcp服务的banner信息
-	Protocol  string          `json:"protocol"`                     // 应用层协议
-	Transport string          `json:"transport"`                    // 传输层协议 tcp/udp
-	Version   string          `json:"version"`                      // 应用(或者协议)版本
-	Component []string        `json:"component"`                    // 组件标签
-	Comment   string          `json:"Comment"`                      // 备注信息
-	TaskId    string          `json:"task_id"       bson:"task_id"` // 任务ID
-	HTTPInfo  *port.HttpInfo  `json:"http_info"`                    // web服务的指纹以及相关信息
+	IP        net.IP           `json:"ip"         bson:"ip"`   // IP
+	Port      uint16           `json:"port"       bson:"port"` // 端口
+	Host      string           `json:"host"       bson:"host"` // 主机域名 (扫内网的时候一般为空或者填 IP)
+	Location  string           `json:"location"`               // 地理位置 *
+	TLS       bool             `json:"tls"`
+	Banner    json.RawMessage  `json:"banner"`                       // tcp服务的banner信息
+	Protocol  string           `json:"protocol"`                     // 应用层协议
+	Transport string           `json:"transport"`                    // 传输层协议 tcp/udp
+	Version   string           `json:"version"`                      // 应用(或者协议)版本
+	Component []string         `json:"component"`                    // 组件标签
+	Comment   string           `json:"Comment"`                      // 备注信息
+	TaskId    string           `json:"task_id"       bson:"task_id"` // 任务ID
+	HTTPInfo  *port.HttpInfo   `json:"http_info"`                    // web服务的指纹以及相关信息
+	Elapsed   int64            `json:"response_time"`                // 服务响应耗时(ms), 仅未识别服务
+	Plugins   []string         `json:"plugins"`                      // 尝试过的指纹插件, 仅未识别服务
+	Names     []host.Name      `json:"names"`                        // 主机名以及来源
+	Device    *discover.Device `json:"device"`                       // 组播发现的设备信息
+	SNMP      *host.SNMPInfo   `json:"snmp"`                         // SNMP 读取到的设备信息
+	AssetId   string           `json:"asset_id"`                     // 跨ip关联后的资产ID
+	Tags      []string         `json:"tags"`                         // 过滤规则追加的标签
 }
 
 func (s *Service) String() string                         { return strutil.B2S(s.Bytes()) }
@@ -34,6 +44,62 @@ func (s *Service) AssertString() (string, bool)           { return "", false }
 func (s *Service) AssertFunction() (*lua.LFunction, bool) { return nil, false }
 func (s *Service) Peek() lua.LValue                       { return s }
 
+// Index lua 中按字段读取, eg: host.ip, host.http_info.title, host.component[1]
+func (s *Service) Index(L *lua.LState, key string) lua.LValue {
+	switch key {
+	case "ip":
+		return lua.LString(s.IP.String())
+	case "port":
+		return lua.LNumber(s.Port)
+	case "host":
+		return lua.LString(s.Host)
+	case "location":
+		return lua.LString(s.Location)
+	case "tls":
+		return lua.LBool(s.TLS)
+	case "banner":
+		return lua.LString(s.Banner)
+	case "protocol":
+		return lua.LString(s.Protocol)
+	case "transport":
+		return lua.LString(s.Transport)
+	case "version":
+		return lua.LString(s.Version)
+	case "component":
+		return luaStringList(L, s.Component)
+	case "comment":
+		return lua.LString(s.Comment)
+	case "task_id":
+		return lua.LString(s.TaskId)
+	case "http_info":
+		if s.HTTPInfo == nil {
+			return lua.LNil
+		}
+		return s.HTTPInfo
+	case "response_time":
+		return lua.LNumber(s.Elapsed)
+	case "plugins":
+		return luaStringList(L, s.Plugins)
+	case "names":
+		return luaValue(L, s.Names)
+	case "device":
+		if s.Device == nil {
+			return lua.LNil
+		}
+		return luaValue(L, s.Device)
+	case "snmp":
+		if s.SNMP == nil {
+			return lua.LNil
+		}
+		return luaValue(L, s.SNMP)
+	case "asset_id":
+		return lua.LString(s.AssetId)
+	case "tags":
+		return luaStringList(L, s.Tags)
+	}
+	return lua.LNil
+}
+
 func (s *Service) Bytes() []byte {
 	enc := kind.NewJsonEncoder()
 	enc.Tab("")
@@ -50,6 +116,13 @@ func (s *Service) Bytes() []byte {
 	enc.Raw("http_info", util.ToJsonBytes(s.HTTPInfo))
 	enc.KV("banner", string([]byte(s.Banner)))
 	enc.KV("task_id", s.TaskId)
+	enc.KV("response_time", s.Elapsed)
+	enc.KV("plugins", s.Plugins)
+	enc.Raw("names", util.ToJsonBytes(s.Names))
+	enc.Raw("device", util.ToJsonBytes(s.Device))
+	enc.Raw("snmp", util.ToJsonBytes(s.SNMP))
+	enc.KV("asset_id", s.AssetId)
+	enc.KV("tags", s.Tags)
 	enc.End("}")
 	return enc.Bytes()
 }
@@ -57,3 +130,102 @@ func (s *Service) Bytes() []byte {
 func (s *Service) WebFinder() {
 
 }
+
+// PortState 单个端口的探测状态
+type PortState struct {
+	Port  uint16 `json:"port"`
+	State string `json:"state"` // open/closed/filtered
+}
+
+// Host 主机维度的扫描结果
+type Host struct {
+	IP         net.IP           `json:"ip"`
+	Location   string           `json:"location"`
+	TaskId     string           `json:"task_id"`
+	Open       uint32           `json:"open"`
+	Closed     uint32           `json:"closed"`
+	Filtered   uint32           `json:"filtered"`
+	Ports      []PortState      `json:"ports"`      // 仅包含任务指定的 state_ports
+	Path       *syn.TraceResult `json:"path"`       // 到所在 /24 网段的路径
+	Names      []host.Name      `json:"names"`      // 主机名以及来源
+	Device     *discover.Device `json:"device"`     // 组播发现的设备信息
+	AssetId    string           `json:"asset_id"`   // 跨ip关联后的资产ID
+	Anomaly    string           `json:"anomaly"`    // tarpit/蜜罐标记, 为空表示正常
+	Suppressed int              `json:"suppressed"` // 被标记后丢弃的开放端口数
+	Tags       []string         `json:"tags"`       // 过滤规则追加的标签
+
+	hasState bool
+}
+
+func (h *Host) String() string                         { return strutil.B2S(h.Bytes()) }
+func (h *Host) Type() lua.LValueType                   { return lua.LTObject }
+func (h *Host) AssertFloat64() (float64, bool)         { return 0, false }
+func (h *Host) AssertString() (string, bool)           { return "", false }
+func (h *Host) AssertFunction() (*lua.LFunction, bool) { return nil, false }
+func (h *Host) Peek() lua.LValue                       { return h }
+
+func (h *Host) Index(L *lua.LState, key string) lua.LValue {
+	switch key {
+	case "kind":
+		return lua.LString("host")
+	case "ip":
+		return lua.LString(h.IP.String())
+	case "location":
+		return lua.LString(h.Location)
+	case "task_id":
+		return lua.LString(h.TaskId)
+	case "open":
+		return lua.LNumber(h.Open)
+	case "closed":
+		return lua.LNumber(h.Closed)
+	case "filtered":
+		return lua.LNumber(h.Filtered)
+	case "ports":
+		return luaValue(L, h.Ports)
+	case "path":
+		if h.Path == nil {
+			return lua.LNil
+		}
+		return luaValue(L, h.Path)
+	case "names":
+		return luaValue(L, h.Names)
+	case "device":
+		if h.Device == nil {
+			return lua.LNil
+		}
+		return luaValue(L, h.Device)
+	case "asset_id":
+		return lua.LString(h.AssetId)
+	case "anomaly":
+		return lua.LString(h.Anomaly)
+	case "suppressed":
+		return lua.LNumber(h.Suppressed)
+	case "tags":
+		return luaStringList(L, h.Tags)
+	}
+	return lua.LNil
+}
+
+func (h *Host) Bytes() []byte {
+	enc := kind.NewJsonEncoder()
+	enc.Tab("")
+	enc.KV("kind", "host")
+	enc.KV("ip", h.IP)
+	enc.KV("location", h.Location)
+	enc.KV("task_id", h.TaskId)
+	if h.hasState {
+		enc.KV("open", h.Open)
+		enc.KV("closed", h.Closed)
+		enc.KV("filtered", h.Filtered)
+		enc.Raw("ports", util.ToJsonBytes(h.Ports))
+	}
+	enc.Raw("path", util.ToJsonBytes(h.Path))
+	enc.Raw("names", util.ToJsonBytes(h.Names))
+	enc.Raw("device", util.ToJsonBytes(h.Device))
+	enc.KV("asset_id", h.AssetId)
+	enc.KV("anomaly", h.Anomaly)
+	enc.KV("suppressed", h.Suppressed)
+	enc.KV("tags", h.Tags)
+	enc.End("}")
+	return enc.Bytes()
+}
@@ -0,0 +1,205 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/vela-ssoc/vela-radar/fingerprintx/plugins/services/netbios"
+)
+
+const (
+	NameSourcePTR     = "ptr"
+	NameSourceNetbios = "netbios"
+	NameSourceLLMNR   = "llmnr"
+	NameSourceMDNS    = "mdns"
+)
+
+// Name 主机名以及来源
+type Name struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// NameOption 主机名解析参数
+type NameOption struct {
+	DNSServer string        // PTR 查询使用的 DNS 服务器 ip:port, 为空使用系统配置
+	Timeout   time.Duration // 每种查询的超时时间
+}
+
+// ResolveNames 依次通过 PTR, NetBIOS 以及本地网段上的 LLMNR/mDNS 获取主机名
+func ResolveNames(ip net.IP, opt NameOption) []Name {
+	if opt.Timeout <= 0 {
+		opt.Timeout = time.Second
+	}
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		names []Name
+	)
+	add := func(source string, found ...string) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, n := range found {
+			n = strings.TrimSpace(strings.TrimSuffix(n, "."))
+			if n == "" {
+				continue
+			}
+			names = append(names, Name{Name: n, Source: source})
+		}
+	}
+
+	lookups := map[string]func(net.IP, NameOption) ([]string, error){
+		NameSourcePTR:     LookupPTR,
+		NameSourceNetbios: LookupNetbios,
+	}
+	if IsLocal(ip) {
+		lookups[NameSourceLLMNR] = LookupLLMNR
+		lookups[NameSourceMDNS] = LookupMDNS
+	}
+
+	for source, fn := range lookups {
+		wg.Add(1)
+		go func(source string, fn func(net.IP, NameOption) ([]string, error)) {
+			defer wg.Done()
+			found, err := fn(ip, opt)
+			if err != nil {
+				return
+			}
+			add(source, found...)
+		}(source, fn)
+	}
+	wg.Wait()
+	return names
+}
+
+// LookupPTR 反向解析, 可以指定 DNS 服务器
+func LookupPTR(ip net.IP, opt NameOption) ([]string, error) {
+	r := net.DefaultResolver
+	if opt.DNSServer != "" {
+		server := opt.DNSServer
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		r = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{Timeout: opt.Timeout}
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opt.Timeout)
+	defer cancel()
+	return r.LookupAddr(ctx, ip.String())
+}
+
+// LookupNetbios NetBIOS node status 查询(udp 137)
+func LookupNetbios(ip net.IP, opt NameOption) ([]string, error) {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(ip.String(), "137"), opt.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	name, err := netbios.QueryName(conn, opt.Timeout)
+	if err != nil || name == "" {
+		return nil, err
+	}
+	return []string{name}, nil
+}
+
+// LookupLLMNR 直接向目标的 5355 端口发送 PTR 查询
+func LookupLLMNR(ip net.IP, opt NameOption) ([]string, error) {
+	return queryPTR(ip, 5355, opt.Timeout)
+}
+
+// LookupMDNS 直接向目标的 5353 端口发送 PTR 查询(legacy unicast)
+func LookupMDNS(ip net.IP, opt NameOption) ([]string, error) {
+	return queryPTR(ip, 5353, opt.Timeout)
+}
+
+func reverseName(ip net.IP) (string, error) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return "", fmt.Errorf("%s is not ipv4", ip)
+	}
+	return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", ip4[3], ip4[2], ip4[1], ip4[0]), nil
+}
+
+func queryPTR(ip net.IP, port int, timeout time.Duration) ([]string, error) {
+	arpa, err := reverseName(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	id := uint16(rand.Intn(0xffff))
+	req := layers.DNS{
+		ID:      id,
+		QDCount: 1,
+		Questions: []layers.DNSQuestion{{
+			Name:  []byte(arpa),
+			Type:  layers.DNSTypePTR,
+			Class: layers.DNSClassIN,
+		}},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err = req.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(ip.String(), fmt.Sprint(port)), timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	if _, err = conn.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 1500)
+	n, err := conn.Read(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp layers.DNS
+	if err = resp.DecodeFromBytes(data[:n], gopacket.NilDecodeFeedback); err != nil {
+		return nil, err
+	}
+	if resp.ID != id && port != 5353 {
+		return nil, fmt.Errorf("dns id mismatch")
+	}
+
+	var names []string
+	for _, ans := range resp.Answers {
+		if ans.Type == layers.DNSTypePTR && len(ans.PTR) > 0 {
+			names = append(names, string(ans.PTR))
+		}
+	}
+	return names, nil
+}
+
+// IsLocal 判断 ip 是否在本机直连的网段中
+func IsLocal(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if n, ok := addr.(*net.IPNet); ok && !n.IP.IsLoopback() && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,354 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+const (
+	oidSysDescr    = ".1.3.6.1.2.1.1.1.0"
+	oidSysObjectID = ".1.3.6.1.2.1.1.2.0"
+	oidSysUpTime   = ".1.3.6.1.2.1.1.3.0"
+	oidSysContact  = ".1.3.6.1.2.1.1.4.0"
+	oidSysName     = ".1.3.6.1.2.1.1.5.0"
+	oidSysLocation = ".1.3.6.1.2.1.1.6.0"
+
+	oidIfEntry         = ".1.3.6.1.2.1.2.2.1"
+	oidIpNetToMedia    = ".1.3.6.1.2.1.4.22.1"
+	oidIpRouteEntry    = ".1.3.6.1.2.1.4.21.1"
+	maxSNMPTableValues = 8192 // 单个表最多读取的值数量, 防止超大的路由表
+)
+
+// SNMPCredential SNMP 认证信息, v1/v2c 使用 Community, v3 使用 USM 用户
+type SNMPCredential struct {
+	Version   string // v1/v2c/v3
+	Community string
+	User      string
+	AuthProto string // md5/sha/sha224/sha256/sha384/sha512
+	AuthPass  string
+	PrivProto string // des/aes/aes192/aes256
+	PrivPass  string
+}
+
+// SNMPInterface ifTable 中的一个接口
+type SNMPInterface struct {
+	Index  int    `json:"index"`
+	Descr  string `json:"descr"`
+	Type   int    `json:"type"`
+	MTU    int    `json:"mtu"`
+	Speed  uint64 `json:"speed"`
+	MAC    string `json:"mac"`
+	Admin  int    `json:"admin_status"` // 1 up, 2 down, 3 testing
+	Status int    `json:"oper_status"`
+}
+
+// SNMPArp ARP 表项
+type SNMPArp struct {
+	IfIndex int    `json:"if_index"`
+	IP      string `json:"ip"`
+	MAC     string `json:"mac"`
+}
+
+// SNMPRoute 路由表项
+type SNMPRoute struct {
+	Dest    string `json:"dest"`
+	Mask    string `json:"mask"`
+	NextHop string `json:"next_hop"`
+	IfIndex int    `json:"if_index"`
+}
+
+// SNMPInfo 通过 SNMP 读取到的设备信息, 不包含认证信息
+type SNMPInfo struct {
+	Version    string          `json:"version"`
+	User       string          `json:"user,omitempty"` // v3 用户名
+	Descr      string          `json:"sys_descr"`
+	ObjectID   string          `json:"sys_object_id"`
+	Name       string          `json:"sys_name"`
+	Location   string          `json:"sys_location"`
+	Contact    string          `json:"sys_contact"`
+	Uptime     uint32          `json:"sys_uptime"` // 1/100 秒
+	Interfaces []SNMPInterface `json:"interfaces"`
+	Arp        []SNMPArp       `json:"arp"`
+	Routes     []SNMPRoute     `json:"routes"`
+}
+
+// Neighbors ARP 表中的ip以及路由表中的下一跳, 可以作为新的扫描目标
+func (info *SNMPInfo) Neighbors() []net.IP {
+	seen := make(map[string]bool)
+	var ips []net.IP
+	add := func(s string) {
+		ip := net.ParseIP(s).To4()
+		if ip == nil || ip.IsUnspecified() || ip.IsLoopback() || ip.IsMulticast() || seen[s] {
+			return
+		}
+		seen[s] = true
+		ips = append(ips, ip)
+	}
+
+	for _, a := range info.Arp {
+		add(a.IP)
+	}
+	for _, r := range info.Routes {
+		add(r.NextHop)
+	}
+	return ips
+}
+
+func snmpClient(ip net.IP, port uint16, cred SNMPCredential, timeout time.Duration) (*gosnmp.GoSNMP, error) {
+	c := &gosnmp.GoSNMP{
+		Target:         ip.String(),
+		Port:           port,
+		Timeout:        timeout,
+		Retries:        1,
+		MaxOids:        gosnmp.MaxOids,
+		MaxRepetitions: 20,
+	}
+
+	switch strings.ToLower(cred.Version) {
+	case "v1", "1":
+		c.Version = gosnmp.Version1
+		c.Community = cred.Community
+	case "", "v2c", "2c", "2":
+		c.Version = gosnmp.Version2c
+		c.Community = cred.Community
+	case "v3", "3":
+		sp := &gosnmp.UsmSecurityParameters{
+			UserName:                 cred.User,
+			AuthenticationProtocol:   gosnmp.NoAuth,
+			PrivacyProtocol:          gosnmp.NoPriv,
+			AuthenticationPassphrase: cred.AuthPass,
+			PrivacyPassphrase:        cred.PrivPass,
+		}
+		c.Version = gosnmp.Version3
+		c.SecurityModel = gosnmp.UserSecurityModel
+		c.MsgFlags = gosnmp.NoAuthNoPriv
+
+		if cred.AuthPass != "" {
+			auth, err := snmpAuthProto(cred.AuthProto)
+			if err != nil {
+				return nil, err
+			}
+			sp.AuthenticationProtocol = auth
+			c.MsgFlags = gosnmp.AuthNoPriv
+		}
+		if cred.AuthPass != "" && cred.PrivPass != "" {
+			priv, err := snmpPrivProto(cred.PrivProto)
+			if err != nil {
+				return nil, err
+			}
+			sp.PrivacyProtocol = priv
+			c.MsgFlags = gosnmp.AuthPriv
+		}
+		c.SecurityParameters = sp
+	default:
+		return nil, fmt.Errorf("invalid snmp version %s", cred.Version)
+	}
+
+	return c, nil
+}
+
+func snmpAuthProto(s string) (gosnmp.SnmpV3AuthProtocol, error) {
+	switch strings.ToLower(s) {
+	case "md5":
+		return gosnmp.MD5, nil
+	case "", "sha":
+		return gosnmp.SHA, nil
+	case "sha224":
+		return gosnmp.SHA224, nil
+	case "sha256":
+		return gosnmp.SHA256, nil
+	case "sha384":
+		return gosnmp.SHA384, nil
+	case "sha512":
+		return gosnmp.SHA512, nil
+	}
+	return 0, fmt.Errorf("invalid snmp auth protocol %s", s)
+}
+
+func snmpPrivProto(s string) (gosnmp.SnmpV3PrivProtocol, error) {
+	switch strings.ToLower(s) {
+	case "des":
+		return gosnmp.DES, nil
+	case "", "aes":
+		return gosnmp.AES, nil
+	case "aes192":
+		return gosnmp.AES192, nil
+	case "aes256":
+		return gosnmp.AES256, nil
+	}
+	return 0, fmt.Errorf("invalid snmp priv protocol %s", s)
+}
+
+// QuerySNMP 依次尝试认证信息, 第一个能读取 system 组的用于读取接口/ARP/路由表
+func QuerySNMP(ip net.IP, port uint16, creds []SNMPCredential, timeout time.Duration) (*SNMPInfo, error) {
+	if port == 0 {
+		port = 161
+	}
+
+	var lastErr = errors.New("no snmp credential")
+	for _, cred := range creds {
+		c, err := snmpClient(ip, port, cred, timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err = c.Connect(); err != nil {
+			lastErr = err
+			continue
+		}
+
+		info, err := snmpSystem(c)
+		if err != nil {
+			c.Conn.Close()
+			lastErr = err
+			continue
+		}
+
+		info.Version = c.Version.String()
+		if c.Version == gosnmp.Version3 {
+			info.User = cred.User
+		}
+		snmpTables(c, info)
+		c.Conn.Close()
+		return info, nil
+	}
+	return nil, lastErr
+}
+
+func snmpSystem(c *gosnmp.GoSNMP) (*SNMPInfo, error) {
+	pkt, err := c.Get([]string{oidSysDescr, oidSysObjectID, oidSysUpTime, oidSysContact, oidSysName, oidSysLocation})
+	if err != nil {
+		return nil, err
+	}
+	if pkt.Error != gosnmp.NoError {
+		return nil, fmt.Errorf("snmp error %s", pkt.Error)
+	}
+
+	info := &SNMPInfo{}
+	found := false
+	for _, v := range pkt.Variables {
+		if v.Type == gosnmp.NoSuchObject || v.Type == gosnmp.NoSuchInstance || v.Type == gosnmp.Null {
+			continue
+		}
+		found = true
+		switch v.Name {
+		case oidSysDescr:
+			info.Descr = snmpString(v)
+		case oidSysObjectID:
+			info.ObjectID = snmpString(v)
+		case oidSysUpTime:
+			info.Uptime = uint32(gosnmp.ToBigInt(v.Value).Uint64())
+		case oidSysContact:
+			info.Contact = snmpString(v)
+		case oidSysName:
+			info.Name = snmpString(v)
+		case oidSysLocation:
+			info.Location = snmpString(v)
+		}
+	}
+	if !found {
+		return nil, errors.New("snmp system group not readable")
+	}
+	return info, nil
+}
+
+// snmpWalk 遍历表, 按 列号 -> 行索引 -> 值 返回
+func snmpWalk(c *gosnmp.GoSNMP, root string) map[int]map[string]gosnmp.SnmpPDU {
+	cols := make(map[int]map[string]gosnmp.SnmpPDU)
+	n := 0
+	walk := c.BulkWalk
+	if c.Version == gosnmp.Version1 {
+		walk = c.Walk
+	}
+
+	_ = walk(root, func(v gosnmp.SnmpPDU) error {
+		n++
+		if n > maxSNMPTableValues {
+			return errors.New("too many values")
+		}
+		// .root.col.index
+		col, index, ok := strings.Cut(strings.TrimPrefix(v.Name, root+"."), ".")
+		if !ok {
+			return nil
+		}
+		id, err := strconv.Atoi(col)
+		if err != nil {
+			return nil
+		}
+		if cols[id] == nil {
+			cols[id] = make(map[string]gosnmp.SnmpPDU)
+		}
+		cols[id][index] = v
+		return nil
+	})
+	return cols
+}
+
+func snmpTables(c *gosnmp.GoSNMP, info *SNMPInfo) {
+	ifs := snmpWalk(c, oidIfEntry)
+	for index, v := range ifs[1] {
+		info.Interfaces = append(info.Interfaces, SNMPInterface{
+			Index:  snmpInt(v),
+			Descr:  snmpString(ifs[2][index]),
+			Type:   snmpInt(ifs[3][index]),
+			MTU:    snmpInt(ifs[4][index]),
+			Speed:  gosnmp.ToBigInt(ifs[5][index].Value).Uint64(),
+			MAC:    snmpMAC(ifs[6][index]),
+			Admin:  snmpInt(ifs[7][index]),
+			Status: snmpInt(ifs[8][index]),
+		})
+	}
+
+	arp := snmpWalk(c, oidIpNetToMedia)
+	for index, v := range arp[3] {
+		info.Arp = append(info.Arp, SNMPArp{
+			IfIndex: snmpInt(arp[1][index]),
+			IP:      snmpString(v),
+			MAC:     snmpMAC(arp[2][index]),
+		})
+	}
+
+	routes := snmpWalk(c, oidIpRouteEntry)
+	for index, v := range routes[1] {
+		info.Routes = append(info.Routes, SNMPRoute{
+			Dest:    snmpString(v),
+			IfIndex: snmpInt(routes[2][index]),
+			NextHop: snmpString(routes[7][index]),
+			Mask:    snmpString(routes[11][index]),
+		})
+	}
+}
+
+func snmpString(v gosnmp.SnmpPDU) string {
+	switch val := v.Value.(type) {
+	case []byte:
+		return strings.TrimSpace(string(val))
+	case string:
+		return val
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func snmpInt(v gosnmp.SnmpPDU) int {
+	if v.Value == nil {
+		return 0
+	}
+	return int(gosnmp.ToBigInt(v.Value).Int64())
+}
+
+func snmpMAC(v gosnmp.SnmpPDU) string {
+	b, ok := v.Value.([]byte)
+	if !ok || len(b) == 0 {
+		return ""
+	}
+	return net.HardwareAddr(b).String()
+}
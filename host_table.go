@@ -0,0 +1,202 @@
+package radar
+
+import (
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/vela-ssoc/vela-radar/port"
+)
+
+// hostState 单个主机的端口状态统计
+type hostState struct {
+	ip     net.IP
+	open   uint32
+	closed uint32
+	extra  uint32                // 设备公布的额外探测端口数
+	seen   []uint16              // 已经统计过的 open/closed 端口, 有序, 不超过探测的端口数
+	ports  map[uint16]port.State // 只记录 StatePorts 范围内的端口
+}
+
+// mark 记录端口, 已经统计过或者超过探测端口数时返回 false
+func (hs *hostState) mark(p uint16, total uint32) bool {
+	i := sort.Search(len(hs.seen), func(i int) bool { return hs.seen[i] >= p })
+	if i < len(hs.seen) && hs.seen[i] == p {
+		return false
+	}
+	if uint32(len(hs.seen)) >= total+hs.extra {
+		return false
+	}
+	hs.seen = append(hs.seen, 0)
+	copy(hs.seen[i+1:], hs.seen[i:])
+	hs.seen[i] = p
+	return true
+}
+
+// unanswered 没有响应的端口数, 重复或者范围外的响应不会让结果回绕
+func (hs *hostState) unanswered(total uint32) uint32 {
+	total += hs.extra
+	if n := hs.open + hs.closed; n < total {
+		return total - n
+	}
+	return 0
+}
+
+// hostTable 记录任务中探测过的主机, 开启 state 时还记录每个主机 open/closed/filtered 端口状态
+// 只开启 names/trace/anomaly 时只需要主机清单, 不做端口统计
+type hostTable struct {
+	mu     sync.Mutex
+	state  bool
+	total  uint32        // 每个主机探测的端口数
+	ranges *port.PortSet // 需要逐端口记录的端口, 为空不记录
+	ports  []uint16      // 任务探测的端口(用于补全没有响应的 filtered 端口)
+	hosts  map[string]*hostState
+}
+
+func newHostTable(ports []uint16, state bool, subset string) (*hostTable, error) {
+	st := &hostTable{
+		state: state,
+		total: uint32(len(ports)),
+		ports: ports,
+		hosts: make(map[string]*hostState),
+	}
+
+	if !state || subset == "" {
+		return st, nil
+	}
+
+	ranges, err := port.ParsePortRangeStr(subset)
+	if err != nil {
+		return nil, err
+	}
+	st.ranges = port.NewPortSet(ranges)
+	return st, nil
+}
+
+func (st *hostTable) host(ip net.IP) *hostState {
+	key := ip.String()
+	hs, ok := st.hosts[key]
+	if !ok {
+		hs = &hostState{ip: ip}
+		st.hosts[key] = hs
+	}
+	return hs
+}
+
+// Touch 标记主机已经开始探测, 没有任何响应的主机也会有统计结果
+func (st *hostTable) Touch(ip net.IP) {
+	st.mu.Lock()
+	st.host(ip)
+	st.mu.Unlock()
+}
+
+// Record 记录端口状态, 没有响应的端口最后统一计为 filtered, 不需要逐个记录
+func (st *hostTable) Record(v port.OpenIpPort) {
+	if !st.state {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	hs := st.host(v.Ip)
+	if st.ranges.Has(v.Port) {
+		if hs.ports == nil {
+			hs.ports = make(map[uint16]port.State)
+		}
+		// 第一个明确的 open/closed 结果为准
+		if old, ok := hs.ports[v.Port]; !ok || old == port.Filtered {
+			hs.ports[v.Port] = v.State
+		}
+	}
+
+	if v.State != port.Open && v.State != port.Closed {
+		return
+	}
+	if !hs.mark(v.Port, st.total) {
+		return
+	}
+	if v.State == port.Open {
+		hs.open++
+	} else {
+		hs.closed++
+	}
+}
+
+// Extra 记录主机额外探测的端口数(设备公布的服务端口)
+func (st *hostTable) Extra(ip net.IP, n int) {
+	if n <= 0 {
+		return
+	}
+	st.mu.Lock()
+	st.host(ip).extra += uint32(n)
+	st.mu.Unlock()
+}
+
+// Summary 汇总所有主机的端口状态, 没有响应的端口计为 filtered
+func (st *hostTable) Summary() (hosts int, open, closed, filtered uint64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, hs := range st.hosts {
+		open += uint64(hs.open)
+		closed += uint64(hs.closed)
+		filtered += uint64(hs.unanswered(st.total))
+	}
+	return len(st.hosts), open, closed, filtered
+}
+
+// Hosts 生成每个主机的端口状态记录
+func (st *hostTable) Hosts(t *Task) []*Host {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	hosts := make([]*Host, 0, len(st.hosts))
+	for _, hs := range st.hosts {
+		h := &Host{
+			IP:       hs.ip,
+			Location: t.Option.Location,
+			TaskId:   t.Id,
+		}
+
+		if t.Option.State {
+			h.hasState = true
+			h.Open = hs.open
+			h.Closed = hs.closed
+			h.Filtered = hs.unanswered(st.total)
+		}
+
+		if t.paths != nil {
+			h.Path = t.paths.Get(hs.ip)
+		}
+
+		if t.names != nil {
+			h.Names = t.names.Cached(hs.ip)
+		}
+
+		if t.devices != nil {
+			h.Device = t.devices.Get(hs.ip)
+		}
+
+		h.AssetId = t.rad.assets.Lookup(hs.ip)
+
+		if t.anomaly != nil {
+			h.Anomaly, h.Suppressed = t.anomaly.Get(hs.ip)
+		}
+
+		if h.hasState && st.ranges != nil {
+			for _, p := range st.ports {
+				if !st.ranges.Has(p) {
+					continue
+				}
+				state, ok := hs.ports[p]
+				if !ok {
+					state = port.Filtered
+				}
+				h.Ports = append(h.Ports, PortState{Port: p, State: state.String()})
+			}
+			sort.Slice(h.Ports, func(i, j int) bool { return h.Ports[i].Port < h.Ports[j].Port })
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts
+}
@@ -0,0 +1,46 @@
+package radar
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vela-ssoc/vela-radar/port"
+)
+
+func TestHostTable_Record(t *testing.T) {
+	st, err := newHostTable([]uint16{22, 80, 443}, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := net.ParseIP("10.0.0.1")
+	st.Touch(ip)
+	st.Record(port.OpenIpPort{Ip: ip, Port: 80, State: port.Open})
+	st.Record(port.OpenIpPort{Ip: ip, Port: 80, State: port.Open}) // 重复响应
+	st.Record(port.OpenIpPort{Ip: ip, Port: 22, State: port.Closed})
+	st.Record(port.OpenIpPort{Ip: ip, Port: 443, State: port.Filtered})
+	st.Record(port.OpenIpPort{Ip: ip, Port: 8080, State: port.Closed})
+	st.Record(port.OpenIpPort{Ip: ip, Port: 8081, State: port.Closed}) // 超过探测端口数
+
+	hosts, open, closed, filtered := st.Summary()
+	if hosts != 1 || open != 1 || closed != 2 || filtered != 0 {
+		t.Fatalf("got hosts=%d open=%d closed=%d filtered=%d", hosts, open, closed, filtered)
+	}
+
+	st.Extra(ip, 2)
+	if _, _, _, filtered = st.Summary(); filtered != 2 {
+		t.Errorf("want 2 filtered with extra ports, got %d", filtered)
+	}
+}
+
+func TestHostTable_NoState(t *testing.T) {
+	st, err := newHostTable([]uint16{80}, false, "80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := net.ParseIP("10.0.0.1")
+	st.Touch(ip)
+	st.Record(port.OpenIpPort{Ip: ip, Port: 80, State: port.Open})
+	if hs := st.hosts[ip.String()]; hs.open != 0 || hs.seen != nil || hs.ports != nil {
+		t.Errorf("port state recorded without state option")
+	}
+}
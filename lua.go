@@ -1,12 +1,86 @@
 package radar
 
 import (
+	"encoding/json"
+
 	"github.com/vela-ssoc/vela-kit/lua"
 	"github.com/vela-ssoc/vela-kit/vela"
 )
 
 var xEnv vela.Environment
 
+// luaStringList 字符串数组转换为 lua 数组
+func luaStringList(L *lua.LState, list []string) *lua.LTable {
+	tab := L.CreateTable(len(list), 0)
+	for _, v := range list {
+		tab.Append(lua.LString(v))
+	}
+	return tab
+}
+
+// luaValue 嵌套的结构体字段按 json 结构转换为 lua 表
+func luaValue(L *lua.LState, v interface{}) lua.LValue {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return lua.LNil
+	}
+	var doc interface{}
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return lua.LNil
+	}
+	return jsonToLValue(L, doc)
+}
+
+func jsonToLValue(L *lua.LState, v interface{}) lua.LValue {
+	switch val := v.(type) {
+	case bool:
+		return lua.LBool(val)
+	case float64:
+		return lua.LNumber(val)
+	case string:
+		return lua.LString(val)
+	case []interface{}:
+		tab := L.CreateTable(len(val), 0)
+		for _, item := range val {
+			tab.Append(jsonToLValue(L, item))
+		}
+		return tab
+	case map[string]interface{}:
+		tab := L.CreateTable(0, len(val))
+		for k, item := range val {
+			tab.RawSetString(k, jsonToLValue(L, item))
+		}
+		return tab
+	}
+	return lua.LNil
+}
+
+// luaToJSON lua 表按 json 解析后的类型转换, 数字为 float64, 数组表为 []interface{}
+func luaToJSON(v lua.LValue) interface{} {
+	switch val := v.(type) {
+	case lua.LBool:
+		return bool(val)
+	case lua.LNumber:
+		return float64(val)
+	case lua.LString:
+		return string(val)
+	case *lua.LTable:
+		if n := val.Len(); n > 0 {
+			out := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				out = append(out, luaToJSON(val.RawGetInt(i)))
+			}
+			return out
+		}
+		out := make(map[string]interface{})
+		val.Range(func(key string, item lua.LValue) {
+			out[key] = luaToJSON(item)
+		})
+		return out
+	}
+	return nil
+}
+
 func NewRadarL(L *lua.LState) int {
 	cfg := NewConfig(L)
 	vda := L.NewVelaData(cfg.name, typeof) //判断出 当前code 是否有相同的对象 名字和类型
@@ -15,7 +89,7 @@ func NewRadarL(L *lua.LState) int {
 		L.Push(vda)
 	} else {
 		old := vda.Data.(*Radar)
-		old.cfg = cfg
+		old.reload(cfg)
 		L.Push(vda)
 	}
 	return 1
@@ -0,0 +1,82 @@
+package radar
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/vela-ssoc/vela-radar/metrics"
+)
+
+var (
+	metricPoolDepth = metrics.NewGauge("radar_pool_queue_depth",
+		"Items handed to a task worker pool and not finished yet.", "pool")
+	metricPing = metrics.NewCounter("radar_ping_total",
+		"Host liveness checks by result.", "result")
+	metricServices = metrics.NewCounter("radar_services_total",
+		"Services reported, by protocol.", "protocol")
+	metricTasks = metrics.NewCounter("radar_tasks_total",
+		"Finished scan tasks by status.", "status")
+)
+
+func (rad *Radar) MetricsPath() string {
+	return "/api/v1/arr/agent/radar/metrics"
+}
+
+// writeMetrics 注册的指标以及采集时读取的任务, 上报和本地库状态
+func (rad *Radar) writeMetrics(buf *bytes.Buffer) {
+	_ = metrics.Write(buf)
+
+	running := 0.0
+	var all, done, assets uint64
+	if t := rad.task; t != nil {
+		running = 1
+		probe := t.progress.Probe.info(time.Now())
+		all, done, assets = probe.Total, probe.Done, t.Count_asset
+	}
+	_ = metrics.WriteSamples(buf, "radar_task_running", "Whether a scan task is running.", metrics.TypeGauge,
+		metrics.Sample{Value: running})
+	_ = metrics.WriteSamples(buf, "radar_task_probes", "Probes of the running task, all planned and done.", metrics.TypeGauge,
+		metrics.Sample{Labels: []string{"kind", "all"}, Value: float64(all)},
+		metrics.Sample{Labels: []string{"kind", "done"}, Value: float64(done)})
+	_ = metrics.WriteSamples(buf, "radar_task_services", "Services found by the running task.", metrics.TypeGauge,
+		metrics.Sample{Value: float64(assets)})
+
+	var records, batches, retries, pending, spool []metrics.Sample
+	reporters, store := rad.outputs()
+	for _, r := range reporters {
+		st := r.Stats()
+		name := r.Name()
+		records = append(records,
+			metrics.Sample{Labels: []string{"sink", name, "result", "queued"}, Value: float64(st.Queued)},
+			metrics.Sample{Labels: []string{"sink", name, "result", "sent"}, Value: float64(st.Sent)},
+			metrics.Sample{Labels: []string{"sink", name, "result", "dropped"}, Value: float64(st.Dropped)})
+		batches = append(batches,
+			metrics.Sample{Labels: []string{"sink", name, "result", "sent"}, Value: float64(st.Batches)},
+			metrics.Sample{Labels: []string{"sink", name, "result", "failed"}, Value: float64(st.Failed)},
+			metrics.Sample{Labels: []string{"sink", name, "result", "spooled"}, Value: float64(st.Spooled)},
+			metrics.Sample{Labels: []string{"sink", name, "result", "replayed"}, Value: float64(st.Replayed)})
+		retries = append(retries, metrics.Sample{Labels: []string{"sink", name}, Value: float64(st.Retries)})
+		pending = append(pending, metrics.Sample{Labels: []string{"sink", name}, Value: float64(st.Pending)})
+		spool = append(spool, metrics.Sample{Labels: []string{"sink", name}, Value: float64(st.SpoolPending)})
+	}
+	_ = metrics.WriteSamples(buf, "radar_report_records_total", "Result records per sink by result.", metrics.TypeCounter, records...)
+	_ = metrics.WriteSamples(buf, "radar_report_batches_total", "Report batches per sink by result.", metrics.TypeCounter, batches...)
+	_ = metrics.WriteSamples(buf, "radar_report_retries_total", "Report send retries per sink.", metrics.TypeCounter, retries...)
+	_ = metrics.WriteSamples(buf, "radar_report_queue_depth", "Records waiting in the memory queue per sink.", metrics.TypeGauge, pending...)
+	_ = metrics.WriteSamples(buf, "radar_report_spool_batches", "Batches waiting in the disk spool per sink.", metrics.TypeGauge, spool...)
+
+	if store != nil {
+		_ = metrics.WriteSamples(buf, "radar_store_records", "Records in the local result store.", metrics.TypeGauge,
+			metrics.Sample{Value: float64(store.Count())})
+	}
+}
+
+// MetricsHandle Prometheus 文本格式的扫描器内部指标
+func (rad *Radar) MetricsHandle(ctx *fasthttp.RequestCtx) error {
+	var buf bytes.Buffer
+	rad.writeMetrics(&buf)
+	ctx.Response.Header.SetContentType("text/plain; version=0.0.4; charset=utf-8")
+	ctx.Response.SetBody(buf.Bytes())
+	return nil
+}
@@ -0,0 +1,311 @@
+// Package metrics 轻量的 Prometheus 指标, 只实现 counter/gauge/histogram 以及文本格式输出
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 指标类型
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// DefBuckets 默认的耗时分布(秒)
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+type series struct {
+	values []string
+	bits   uint64 // counter/gauge 的值, float64
+
+	mu     sync.Mutex
+	counts []uint64 // histogram 每个桶的数量, 不累计
+	sum    float64
+	count  uint64
+}
+
+func (s *series) add(v float64) {
+	for {
+		old := atomic.LoadUint64(&s.bits)
+		n := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&s.bits, old, n) {
+			return
+		}
+	}
+}
+
+func (s *series) value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&s.bits))
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+
+	mu     sync.RWMutex
+	series map[string]*series
+}
+
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic("metrics " + f.name + ": label values not match")
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok = f.series[key]; ok {
+		return s
+	}
+	s = &series{values: append([]string(nil), values...)}
+	if f.typ == TypeHistogram {
+		s.counts = make([]uint64, len(f.buckets))
+	}
+	f.series[key] = s
+	return s
+}
+
+// Registry 指标集合
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Default 各个模块的指标都注册在这里
+var Default = NewRegistry()
+
+func (r *Registry) register(f *family) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.families[f.name]; ok {
+		return old
+	}
+	f.series = make(map[string]*series)
+	r.families[f.name] = f
+	return f
+}
+
+type Counter struct{ s *series }
+
+func (c Counter) Inc()          { c.s.add(1) }
+func (c Counter) Add(v float64) { c.s.add(v) }
+
+type CounterVec struct{ f *family }
+
+func (v *CounterVec) With(values ...string) Counter { return Counter{v.f.with(values)} }
+
+type Gauge struct{ s *series }
+
+func (g Gauge) Inc()          { g.s.add(1) }
+func (g Gauge) Dec()          { g.s.add(-1) }
+func (g Gauge) Add(v float64) { g.s.add(v) }
+func (g Gauge) Set(v float64) { atomic.StoreUint64(&g.s.bits, math.Float64bits(v)) }
+
+type GaugeVec struct{ f *family }
+
+func (v *GaugeVec) With(values ...string) Gauge { return Gauge{v.f.with(values)} }
+
+type Histogram struct {
+	s       *series
+	buckets []float64
+}
+
+func (h Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.s.mu.Lock()
+	if i < len(h.s.counts) {
+		h.s.counts[i]++
+	}
+	h.s.sum += v
+	h.s.count++
+	h.s.mu.Unlock()
+}
+
+// ObserveSince 记录从 start 到现在的秒数
+func (h Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+type HistogramVec struct{ f *family }
+
+func (v *HistogramVec) With(values ...string) Histogram {
+	return Histogram{s: v.f.with(values), buckets: v.f.buckets}
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(&family{name: name, help: help, typ: TypeCounter, labels: labels})}
+}
+
+func (r *Registry) NewGauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{r.register(&family{name: name, help: help, typ: TypeGauge, labels: labels})}
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &HistogramVec{r.register(&family{name: name, help: help, typ: TypeHistogram, labels: labels, buckets: b})}
+}
+
+func NewCounter(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounter(name, help, labels...)
+}
+
+func NewGauge(name, help string, labels ...string) *GaugeVec {
+	return Default.NewGauge(name, help, labels...)
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+// Sample 采集时才计算的值, Labels 为 key, value 交替
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+func escape(v string) string {
+	if !strings.ContainsAny(v, "\\\"\n") {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return strings.ReplaceAll(v, "\n", `\n`)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeLine(w *bufio.Writer, name string, pairs []string, v float64) {
+	w.WriteString(name)
+	if len(pairs) > 0 {
+		w.WriteByte('{')
+		for i := 0; i+1 < len(pairs); i += 2 {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(pairs[i])
+			w.WriteString(`="`)
+			w.WriteString(escape(pairs[i+1]))
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	w.WriteString("# HELP " + name + " " + strings.ReplaceAll(help, "\n", " ") + "\n")
+	w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mu.RLock()
+	list := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		list = append(list, s)
+	}
+	f.mu.RUnlock()
+	if len(list) == 0 {
+		return
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return strings.Join(list[i].values, "\xff") < strings.Join(list[j].values, "\xff")
+	})
+
+	writeHeader(w, f.name, f.help, f.typ)
+	for _, s := range list {
+		pairs := make([]string, 0, 2*len(f.labels)+2)
+		for i, l := range f.labels {
+			pairs = append(pairs, l, s.values[i])
+		}
+
+		if f.typ != TypeHistogram {
+			writeLine(w, f.name, pairs, s.value())
+			continue
+		}
+
+		s.mu.Lock()
+		counts := append([]uint64(nil), s.counts...)
+		sum, count := s.sum, s.count
+		s.mu.Unlock()
+
+		var acc uint64
+		for i, b := range f.buckets {
+			acc += counts[i]
+			writeLine(w, f.name+"_bucket", append(pairs, "le", formatFloat(b)), float64(acc))
+		}
+		writeLine(w, f.name+"_bucket", append(pairs, "le", "+Inf"), float64(count))
+		writeLine(w, f.name+"_sum", pairs, sum)
+		writeLine(w, f.name+"_count", pairs, float64(count))
+	}
+}
+
+// Write 按名称顺序输出所有指标, 没有数据的指标不输出
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	list := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		list = append(list, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range list {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+func Write(w io.Writer) error {
+	return Default.Write(w)
+}
+
+// WriteSamples 输出采集时计算的一组值
+func WriteSamples(w io.Writer, name, help, typ string, samples ...Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	bw := bufio.NewWriter(w)
+	writeHeader(bw, name, help, typ)
+	for _, s := range samples {
+		writeLine(bw, name, s.Labels, s.Value)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+	sent := r.NewCounter("test_sent_total", "packets sent", "type")
+	depth := r.NewGauge("test_depth", "queue depth")
+	seconds := r.NewHistogram("test_seconds", "latency", []float64{0.1, 1}, "plugin")
+	r.NewCounter("test_unused_total", "no samples")
+
+	sent.With("syn").Add(3)
+	sent.With("syn").Inc()
+	sent.With(`a"b`).Inc()
+	depth.With().Set(5)
+	depth.With().Dec()
+	seconds.With("redis").Observe(0.05)
+	seconds.With("redis").Observe(0.5)
+	seconds.With("redis").Observe(2)
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, line := range []string{
+		"# TYPE test_sent_total counter",
+		`test_sent_total{type="syn"} 4`,
+		`test_sent_total{type="a\"b"} 1`,
+		"test_depth 4",
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{plugin="redis",le="0.1"} 1`,
+		`test_seconds_bucket{plugin="redis",le="1"} 2`,
+		`test_seconds_bucket{plugin="redis",le="+Inf"} 3`,
+		`test_seconds_sum{plugin="redis"} 2.55`,
+		`test_seconds_count{plugin="redis"} 3`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, out)
+		}
+	}
+	if strings.Contains(out, "test_unused_total") {
+		t.Errorf("family without samples should be skipped")
+	}
+	if strings.Index(out, "test_depth") > strings.Index(out, "test_sent_total") {
+		t.Errorf("families should be sorted by name")
+	}
+}
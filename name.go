@@ -0,0 +1,54 @@
+package radar
+
+import (
+	"net"
+	"sync"
+
+	"github.com/vela-ssoc/vela-radar/host"
+)
+
+type nameEntry struct {
+	once  sync.Once
+	names []host.Name
+}
+
+// nameTable 任务内的主机名缓存, 每个ip只解析一次
+type nameTable struct {
+	mu      sync.Mutex
+	opt     host.NameOption
+	entries map[string]*nameEntry
+}
+
+func newNameTable(opt host.NameOption) *nameTable {
+	return &nameTable{opt: opt, entries: make(map[string]*nameEntry)}
+}
+
+// Resolve 解析主机名, 并发调用时等待同一次解析的结果
+func (nt *nameTable) Resolve(ip net.IP) []host.Name {
+	key := ip.String()
+	nt.mu.Lock()
+	e, ok := nt.entries[key]
+	if !ok {
+		e = &nameEntry{}
+		nt.entries[key] = e
+	}
+	nt.mu.Unlock()
+
+	e.once.Do(func() {
+		e.names = host.ResolveNames(ip, nt.opt)
+	})
+	return e.names
+}
+
+// Cached 只返回已经解析过的结果, 不会发起新的查询
+func (nt *nameTable) Cached(ip net.IP) []host.Name {
+	nt.mu.Lock()
+	e, ok := nt.entries[ip.String()]
+	nt.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	// 等待正在进行的解析
+	e.once.Do(func() {})
+	return e.names
+}
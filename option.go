@@ -2,8 +2,10 @@ package radar
 
 import (
 	"errors"
+	"strings"
 	"time"
 
+	"github.com/vela-ssoc/vela-radar/port"
 	"github.com/vela-ssoc/vela-radar/util"
 )
 
@@ -21,6 +23,23 @@ type Option struct {
 	Screenshot       bool           `json:"screenshot"`
 	Pool             Pool           `json:"pool"`
 	ExcludeTimeRange util.TimeRange `json:"exclude_time_range"`
+	State            bool           `json:"state"`         // 记录 closed/filtered 端口状态
+	StatePorts       string         `json:"state_ports"`   // 需要逐端口记录状态的端口范围, 为空只记录统计数
+	Trace            string         `json:"trace"`         // 路径探测方式 tcp/icmp, 为空不探测
+	TraceHops        int            `json:"trace_hops"`    // 路径探测最大跳数
+	Names            bool           `json:"names"`         // 解析主机名(PTR/NetBIOS/LLMNR/mDNS)
+	Discover         string         `json:"discover"`      // 组播发现 ssdp,mdns,wsd 或者 all, 为空不发现
+	SNMP             bool           `json:"snmp"`          // 读取存活主机的 SNMP 信息
+	SNMPLearn        bool           `json:"snmp_learn"`    // ARP/路由表中的新ip追加为扫描目标
+	Anomaly          bool           `json:"anomaly"`       // tarpit/蜜罐检测
+	AnomalyCap       int            `json:"anomaly_cap"`   // 被标记的主机最多保留的开放端口数
+	Safe             bool           `json:"safe"`          // 整个任务使用安全模式
+	SafeTarget       string         `json:"safe_target"`   // 使用安全模式的ip范围
+	SafeAuto         bool           `json:"safe_auto"`     // 发现工控端口或者工控厂商设备时自动进入安全模式
+	SafeDelay        int            `json:"safe_delay"`    // 安全模式下同一主机两次探测的间隔(ms)
+	SkipSelf         bool           `json:"skip_self"`     // 跳过本机网卡地址
+	SkipGateway      bool           `json:"skip_gateway"`  // 跳过到目标的网关以及默认网关
+	SkipBoundary     bool           `json:"skip_boundary"` // 跳过网段的网络地址和广播地址
 	MinioCfg         util.MinioCfg  `json:"-"`
 }
 
@@ -70,6 +89,61 @@ func (o *Option) set_exclude_target(s string) {
 	o.ExcludedTarget = s
 }
 
+func (o *Option) set_state(enable bool, ports string) error {
+	if ports != "" {
+		if _, err := port.ParsePortRangeStr(ports); err != nil {
+			return err
+		}
+	}
+	o.State = enable
+	o.StatePorts = ports
+	return nil
+}
+
+func (o *Option) set_trace(mode string, hops int) error {
+	switch mode {
+	case "", "tcp", "icmp":
+		o.Trace = mode
+	default:
+		return errors.New("invalid trace mode, must be tcp or icmp")
+	}
+
+	if hops <= 0 || hops > 64 {
+		hops = 30
+	}
+	o.TraceHops = hops
+	return nil
+}
+
+func (o *Option) set_anomaly(enable bool, limit int) {
+	if limit <= 0 || limit > 1000 {
+		limit = anomalyDefaultCap
+	}
+	o.Anomaly = enable
+	o.AnomalyCap = limit
+}
+
+func (o *Option) set_safe_delay(n int) {
+	if n <= 0 {
+		n = safeDefaultDelay
+	} else if n > 60000 {
+		n = 60000
+	}
+	o.SafeDelay = n
+}
+
+func (o *Option) set_discover(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		switch strings.TrimSpace(v) {
+		case "", "all", "ssdp", "mdns", "wsd":
+		default:
+			return errors.New("invalid discover protocol, must be ssdp, mdns, wsd or all")
+		}
+	}
+	o.Discover = s
+	return nil
+}
+
 func (o *Option) set_ExcludeTimeRange_Daily(s string) error {
 	switch s {
 	case "daily":
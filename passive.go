@@ -0,0 +1,342 @@
+package radar
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vela-ssoc/vela-kit/audit"
+	"github.com/vela-ssoc/vela-kit/kind"
+	"github.com/vela-ssoc/vela-kit/lua"
+	"github.com/vela-ssoc/vela-kit/strutil"
+	"github.com/vela-ssoc/vela-radar/host"
+	"github.com/vela-ssoc/vela-radar/port/syn"
+	"github.com/vela-ssoc/vela-radar/report"
+	"github.com/vela-ssoc/vela-radar/util"
+)
+
+// Asset 被动监听发现的主机
+type Asset struct {
+	IP        net.IP      `json:"ip"`
+	MAC       string      `json:"mac"`
+	Names     []host.Name `json:"names"`
+	Vendor    string      `json:"vendor"`  // DHCP vendor class
+	Ports     []uint16    `json:"ports"`   // 观察到的监听端口(SYN-ACK)
+	Sources   []string    `json:"sources"` // arp/dhcp/netbios/llmnr/mdns/syn-ack
+	FirstSeen time.Time   `json:"first_seen"`
+	LastSeen  time.Time   `json:"last_seen"`
+}
+
+func (a *Asset) String() string                         { return strutil.B2S(a.Bytes()) }
+func (a *Asset) Type() lua.LValueType                   { return lua.LTObject }
+func (a *Asset) AssertFloat64() (float64, bool)         { return 0, false }
+func (a *Asset) AssertString() (string, bool)           { return "", false }
+func (a *Asset) AssertFunction() (*lua.LFunction, bool) { return nil, false }
+func (a *Asset) Peek() lua.LValue                       { return a }
+
+func (a *Asset) Bytes() []byte {
+	enc := kind.NewJsonEncoder()
+	enc.Tab("")
+	enc.KV("kind", "passive")
+	enc.KV("ip", a.IP)
+	enc.KV("mac", a.MAC)
+	enc.Raw("names", util.ToJsonBytes(a.Names))
+	enc.KV("vendor", a.Vendor)
+	enc.KV("ports", a.Ports)
+	enc.KV("sources", a.Sources)
+	enc.KV("first_seen", a.FirstSeen)
+	enc.KV("last_seen", a.LastSeen)
+	enc.End("}")
+	return enc.Bytes()
+}
+
+// merge 合并一条观察记录
+func (a *Asset) merge(o syn.Observation) {
+	a.LastSeen = time.Now()
+
+	if o.MAC != nil && a.MAC == "" {
+		a.MAC = o.MAC.String()
+	}
+	if o.Vendor != "" {
+		a.Vendor = o.Vendor
+	}
+
+	found := false
+	for _, s := range a.Sources {
+		if s == o.Source {
+			found = true
+			break
+		}
+	}
+	if !found {
+		a.Sources = append(a.Sources, o.Source)
+	}
+
+	if o.Name != "" {
+		found := false
+		for _, n := range a.Names {
+			if n.Name == o.Name && n.Source == o.Source {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a.Names = append(a.Names, host.Name{Name: o.Name, Source: o.Source})
+		}
+	}
+
+	if o.Port != 0 {
+		i := sort.Search(len(a.Ports), func(i int) bool { return a.Ports[i] >= o.Port })
+		if i == len(a.Ports) || a.Ports[i] != o.Port {
+			a.Ports = append(a.Ports, 0)
+			copy(a.Ports[i+1:], a.Ports[i:])
+			a.Ports[i] = o.Port
+		}
+	}
+}
+
+func (a *Asset) clone() *Asset {
+	dup := *a
+	dup.Names = append([]host.Name(nil), a.Names...)
+	dup.Ports = append([]uint16(nil), a.Ports...)
+	dup.Sources = append([]string(nil), a.Sources...)
+	return &dup
+}
+
+// PassiveConfig 被动监听配置
+type PassiveConfig struct {
+	Dev      string        // 监听的网卡, 为空使用默认路由所在的网卡
+	Scan     bool          // 新主机是否排队进行主动扫描
+	Port     string        // 主动扫描的端口
+	Mode     string        // 主动扫描的模式
+	Interval time.Duration // 检查扫描队列的间隔
+	Report   bool          // 新主机是否上报到 ReportHostUri
+}
+
+func newPassiveConfig(L *lua.LState) *PassiveConfig {
+	cfg := &PassiveConfig{
+		Port:     "top1000",
+		Mode:     "pn",
+		Interval: time.Minute,
+	}
+
+	if L.Get(1).Type() != lua.LTTable {
+		return cfg
+	}
+
+	L.CheckTable(1).Range(func(key string, val lua.LValue) {
+		switch key {
+		case "dev":
+			cfg.Dev = val.String()
+		case "scan":
+			cfg.Scan = lua.IsTrue(val)
+		case "port":
+			cfg.Port = val.String()
+		case "mode":
+			cfg.Mode = val.String()
+		case "interval":
+			if n := lua.IsInt(val); n >= 10 {
+				cfg.Interval = time.Duration(n) * time.Second
+			}
+		case "report":
+			cfg.Report = lua.IsTrue(val)
+		}
+	})
+	return cfg
+}
+
+const (
+	passiveMaxAssets = 65536 // 主机清单上限, 超过后不再记录新主机
+	passiveMaxQueue  = 4096  // 等待主动扫描的主机上限
+	passiveNetsTTL   = time.Minute
+)
+
+// passive 被动监听以及发现的主机清单
+type passive struct {
+	mu       sync.Mutex
+	rad      *Radar
+	cfg      *PassiveConfig
+	listener *syn.Listener
+	assets   map[string]*Asset
+	queue    []string // 等待主动扫描的新主机
+	nets     []*net.IPNet
+	netsAt   time.Time
+	ignored  uint64 // 不在直连网段的观察记录
+	dropped  uint64 // 超过上限没有记录的新主机
+	done     chan struct{}
+}
+
+// onLink 只接受本机直连网段内的主机, 通信过的路由转发/互联网地址不是本网段资产, 也不能主动扫描
+// 网卡地址每分钟刷新一次, 调用时需要持有锁
+func (p *passive) onLink(ip net.IP) bool {
+	if time.Since(p.netsAt) > passiveNetsTTL {
+		p.nets = p.nets[:0]
+		for _, ipn := range localNets() {
+			if !ipn.IP.IsLoopback() {
+				p.nets = append(p.nets, ipn)
+			}
+		}
+		p.netsAt = time.Now()
+	}
+	for _, n := range p.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *passive) observe(o syn.Observation) {
+	key := o.IP.String()
+
+	p.mu.Lock()
+	if !p.onLink(o.IP) {
+		p.ignored++
+		p.mu.Unlock()
+		return
+	}
+	a, ok := p.assets[key]
+	if !ok {
+		if len(p.assets) >= passiveMaxAssets {
+			p.dropped++
+			p.mu.Unlock()
+			return
+		}
+		a = &Asset{IP: o.IP, FirstSeen: time.Now()}
+		p.assets[key] = a
+		if p.cfg.Scan && len(p.queue) < passiveMaxQueue {
+			p.queue = append(p.queue, key)
+		}
+	}
+	a.merge(o)
+	snap := a.clone()
+	p.mu.Unlock()
+
+	if !ok {
+		p.emit(snap)
+	}
+}
+
+// emit 新主机事件
+func (p *passive) emit(a *Asset) {
+	rad := p.rad
+	audit.NewEvent("radar.passive").
+		Subject("被动发现新主机").
+		From(rad.cfg.co.CodeVM()).
+		Msg(fmt.Sprintf("ip=%s mac=%s source=%s", a.IP, a.MAC, strings.Join(a.Sources, ","))).
+		Put()
+
+	rad.cfg.Chains.Do(a, rad.cfg.co, func(err error) {
+		rad.Exception(err)
+	})
+
+	uri := ""
+	if p.cfg.Report {
+		uri = rad.cfg.ReportHostUri
+	}
+	rad.report(report.KindPassive, uri, a.Bytes())
+}
+
+// schedule 定期把排队的新主机作为一个扫描任务执行, 有任务在运行时等待下一轮
+func (p *passive) schedule() {
+	tk := time.NewTicker(p.cfg.Interval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-tk.C:
+		}
+
+		if p.rad.TaskStatus() == "working" {
+			continue
+		}
+
+		p.mu.Lock()
+		queue := p.queue
+		p.queue = nil
+		p.mu.Unlock()
+		if len(queue) == 0 {
+			continue
+		}
+
+		t := p.rad.NewTask(strings.Join(queue, ","))
+		t.Name = "passive"
+		t.Option.Port = p.cfg.Port
+		t.Option.Mode = p.cfg.Mode
+		t.Report = p.cfg.Report
+		if err := p.rad.enforce(t, "passive"); err != nil {
+			p.rad.discard(t)
+			xEnv.Errorf("radar passive scan %v", err)
+			continue
+		}
+		t.Id = uuid.NewString()
+		t.Start_time = time.Now()
+		go t.GenRun()
+		go t.executionMonitor()
+	}
+}
+
+// Assets 按ip排序的主机清单
+func (p *passive) Assets() []*Asset {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	assets := make([]*Asset, 0, len(p.assets))
+	for _, a := range p.assets {
+		assets = append(assets, a.clone())
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		return strings.Compare(string(assets[i].IP.To16()), string(assets[j].IP.To16())) < 0
+	})
+	return assets
+}
+
+func (p *passive) Bytes() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return util.ToJsonBytes(map[string]interface{}{
+		"dev":     p.listener.DevName(),
+		"hosts":   len(p.assets),
+		"queued":  len(p.queue),
+		"ignored": p.ignored,
+		"dropped": p.dropped,
+	})
+}
+
+func (p *passive) close() {
+	close(p.done)
+	p.listener.Close()
+}
+
+// startPassive 开启被动监听, 已经在监听时先关闭旧的
+func (rad *Radar) startPassive(cfg *PassiveConfig) error {
+	if rad.passive != nil {
+		rad.passive.close()
+		rad.passive = nil
+	}
+
+	p := &passive{
+		rad:    rad,
+		cfg:    cfg,
+		assets: make(map[string]*Asset),
+		done:   make(chan struct{}),
+	}
+
+	l, err := syn.NewListener(cfg.Dev, p.observe)
+	if err != nil {
+		return err
+	}
+	p.listener = l
+	rad.passive = p
+
+	if cfg.Scan {
+		go p.schedule()
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package radar
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vela-ssoc/vela-kit/audit"
+	"github.com/vela-ssoc/vela-radar/port"
+	"github.com/vela-ssoc/vela-radar/util"
+)
+
+// Policy 雷达级别的扫描范围策略, 对 lua/http/被动监听 创建的任务都生效
+// Clip 为 true 时把超出策略的参数裁剪到策略范围内, 否则拒绝任务
+type Policy struct {
+	Allow    []string `json:"allow"`     // 允许扫描的 CIDR/ip/ip范围/域名, 为空不限制
+	Deny     string   `json:"deny"`      // 禁止扫描的ip, 总是合并到任务的排除列表
+	MaxRate  int      `json:"max_rate"`  // 最大发包速率
+	MaxPorts int      `json:"max_ports"` // 最大端口数
+	MaxPool  int      `json:"max_pool"`  // ping/scan/finger 协程数上限
+	Modes    []string `json:"modes"`     // 允许的扫描模式 tcp/syn
+	Hours    []string `json:"hours"`     // 允许扫描的时间段 eg: 08:00-20:00, 22:00-06:00
+	Clip     bool     `json:"clip"`
+}
+
+// scopes 允许的范围, 域名在每次检查时解析
+func (p *Policy) scopes() *util.IPSet {
+	set := &util.IPSet{}
+	for _, item := range p.Allow {
+		if r, err := util.ParseIPRange(item); err == nil {
+			set.Add(r)
+			continue
+		}
+		ips, err := net.LookupIP(item)
+		if err != nil {
+			xEnv.Errorf("radar policy resolve %s fail %v", item, err)
+			continue
+		}
+		for _, ip := range ips {
+			if a, ok := netip.AddrFromSlice(ip); ok {
+				set.Add(util.IPRange{Lo: a.Unmap(), Hi: a.Unmap()})
+			}
+		}
+	}
+	return set
+}
+
+// clipTarget 目标与允许范围求交集, 返回保留的目标以及被裁掉的目标
+func (p *Policy) clipTarget(target string) ([]string, []string) {
+	scopes := p.scopes()
+	var keep, drop []string
+	for _, item := range strings.Split(target, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		r, err := util.ParseIPRange(item)
+		if err != nil {
+			drop = append(drop, item)
+			continue
+		}
+
+		parts := scopes.Intersect(r)
+		switch {
+		case len(parts) == 1 && parts[0] == r:
+			keep = append(keep, item)
+		case len(parts) > 0:
+			for _, c := range parts {
+				keep = append(keep, c.CIDRs()...)
+			}
+			drop = append(drop, item)
+		default:
+			drop = append(drop, item)
+		}
+	}
+	return keep, drop
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// InHours 当前是否处于允许扫描的时间段, 没有设置时间段时总是允许
+func (p *Policy) InHours(now time.Time) bool {
+	if p == nil || len(p.Hours) == 0 {
+		return true
+	}
+	cur := now.Hour()*60 + now.Minute()
+	for _, h := range p.Hours {
+		items := strings.SplitN(h, "-", 2)
+		if len(items) != 2 {
+			continue
+		}
+		begin, e1 := parseClock(items[0])
+		end, e2 := parseClock(items[1])
+		if e1 != nil || e2 != nil {
+			continue
+		}
+		if begin <= end && cur >= begin && cur < end {
+			return true
+		}
+		// 跨天 eg: 22:00-06:00
+		if begin > end && (cur >= begin || cur < end) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check 检查配置是否合法
+func (p *Policy) Check() error {
+	for _, item := range p.Allow {
+		if strings.TrimSpace(item) == "" {
+			return errors.New("policy allow item is empty")
+		}
+	}
+	if _, err := util.ParseIPSet(p.Deny); err != nil {
+		return fmt.Errorf("policy deny %v", err)
+	}
+	for _, m := range p.Modes {
+		if m != "tcp" && m != "syn" {
+			return fmt.Errorf("policy mode %s not support, use tcp/syn", m)
+		}
+	}
+	for _, h := range p.Hours {
+		items := strings.SplitN(h, "-", 2)
+		if len(items) != 2 {
+			return fmt.Errorf("policy hours %s invalid, eg: 08:00-20:00", h)
+		}
+		if _, err := parseClock(items[0]); err != nil {
+			return fmt.Errorf("policy hours %s invalid, eg: 08:00-20:00", h)
+		}
+		if _, err := parseClock(items[1]); err != nil {
+			return fmt.Errorf("policy hours %s invalid, eg: 08:00-20:00", h)
+		}
+	}
+	return nil
+}
+
+func (p *Policy) modeAllowed(mode string) bool {
+	if len(p.Modes) == 0 {
+		return true
+	}
+	if mode != "syn" {
+		mode = "tcp"
+	}
+	for _, m := range p.Modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// enforce 任务启动前按策略检查, 违反策略的参数被裁剪或者拒绝任务, 都会产生审计事件
+func (rad *Radar) enforce(t *Task, source string) error {
+	p := rad.cfg.Policy
+	if p == nil {
+		return nil
+	}
+
+	var violations []string
+	violate := func(format string, args ...interface{}) {
+		violations = append(violations, fmt.Sprintf(format, args...))
+	}
+
+	// 禁止扫描的范围总是合并到排除列表
+	if p.Deny != "" {
+		if t.Option.ExcludedTarget == "" {
+			t.Option.ExcludedTarget = p.Deny
+		} else {
+			t.Option.ExcludedTarget += "," + p.Deny
+		}
+	}
+
+	if len(p.Allow) > 0 {
+		keep, drop := p.clipTarget(t.Option.Target)
+		if len(drop) > 0 {
+			violate("target %s out of scope", strings.Join(drop, ","))
+			if p.Clip && len(keep) > 0 {
+				t.Option.Target = strings.Join(keep, ",")
+			}
+		}
+		if len(keep) == 0 {
+			rad.auditPolicy(t, source, "rejected", violations)
+			return errors.New("radar policy: no target in allowed scope")
+		}
+	}
+
+	if p.MaxRate > 0 && t.Option.Rate > p.MaxRate {
+		violate("rate %d > %d", t.Option.Rate, p.MaxRate)
+		t.Option.Rate = p.MaxRate
+	}
+
+	if p.MaxPool > 0 {
+		pools := []struct {
+			name string
+			n    *int
+		}{{"ping", &t.Option.Pool.Ping}, {"scan", &t.Option.Pool.Scan}, {"finger", &t.Option.Pool.Finger}}
+		for _, v := range pools {
+			if *v.n > p.MaxPool {
+				violate("pool %s %d > %d", v.name, *v.n, p.MaxPool)
+				*v.n = p.MaxPool
+			}
+		}
+	}
+
+	if p.MaxPorts > 0 {
+		ports, err := port.ShuffleParseAndMergeTopPorts(t.Option.Port)
+		if err == nil && len(ports) > p.MaxPorts {
+			violate("ports %d > %d", len(ports), p.MaxPorts)
+			// 保留优先级最高的端口
+			items := make([]string, 0, p.MaxPorts)
+			for _, v := range ports[:p.MaxPorts] {
+				items = append(items, strconv.Itoa(int(v)))
+			}
+			t.Option.Port = strings.Join(items, ",")
+		}
+	}
+
+	if !p.modeAllowed(t.Option.Mode) {
+		violate("mode %s not allowed", t.Option.Mode)
+		t.Option.Mode = p.Modes[0]
+	}
+
+	// 允许的时间段之外不启动, 运行中的任务在时间段外自动暂停
+	if !p.InHours(time.Now()) && !p.Clip {
+		violate("out of allowed hours %s", strings.Join(p.Hours, ","))
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	if !p.Clip {
+		rad.auditPolicy(t, source, "rejected", violations)
+		return errors.New("radar policy: " + strings.Join(violations, "; "))
+	}
+	rad.auditPolicy(t, source, "clipped", violations)
+	return nil
+}
+
+func (rad *Radar) auditPolicy(t *Task, source, action string, violations []string) {
+	msg := fmt.Sprintf("scan task %s by policy, source=%s target=%s: %s", action, source, t.Option.Target, strings.Join(violations, "; "))
+	audit.NewEvent("PortScanTask.policy").Subject("扫描策略").From(t.co.CodeVM()).Msg(msg).Log().Put()
+}
+
+// policyScope 单次检查使用的允许/禁止范围, 域名只解析一次
+type policyScope struct {
+	allow *util.IPSet // 为空不限制
+	deny  *util.IPSet
+}
+
+// scope 策略为空时返回 nil, nil 的 policyScope 允许所有地址
+func (p *Policy) scope() *policyScope {
+	if p == nil {
+		return nil
+	}
+	ps := &policyScope{deny: util.NewIPSet(p.Deny)}
+	if len(p.Allow) > 0 {
+		ps.allow = p.scopes()
+	}
+	return ps
+}
+
+func (ps *policyScope) Permit(ip net.IP) bool {
+	if ps == nil {
+		return true
+	}
+	if ps.deny.Contains(ip) {
+		return false
+	}
+	return ps.allow == nil || ps.allow.Contains(ip)
+}
+
+// filterTargets 任务运行中追加的目标(组播发现, SNMP 学习)同样按策略过滤, 被过滤的目标产生审计事件
+func (rad *Radar) filterTargets(t *Task, source string, ips []string) []string {
+	ps := rad.cfg.Policy.scope()
+	if ps == nil || len(ips) == 0 {
+		return ips
+	}
+
+	keep := ips[:0:0]
+	var drop []string
+	for _, item := range ips {
+		if ip := net.ParseIP(item); ip != nil && ps.Permit(ip) {
+			keep = append(keep, item)
+		} else {
+			drop = append(drop, item)
+		}
+	}
+	if len(drop) > 0 {
+		rad.auditPolicy(t, source, "filtered", []string{"target " + strings.Join(drop, ",") + " out of scope"})
+	}
+	return keep
+}
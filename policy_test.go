@@ -0,0 +1,30 @@
+package radar
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicy_clipTarget(t *testing.T) {
+	p := &Policy{Allow: []string{"10.1.0.0/16", "192.168.1.10-20"}}
+	keep, drop := p.clipTarget("10.0.0.0/8,10.1.2.3,172.16.0.1,192.168.1.12-15")
+
+	if got := strings.Join(keep, ","); got != "10.1.0.0/16,10.1.2.3,192.168.1.12-15" {
+		t.Errorf("keep got %s", got)
+	}
+	if got := strings.Join(drop, ","); got != "10.0.0.0/8,172.16.0.1" {
+		t.Errorf("drop got %s", got)
+	}
+}
+
+func TestPolicy_InHours(t *testing.T) {
+	p := &Policy{Hours: []string{"22:00-06:00"}}
+	at := func(h int) time.Time { return time.Date(2026, 1, 1, h, 0, 0, 0, time.Local) }
+	if !p.InHours(at(23)) || !p.InHours(at(5)) || p.InHours(at(12)) {
+		t.Error("overnight hours mismatch")
+	}
+	if !(*Policy)(nil).InHours(at(12)) {
+		t.Error("nil policy should always allow")
+	}
+}
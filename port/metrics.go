@@ -0,0 +1,19 @@
+package port
+
+import "github.com/vela-ssoc/vela-radar/metrics"
+
+// syn/tcp 扫描器的指标
+var (
+	MetricPacketsSent = metrics.NewCounter("radar_packets_sent_total",
+		"Packets written to the pcap handle by the syn scanner.", "type")
+	MetricSendErrors = metrics.NewCounter("radar_packet_send_errors_total",
+		"Packets the syn scanner failed to serialize or write.", "type")
+	MetricReplies = metrics.NewCounter("radar_port_replies_total",
+		"Port probe answers by scanner and port state, open means SYN-ACK or connected.", "scanner", "state")
+	MetricArpTimeouts = metrics.NewCounter("radar_arp_timeouts_total",
+		"ARP requests without a reply within 600ms.")
+	MetricPcapDropped = metrics.NewCounter("radar_pcap_dropped_total",
+		"Packets dropped by the kernel or the interface before pcap read them.", "reason")
+	MetricConnectSeconds = metrics.NewHistogram("radar_tcp_connect_seconds",
+		"Duration of tcp connect probes.", nil, "state")
+)
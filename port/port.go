@@ -6,7 +6,9 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/vela-ssoc/vela-kit/lua"
 	"github.com/vela-ssoc/vela-radar/util"
 )
 
@@ -17,10 +19,34 @@ type Scanner interface {
 	WaitLimiter() error
 }
 
+// State 端口状态
+type State uint8
+
+const (
+	Open     State = iota // 收到 SYN/ACK 或者连接成功
+	Closed                // 收到 RST 或者连接被拒绝
+	Filtered              // 没有响应或者收到 ICMP 不可达
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case Closed:
+		return "closed"
+	case Filtered:
+		return "filtered"
+	default:
+		return "unknown"
+	}
+}
+
 // OpenIpPort retChan
 type OpenIpPort struct {
 	Ip       net.IP
 	Port     uint16
+	State    State
+	RTT      time.Duration // 连接耗时, 仅 tcp 全连接扫描
 	Service  string
 	HttpInfo *HttpInfo
 }
@@ -46,6 +72,8 @@ type Option struct {
 	Rate    int    // 每秒速度限制, 单位: s, 会在1s内平均发送, 相当于每个包之间的延迟
 	Timeout int    // TCP连接响应延迟, 单位: ms
 	NextHop string // pcap dev name
+	States  bool   // 是否回调 closed/filtered 状态的端口
+	Trace   bool   // 是否接收 traceroute 的响应(icmp time exceeded)
 }
 
 // HttpInfo Http服务基础信息
@@ -92,6 +120,55 @@ func (hi *HttpInfo) String() string {
 	return util.ToJsonStr(hi)
 }
 
+func (hi *HttpInfo) Type() lua.LValueType                   { return lua.LTObject }
+func (hi *HttpInfo) AssertFloat64() (float64, bool)         { return 0, false }
+func (hi *HttpInfo) AssertString() (string, bool)           { return "", false }
+func (hi *HttpInfo) AssertFunction() (*lua.LFunction, bool) { return nil, false }
+func (hi *HttpInfo) Peek() lua.LValue                       { return hi }
+
+func luaStrings(L *lua.LState, list []string) *lua.LTable {
+	tab := L.CreateTable(len(list), 0)
+	for _, v := range list {
+		tab.Append(lua.LString(v))
+	}
+	return tab
+}
+
+// Index lua 中按字段读取, eg: info.title, info.fingerprints[1]
+func (hi *HttpInfo) Index(L *lua.LState, key string) lua.LValue {
+	switch key {
+	case "status_code":
+		return lua.LNumber(hi.StatusCode)
+	case "content_length":
+		return lua.LNumber(hi.ContentLength)
+	case "url":
+		return lua.LString(hi.URL)
+	case "location":
+		return lua.LString(hi.Location)
+	case "title":
+		return lua.LString(hi.Title)
+	case "server":
+		return lua.LString(hi.Server)
+	case "body":
+		return lua.LString(hi.Body)
+	case "header":
+		return lua.LString(hi.Header)
+	case "favicon_mh3":
+		return lua.LString(hi.FaviconMH3)
+	case "favicon_md5":
+		return lua.LString(hi.FaviconMD5)
+	case "screenshot_url":
+		return lua.LString(hi.ScreenshotURL)
+	case "fingerprints":
+		return luaStrings(L, hi.Fingerprints)
+	case "tls_common_name":
+		return lua.LString(hi.TLSCommonName)
+	case "tls_dns_names":
+		return luaStrings(L, hi.TLSDNSNames)
+	}
+	return lua.LNil
+}
+
 // ParsePortRangeStr 解析端口字符串
 func ParsePortRangeStr(portStr string) (out [][]uint16, err error) {
 	portsStrGroup := strings.Split(portStr, ",")
@@ -122,14 +199,23 @@ func ParsePortRangeStr(portStr string) (out [][]uint16, err error) {
 	return
 }
 
-// IsInPortRange 判断port是否在端口范围里
-func IsInPortRange(port uint16, portRanges [][]uint16) bool {
+// PortSet 端口位图, 判断端口是否在范围里只需要一次位运算
+type PortSet [65536 / 64]uint64
+
+// NewPortSet 由 ParsePortRangeStr 的结果生成端口位图
+func NewPortSet(portRanges [][]uint16) *PortSet {
+	s := new(PortSet)
 	for _, portRange := range portRanges {
-		if port >= portRange[0] && port <= portRange[1] {
-			return true
+		for p := int(portRange[0]); p <= int(portRange[1]); p++ {
+			s[p/64] |= 1 << uint(p%64)
 		}
 	}
-	return false
+	return s
+}
+
+// Has 判断port是否在端口范围里
+func (s *PortSet) Has(port uint16) bool {
+	return s != nil && s[port/64]&(1<<(port%64)) != 0
 }
 
 // ShuffleParseAndMergeTopPorts shuffle parse portStr and merge TopTcpPorts
@@ -146,6 +232,7 @@ func ShuffleParseAndMergeTopPorts(portStr string) (ports []uint16, err error) {
 	if err != nil {
 		return
 	}
+	portSet := NewPortSet(portRanges)
 	// 优先发送top 1000端口
 	selectTopPort := make(map[uint16]struct{}) // TopPort
 	hasTopStr_200 := strings.Contains(portStr, "top200")
@@ -159,13 +246,13 @@ func ShuffleParseAndMergeTopPorts(portStr string) (ports []uint16, err error) {
 		TopTcpPorts = TopTcpPorts_5000
 	}
 	for _, _port := range TopTcpPorts {
-		if hasTopStr_5000 || IsInPortRange(_port, portRanges) {
+		if hasTopStr_5000 || portSet.Has(_port) {
 			selectTopPort[_port] = struct{}{}
 			ports = append(ports, _port)
-		} else if hasTopStr_1000 || IsInPortRange(_port, portRanges) {
+		} else if hasTopStr_1000 || portSet.Has(_port) {
 			selectTopPort[_port] = struct{}{}
 			ports = append(ports, _port)
-		} else if hasTopStr_200 || IsInPortRange(_port, portRanges) {
+		} else if hasTopStr_200 || portSet.Has(_port) {
 			selectTopPort[_port] = struct{}{}
 			ports = append(ports, _port)
 		}
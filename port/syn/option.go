@@ -3,6 +3,7 @@ package syn
 import (
 	"errors"
 	"github.com/vela-ssoc/vela-radar/port"
+	"net"
 )
 
 var ErrorNoSyn = errors.New("no syn support")
@@ -11,3 +12,38 @@ var DefaultSynOption = port.Option{
 	Rate:    500,
 	Timeout: 800,
 }
+
+// Hop traceroute 中的一跳
+type Hop struct {
+	TTL int    `json:"ttl"`
+	IP  string `json:"ip"`
+	RTT int64  `json:"rtt"` // ms
+}
+
+// TraceResult traceroute 结果
+type TraceResult struct {
+	Target  string `json:"target"`
+	Mode    string `json:"mode"`
+	Hops    []Hop  `json:"hops"`
+	LastHop string `json:"last_hop"` // 最后一个有响应的节点
+	Reached bool   `json:"reached"`  // 目标是否有响应
+}
+
+const (
+	PassiveARP     = "arp"
+	PassiveDHCP    = "dhcp"
+	PassiveNetbios = "netbios"
+	PassiveLLMNR   = "llmnr"
+	PassiveMDNS    = "mdns"
+	PassiveSynAck  = "syn-ack"
+)
+
+// Observation 被动监听观察到的一条主机信息
+type Observation struct {
+	Source string           // arp/dhcp/netbios/llmnr/mdns/syn-ack
+	IP     net.IP           // 主机ip
+	MAC    net.HardwareAddr // 主机mac, 跨网段的报文为网关mac
+	Name   string           // 主机名
+	Vendor string           // DHCP vendor class
+	Port   uint16           // 观察到的监听端口
+}
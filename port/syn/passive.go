@@ -0,0 +1,246 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// 只监听广播/组播的发现协议和 SYN-ACK, 不发送任何报文
+const passiveFilter = "arp" +
+	" || (udp && (port 67 || port 68 || port 137 || port 5353 || port 5355))" +
+	" || tcp[tcpflags] & (tcp-syn|tcp-ack) == (tcp-syn|tcp-ack)"
+
+// Listener 被动监听网段流量, 从 ARP/DHCP/NetBIOS/LLMNR/mDNS/SYN-ACK 中提取主机信息
+type Listener struct {
+	devName  string
+	handle   *pcap.Handle
+	callback func(Observation)
+	closed   uint32
+}
+
+// NewListener devName 为空时使用默认路由所在的网卡
+func NewListener(devName string, callback func(Observation)) (*Listener, error) {
+	if devName == "" {
+		_, _, _, dev, err := GetRouterV4(net.IPv4(1, 1, 1, 1))
+		if err != nil {
+			return nil, err
+		}
+		devName = dev
+	}
+
+	// 开启混杂模式以便看到网段内其他主机的流量, 1s 超时用于检查关闭状态
+	handle, err := pcap.OpenLive(devName, 1600, true, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if err = handle.SetBPFFilter(passiveFilter); err != nil {
+		handle.Close()
+		return nil, err
+	}
+
+	l := &Listener{devName: devName, handle: handle, callback: callback}
+	go l.recv()
+	return l, nil
+}
+
+func (l *Listener) DevName() string {
+	return l.devName
+}
+
+func (l *Listener) Close() {
+	if atomic.CompareAndSwapUint32(&l.closed, 0, 1) {
+		l.handle.Close()
+	}
+}
+
+func (l *Listener) recv() {
+	var (
+		ethLayer layers.Ethernet
+		ipLayer  layers.IPv4
+		tcpLayer layers.TCP
+		udpLayer layers.UDP
+		arpLayer layers.ARP
+		found    []gopacket.LayerType
+	)
+
+	parser := gopacket.NewDecodingLayerParser(
+		layers.LayerTypeEthernet,
+		&ethLayer,
+		&ipLayer,
+		&tcpLayer,
+		&udpLayer,
+		&arpLayer,
+	)
+	parser.IgnoreUnsupported = true
+
+	for atomic.LoadUint32(&l.closed) == 0 {
+		data, _, err := l.handle.ReadPacketData()
+		if err != nil {
+			if err == io.EOF {
+				return
+			}
+			continue
+		}
+
+		if err = parser.DecodeLayers(data, &found); err != nil || len(found) == 0 {
+			continue
+		}
+
+		switch found[len(found)-1] {
+		case layers.LayerTypeARP:
+			l.arp(&arpLayer)
+		case layers.LayerTypeTCP:
+			if tcpLayer.SYN && tcpLayer.ACK {
+				l.emit(Observation{
+					Source: PassiveSynAck,
+					IP:     ipLayer.SrcIP,
+					MAC:    ethLayer.SrcMAC,
+					Port:   uint16(tcpLayer.SrcPort),
+				})
+			}
+		case layers.LayerTypeUDP:
+			l.udp(ethLayer.SrcMAC, ipLayer.SrcIP, &udpLayer)
+		}
+	}
+}
+
+// emit 复制报文中的切片后回调, 解析器会复用底层数组
+func (l *Listener) emit(o Observation) {
+	ip := o.IP.To4()
+	if ip == nil || ip.IsUnspecified() || ip.IsLoopback() || ip.IsMulticast() || ip.Equal(net.IPv4bcast) {
+		return
+	}
+	o.IP = append(net.IP(nil), ip...)
+	if o.MAC != nil {
+		o.MAC = append(net.HardwareAddr(nil), o.MAC...)
+	}
+	l.callback(o)
+}
+
+func (l *Listener) arp(a *layers.ARP) {
+	l.emit(Observation{
+		Source: PassiveARP,
+		IP:     a.SourceProtAddress,
+		MAC:    a.SourceHwAddress,
+	})
+}
+
+func (l *Listener) udp(mac net.HardwareAddr, src net.IP, udp *layers.UDP) {
+	switch {
+	case udp.DstPort == 67 || udp.SrcPort == 68:
+		l.dhcp(udp.Payload)
+	case udp.SrcPort == 137 || udp.DstPort == 137:
+		l.netbios(mac, src, udp.Payload)
+	case udp.SrcPort == 5353:
+		l.dns(PassiveMDNS, mac, src, udp.Payload)
+	case udp.SrcPort == 5355:
+		l.dns(PassiveLLMNR, mac, src, udp.Payload)
+	}
+}
+
+// dhcp 客户端请求中携带的主机名和 vendor class
+func (l *Listener) dhcp(payload []byte) {
+	var d layers.DHCPv4
+	if err := d.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil {
+		return
+	}
+	if d.Operation != layers.DHCPOpRequest {
+		return
+	}
+
+	o := Observation{Source: PassiveDHCP, IP: d.ClientIP, MAC: d.ClientHWAddr}
+	for _, opt := range d.Options {
+		switch opt.Type {
+		case layers.DHCPOptHostname:
+			o.Name = string(opt.Data)
+		case layers.DHCPOptClassID:
+			o.Vendor = string(opt.Data)
+		case layers.DHCPOptRequestIP:
+			if o.IP.IsUnspecified() && len(opt.Data) == 4 {
+				o.IP = net.IP(opt.Data)
+			}
+		}
+	}
+	l.emit(o)
+}
+
+// netbios 名称注册/刷新以及查询响应中的名称属于发送方
+func (l *Listener) netbios(mac net.HardwareAddr, src net.IP, payload []byte) {
+	var d layers.DNS
+	if err := d.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil {
+		return
+	}
+
+	var name []byte
+	switch {
+	case d.QR && len(d.Answers) > 0:
+		name = d.Answers[0].Name
+	case d.OpCode == 5 || d.OpCode == 8 || d.OpCode == 9: // registration, refresh
+		if len(d.Questions) > 0 {
+			name = d.Questions[0].Name
+		}
+	}
+
+	n, err := decodeNetbiosName(name)
+	if err != nil {
+		return
+	}
+	l.emit(Observation{Source: PassiveNetbios, IP: src, MAC: mac, Name: n})
+}
+
+// dns mDNS/LLMNR 响应中的 A 记录
+func (l *Listener) dns(source string, mac net.HardwareAddr, src net.IP, payload []byte) {
+	var d layers.DNS
+	if err := d.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil || !d.QR {
+		return
+	}
+
+	records := append(d.Answers, d.Additionals...)
+	for _, rr := range records {
+		if rr.Type != layers.DNSTypeA || rr.IP == nil {
+			continue
+		}
+		o := Observation{Source: source, IP: rr.IP, Name: strings.TrimSuffix(string(rr.Name), ".local")}
+		if rr.IP.Equal(src) {
+			o.MAC = mac
+		}
+		l.emit(o)
+	}
+}
+
+// decodeNetbiosName 解码 first-level encoding 的 NetBIOS 名称
+func decodeNetbiosName(raw []byte) (string, error) {
+	label := raw
+	if i := strings.IndexByte(string(raw), '.'); i >= 0 {
+		label = raw[:i]
+	}
+	if len(label) != 32 {
+		return "", errors.New("invalid netbios name")
+	}
+
+	name := make([]byte, 16)
+	for i := 0; i < 16; i++ {
+		hi, lo := label[2*i]-'A', label[2*i+1]-'A'
+		if hi > 15 || lo > 15 {
+			return "", errors.New("invalid netbios name")
+		}
+		name[i] = hi<<4 | lo
+	}
+
+	// 最后一个字节为后缀
+	n := strings.TrimSpace(string(name[:15]))
+	if n == "" || n == "*" {
+		return "", errors.New("empty netbios name")
+	}
+	return n, nil
+}
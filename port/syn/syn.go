@@ -4,6 +4,7 @@ package syn
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/google/gopacket"
@@ -45,7 +46,14 @@ type SynScanner struct {
 	ctx            context.Context
 	watchIpStatusT *watchIpStatusTable // IpStatusCacheTable
 	watchMacCacheT *watchMacCacheTable // MacCaches
+	traceT         *traceTable         // running traceroute
 	isDone         bool
+
+	// last pcap stats, used to count the dropped packets
+	statsMu   sync.Mutex
+	statsTime time.Time
+	dropped   int
+	ifDropped int
 }
 
 // NewSynScanner firstIp: Used to select routes; openPortChan: Result return channel
@@ -99,6 +107,7 @@ func NewSynScanner(firstIp net.IP, callback func(port.OpenIpPort), option port.O
 		ctx:            context.Background(),
 		watchIpStatusT: newWatchIpStatusTable(time.Duration(option.Timeout)),
 		watchMacCacheT: newWatchMacCacheTable(),
+		traceT:         newTraceTable(),
 	}
 	// Pcap
 	// 每个包最大读取长度1024, 不开启混杂模式, no TimeOut
@@ -107,7 +116,16 @@ func NewSynScanner(firstIp net.IP, callback func(port.OpenIpPort), option port.O
 		return
 	}
 	// Set filter, Reduce the number of monitoring packets
-	handle.SetBPFFilter(fmt.Sprintf("ether dst %s && (arp || tcp[tcpflags] == tcp-syn|tcp-ack)", srcMac.String()))
+	filter := "arp || tcp[tcpflags] == tcp-syn|tcp-ack"
+	if option.States {
+		// closed: RST, filtered: ICMP unreachable
+		filter += " || tcp[tcpflags] & tcp-rst != 0 || icmp[icmptype] == icmp-unreach"
+	}
+	if option.Trace {
+		// time exceeded, echo reply and the answer of the target
+		filter += " || icmp || (tcp[tcpflags] & tcp-rst != 0 && tcp dst portrange " + traceBPFPorts + ")"
+	}
+	handle.SetBPFFilter(fmt.Sprintf("ether dst %s && (%s)", srcMac.String(), filter))
 	ss.handle = handle
 
 	// start listen recv
@@ -144,20 +162,9 @@ func (ss *SynScanner) Scan(dstIp net.IP, dst uint16) (err error) {
 	ss.watchIpStatusT.UpdateLastTime(ipStr)
 
 	// First off, get the MAC address we should be sending packets to.
-	var dstMac net.HardwareAddr
-	if ss.gwMac != nil {
-		dstMac = ss.gwMac
-	} else {
-		// 内网IP
-		mac := ss.watchMacCacheT.GetMac(ipStr)
-		if mac != nil {
-			dstMac = mac
-		} else {
-			dstMac, err = ss.getHwAddrV4(dstIp)
-			if err != nil {
-				return
-			}
-		}
+	dstMac, err := ss.dstMac(dstIp)
+	if err != nil {
+		return
 	}
 
 	// Construct all the network layers we need.
@@ -259,6 +266,7 @@ func (ss *SynScanner) Close() {
 			buf.Clear()
 			ss.bufPool.Put(buf)
 		}
+		ss.pcapStats(true)
 		ss.handle.Close()
 	}
 	if ss.watchMacCacheT != nil {
@@ -276,6 +284,19 @@ func (ss *SynScanner) WaitLimiter() error {
 	return ss.limiter.Wait(ss.ctx)
 }
 
+// dstMac get the next hop mac addr, the gateway or the target itself on the same segment
+func (ss *SynScanner) dstMac(dstIp net.IP) (net.HardwareAddr, error) {
+	if ss.gwMac != nil {
+		return ss.gwMac, nil
+	}
+	// 内网IP
+	mac := ss.watchMacCacheT.GetMac(dstIp.String())
+	if mac != nil {
+		return mac, nil
+	}
+	return ss.getHwAddrV4(dstIp)
+}
+
 // GetDevName Get the device name after the route selection
 func (ss SynScanner) GetDevName() string {
 	return ss.devName
@@ -321,6 +342,7 @@ func (ss *SynScanner) getHwAddrV4(arpDst net.IP) (mac net.HardwareAddr, err erro
 		}
 		// Wait 600 ms for an ARP reply.
 		if time.Since(start) > time.Millisecond*600 {
+			port.MetricArpTimeouts.With().Inc()
 			return nil, errors.New("timeout getting ARP reply")
 		}
 		retry += 1
@@ -334,6 +356,33 @@ func (ss *SynScanner) getHwAddrV4(arpDst net.IP) (mac net.HardwareAddr, err erro
 	}
 }
 
+// packetType the metric label of a packet, by its last layer
+func packetType(l []gopacket.SerializableLayer) string {
+	switch v := l[len(l)-1].(type) {
+	case *layers.TCP:
+		if v.RST {
+			return "rst"
+		}
+		return "syn"
+	case *layers.ARP:
+		return "arp"
+	case *layers.ICMPv4:
+		return "icmp"
+	}
+	return "other"
+}
+
+// count record the result of writing a packet
+func count(l []gopacket.SerializableLayer, err error) error {
+	typ := packetType(l)
+	if err != nil {
+		port.MetricSendErrors.With(typ).Inc()
+		return err
+	}
+	port.MetricPacketsSent.With(typ).Inc()
+	return nil
+}
+
 // send sends the given layers as a single packet on the network.
 func (ss *SynScanner) send(l ...gopacket.SerializableLayer) error {
 	buf := ss.bufPool.Get().(gopacket.SerializeBuffer)
@@ -342,9 +391,9 @@ func (ss *SynScanner) send(l ...gopacket.SerializableLayer) error {
 		ss.bufPool.Put(buf)
 	}()
 	if err := gopacket.SerializeLayers(buf, ss.opts, l...); err != nil {
-		return err
+		return count(l, err)
 	}
-	return ss.handle.WritePacketData(buf.Bytes())
+	return count(l, ss.handle.WritePacketData(buf.Bytes()))
 }
 
 // send sends the given layers as a single packet on the network., need fix padding
@@ -355,9 +404,31 @@ func (ss *SynScanner) sendArp(l ...gopacket.SerializableLayer) error {
 		ss.bufPool.Put(buf)
 	}()
 	if err := gopacket.SerializeLayers(buf, ss.opts, l...); err != nil {
-		return err
+		return count(l, err)
+	}
+	return count(l, ss.handle.WritePacketData(buf.Bytes()[:42])) // need fix padding
+}
+
+// pcapStats add the packets dropped since the last call to the metrics, at most once per second unless force
+func (ss *SynScanner) pcapStats(force bool) {
+	ss.statsMu.Lock()
+	defer ss.statsMu.Unlock()
+	if !force && time.Since(ss.statsTime) < time.Second {
+		return
+	}
+	ss.statsTime = time.Now()
+
+	st, err := ss.handle.Stats()
+	if err != nil || st == nil {
+		return
 	}
-	return ss.handle.WritePacketData(buf.Bytes()[:42]) // need fix padding
+	if d := st.PacketsDropped - ss.dropped; d > 0 {
+		port.MetricPcapDropped.With("kernel").Add(float64(d))
+	}
+	if d := st.PacketsIfDropped - ss.ifDropped; d > 0 {
+		port.MetricPcapDropped.With("interface").Add(float64(d))
+	}
+	ss.dropped, ss.ifDropped = st.PacketsDropped, st.PacketsIfDropped
 }
 
 // recv packet on the network.
@@ -386,6 +457,7 @@ func (ss *SynScanner) recv() {
 	var ipLayer layers.IPv4
 	var tcpLayer layers.TCP
 	var arpLayer layers.ARP
+	var icmpLayer layers.ICMPv4
 	var ethLayer layers.Ethernet
 	var foundLayerTypes []gopacket.LayerType
 
@@ -396,6 +468,7 @@ func (ss *SynScanner) recv() {
 		&ipLayer,
 		&tcpLayer,
 		&arpLayer,
+		&icmpLayer,
 	)
 
 	// global var
@@ -418,6 +491,7 @@ func (ss *SynScanner) recv() {
 		if ss.isDone {
 			return
 		}
+		ss.pcapStats(false)
 
 		// Decode TCP or ARP Packet
 		err = parser.DecodeLayers(data, &foundLayerTypes)
@@ -435,6 +509,24 @@ func (ss *SynScanner) recv() {
 			continue
 		}
 
+		// icmp unreachable, the payload carries the ip header and tcp ports of our probe
+		if foundLayerTypes[len(foundLayerTypes)-1] == layers.LayerTypeICMPv4 {
+			if ss.option.Trace && ss.traceICMP(ipLayer.SrcIP, &icmpLayer) {
+				continue
+			}
+			if icmpLayer.TypeCode.Type() == layers.ICMPv4TypeDestinationUnreachable {
+				ss.unreachable(icmpLayer.Payload)
+			}
+			continue
+		}
+
+		// the target answered a tcp traceroute probe
+		if ss.option.Trace && isTracePort(uint16(tcpLayer.DstPort)) {
+			ss.traceT.reply(ipLayer.SrcIP, ipLayer.SrcIP, int(tcpLayer.DstPort)-traceBasePort, true)
+			tcpLayer.DstPort = 0
+			continue
+		}
+
 		// tcp Match ip and port
 		if tcpLayer.DstPort != 0 && tcpLayer.DstPort >= 49000 && tcpLayer.DstPort <= 59000 {
 			ip = ipLayer.SrcIP.String()
@@ -449,6 +541,7 @@ func (ss *SynScanner) recv() {
 			ss.watchIpStatusT.RecordPort(ip, src) // record
 
 			if tcpLayer.SYN && tcpLayer.ACK {
+				port.MetricReplies.With("syn", port.Open.String()).Inc()
 				ss.callback(port.OpenIpPort{
 					Ip:   ipLayer.SrcIP,
 					Port: src,
@@ -463,8 +556,48 @@ func (ss *SynScanner) recv() {
 				tcp.Seq = tcpLayer.Ack
 				tcp.SetNetworkLayerForChecksum(&ip4)
 				ss.send(&eth, &ip4, &tcp)
+			} else if tcpLayer.RST && ss.option.States {
+				port.MetricReplies.With("syn", port.Closed.String()).Inc()
+				ss.callback(port.OpenIpPort{
+					Ip:    ipLayer.SrcIP,
+					Port:  src,
+					State: port.Closed,
+				})
 			}
 			tcpLayer.DstPort = 0 // clean tcp parse status
 		}
 	}
 }
+
+// unreachable handle the original datagram quoted by an icmp unreachable message
+func (ss *SynScanner) unreachable(payload []byte) {
+	if !ss.option.States || len(payload) < 20 {
+		return
+	}
+
+	ihl := int(payload[0]&0x0f) * 4
+	if payload[9] != uint8(layers.IPProtocolTCP) || len(payload) < ihl+4 {
+		return
+	}
+
+	sport := binary.BigEndian.Uint16(payload[ihl : ihl+2])
+	dport := binary.BigEndian.Uint16(payload[ihl+2 : ihl+4])
+	if sport < 49000 || sport > 59000 {
+		return
+	}
+
+	dst := make(net.IP, 4)
+	copy(dst, payload[16:20])
+	ip := dst.String()
+	if !ss.watchIpStatusT.HasIp(ip) || ss.watchIpStatusT.HasPort(ip, dport) {
+		return
+	}
+	ss.watchIpStatusT.RecordPort(ip, dport)
+
+	port.MetricReplies.With("syn", port.Filtered.String()).Inc()
+	ss.callback(port.OpenIpPort{
+		Ip:    dst,
+		Port:  dport,
+		State: port.Filtered,
+	})
+}
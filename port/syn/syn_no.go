@@ -5,6 +5,7 @@ package syn
 import (
 	"github.com/vela-ssoc/vela-radar/port"
 	"net"
+	"time"
 )
 
 type synScanner struct {
@@ -27,3 +28,21 @@ func (ss *synScanner) Close() {}
 func GetAllDevs() (string, error) {
 	return "", ErrorNoSyn
 }
+
+func (ss *synScanner) Trace(dstIp net.IP, mode string, dport uint16, maxHops int, timeout time.Duration) (*TraceResult, error) {
+	return nil, ErrorNoSyn
+}
+
+type Listener struct {
+}
+
+func NewListener(devName string, callback func(Observation)) (*Listener, error) {
+	return nil, ErrorNoSyn
+}
+
+func (l *Listener) DevName() string { return "" }
+func (l *Listener) Close()          {}
+
+func GetRouterV4(dst net.IP) (srcIp net.IP, srcMac net.HardwareAddr, gw net.IP, devName string, err error) {
+	return nil, nil, nil, "", ErrorNoSyn
+}
@@ -0,0 +1,243 @@
+//go:build !nosyn
+
+package syn
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	traceBasePort = 60000 // tcp 探测的源端口为 traceBasePort + ttl
+	traceBPFPorts = "60001-60255"
+	traceIcmpId   = 0x7261 // icmp echo 探测的 id
+)
+
+func isTracePort(p uint16) bool {
+	return p > traceBasePort && p <= traceBasePort+255
+}
+
+type traceReply struct {
+	ttl     int
+	ip      net.IP
+	reached bool
+	at      time.Time
+}
+
+// traceTable 正在进行 traceroute 的目标, key为目标ip
+type traceTable struct {
+	lock    sync.Mutex
+	waiters map[string]chan traceReply
+}
+
+func newTraceTable() *traceTable {
+	return &traceTable{waiters: make(map[string]chan traceReply)}
+}
+
+func (w *traceTable) add(dst string) (chan traceReply, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if _, ok := w.waiters[dst]; ok {
+		return nil, errors.New("traceroute of this ip is running")
+	}
+	ch := make(chan traceReply, 256)
+	w.waiters[dst] = ch
+	return ch, nil
+}
+
+func (w *traceTable) del(dst string) {
+	w.lock.Lock()
+	delete(w.waiters, dst)
+	w.lock.Unlock()
+}
+
+// reply 把响应投递给对应目标的 traceroute, 没有在等待的直接丢弃
+func (w *traceTable) reply(dst net.IP, from net.IP, ttl int, reached bool) {
+	if ttl <= 0 || ttl > 255 {
+		return
+	}
+	w.lock.Lock()
+	ch, ok := w.waiters[dst.String()]
+	w.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	ip := make(net.IP, len(from))
+	copy(ip, from)
+	select {
+	case ch <- traceReply{ttl: ttl, ip: ip, reached: reached, at: time.Now()}:
+	default:
+	}
+}
+
+// traceICMP 处理 traceroute 相关的 icmp 报文, 返回 false 表示不是 traceroute 的响应
+func (ss *SynScanner) traceICMP(src net.IP, icmp *layers.ICMPv4) bool {
+	switch icmp.TypeCode.Type() {
+	case layers.ICMPv4TypeEchoReply:
+		if icmp.Id != traceIcmpId {
+			return false
+		}
+		ss.traceT.reply(src, src, int(icmp.Seq), true)
+		return true
+
+	case layers.ICMPv4TypeTimeExceeded, layers.ICMPv4TypeDestinationUnreachable:
+		dst, ttl, ok := traceQuote(icmp.Payload)
+		if !ok {
+			return false
+		}
+		// 目标自己回复的不可达也算到达
+		reached := icmp.TypeCode.Type() == layers.ICMPv4TypeDestinationUnreachable && dst.Equal(src)
+		ss.traceT.reply(dst, src, ttl, reached)
+		return true
+	}
+	return false
+}
+
+// traceQuote 从 icmp 引用的原始报文中解析出 traceroute 探测的目标和 ttl
+func traceQuote(payload []byte) (net.IP, int, bool) {
+	if len(payload) < 20 {
+		return nil, 0, false
+	}
+	ihl := int(payload[0]&0x0f) * 4
+	if len(payload) < ihl+8 {
+		return nil, 0, false
+	}
+	dst := net.IP(payload[16:20])
+
+	switch layers.IPProtocol(payload[9]) {
+	case layers.IPProtocolTCP:
+		sport := binary.BigEndian.Uint16(payload[ihl : ihl+2])
+		if !isTracePort(sport) {
+			return nil, 0, false
+		}
+		return dst, int(sport) - traceBasePort, true
+	case layers.IPProtocolICMPv4:
+		if payload[ihl] != layers.ICMPv4TypeEchoRequest {
+			return nil, 0, false
+		}
+		if binary.BigEndian.Uint16(payload[ihl+4:ihl+6]) != traceIcmpId {
+			return nil, 0, false
+		}
+		return dst, int(binary.BigEndian.Uint16(payload[ihl+6 : ihl+8])), true
+	}
+	return nil, 0, false
+}
+
+// Trace TTL 递增的 traceroute, mode 为 tcp(SYN 到 dport) 或者 icmp(echo)
+// 所有 TTL 的探测一次性发出, 在 timeout 内收集响应
+func (ss *SynScanner) Trace(dstIp net.IP, mode string, dport uint16, maxHops int, timeout time.Duration) (*TraceResult, error) {
+	if ss.isDone {
+		return nil, errors.New("scanner is closed")
+	}
+	if !ss.option.Trace {
+		return nil, errors.New("scanner not enable trace")
+	}
+
+	dstIp = dstIp.To4()
+	if dstIp == nil {
+		return nil, errors.New("is not ipv4")
+	}
+	if maxHops <= 0 || maxHops > 255 {
+		maxHops = 30
+	}
+
+	dstMac, err := ss.dstMac(dstIp)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := ss.traceT.add(dstIp.String())
+	if err != nil {
+		return nil, err
+	}
+	defer ss.traceT.del(dstIp.String())
+
+	eth := layers.Ethernet{
+		SrcMAC:       ss.srcMac,
+		DstMAC:       dstMac,
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+
+	sent := make([]time.Time, maxHops+1)
+	for ttl := 1; ttl <= maxHops; ttl++ {
+		ip4 := layers.IPv4{
+			SrcIP:   ss.srcIp,
+			DstIP:   dstIp,
+			Version: 4,
+			TTL:     uint8(ttl),
+			Id:      uint16(traceBasePort + ttl),
+		}
+
+		sent[ttl] = time.Now()
+		switch mode {
+		case "icmp":
+			ip4.Protocol = layers.IPProtocolICMPv4
+			icmp := layers.ICMPv4{
+				TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0),
+				Id:       traceIcmpId,
+				Seq:      uint16(ttl),
+			}
+			err = ss.send(&eth, &ip4, &icmp)
+		default:
+			ip4.Protocol = layers.IPProtocolTCP
+			tcp := layers.TCP{
+				SrcPort: layers.TCPPort(traceBasePort + ttl),
+				DstPort: layers.TCPPort(dport),
+				SYN:     true,
+				Window:  65280,
+				Seq:     uint32(traceBasePort + ttl),
+			}
+			tcp.SetNetworkLayerForChecksum(&ip4)
+			err = ss.send(&eth, &ip4, &tcp)
+		}
+		if err != nil {
+			return nil, err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	hops := make(map[int]Hop)
+	reached := 0
+	deadline := time.After(timeout)
+wait:
+	for {
+		select {
+		case r := <-ch:
+			if r.ttl > maxHops {
+				continue
+			}
+			if _, ok := hops[r.ttl]; ok {
+				continue
+			}
+			hops[r.ttl] = Hop{TTL: r.ttl, IP: r.ip.String(), RTT: r.at.Sub(sent[r.ttl]).Milliseconds()}
+			if r.reached && (reached == 0 || r.ttl < reached) {
+				reached = r.ttl
+			}
+		case <-deadline:
+			break wait
+		}
+	}
+
+	ret := &TraceResult{Target: dstIp.String(), Mode: mode, Reached: reached > 0}
+	if ret.Mode != "icmp" {
+		ret.Mode = "tcp"
+	}
+	for ttl, h := range hops {
+		if reached > 0 && ttl > reached {
+			continue
+		}
+		ret.Hops = append(ret.Hops, h)
+	}
+	sort.Slice(ret.Hops, func(i, j int) bool { return ret.Hops[i].TTL < ret.Hops[j].TTL })
+	if n := len(ret.Hops); n > 0 {
+		ret.LastHop = ret.Hops[n-1].IP
+	}
+	return ret, nil
+}
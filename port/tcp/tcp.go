@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/vela-ssoc/vela-radar/port"
@@ -64,14 +65,19 @@ func (ts *TcpScanner) Scan(ip net.IP, dst uint16) error {
 			Ip:   ip,
 			Port: dst,
 		}
-		conn, _ := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", ip, dst), ts.timeout)
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", ip, dst), ts.timeout)
 		if conn != nil {
+			openIpPort.RTT = time.Since(start)
 			_ = conn.Close()
 		} else {
-			ts.callback(port.OpenIpPort{
-				Ip:   nil,
-				Port: 0,
-			})
+			openIpPort.State = dialState(err)
+		}
+		state := openIpPort.State.String()
+		port.MetricConnectSeconds.With(state).ObserveSince(start)
+		port.MetricReplies.With("tcp", state).Inc()
+		if conn == nil {
+			ts.callback(openIpPort)
 			return
 		}
 		go ts.callback(openIpPort)
@@ -102,6 +108,14 @@ func (ts *TcpScanner) Scan(ip net.IP, dst uint16) error {
 	return nil
 }*/
 
+// dialState 根据连接错误判断端口状态, 被拒绝(RST)为 closed, 其余(超时/不可达)为 filtered
+func dialState(err error) port.State {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return port.Closed
+	}
+	return port.Filtered
+}
+
 func (ts *TcpScanner) Wait() {
 	ts.wg.Wait()
 }
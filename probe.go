@@ -0,0 +1,248 @@
+package radar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/vela-ssoc/vela-kit/audit"
+	"github.com/vela-ssoc/vela-kit/lua"
+	"github.com/vela-ssoc/vela-radar/fingerprintx/plugins"
+	"github.com/vela-ssoc/vela-radar/fingerprintx/scan"
+	"golang.org/x/time/rate"
+)
+
+// probeMaxTargets 单次探测的最大地址数量, 更多的目标请使用扫描任务
+const probeMaxTargets = 64
+
+var errProbeScope = errors.New("out of radar policy scope")
+
+// ProbeOption 单点探测参数, 不占用扫描任务, 可以在任务运行时使用
+type ProbeOption struct {
+	Targets    []string `json:"targets"`    // host:port
+	Httpx      bool     `json:"httpx"`      // web 信息探测
+	Screenshot bool     `json:"screenshot"` // web 截图, 需要同时开启 httpx
+	Timeout    int      `json:"timeout"`    // 连接以及指纹超时(ms), 默认使用 finger 配置
+}
+
+// ProbeResult 探测结果, 端口不通或者解析失败的地址记录在 Errors 中
+type ProbeResult struct {
+	Services []*Service        `json:"services"`
+	Errors   map[string]string `json:"errors"`
+}
+
+// probeAddr 解析 host:port, 域名取第一个地址
+func probeAddr(target string) (netip.AddrPort, string, error) {
+	h, p, err := net.SplitHostPort(target)
+	if err != nil {
+		return netip.AddrPort{}, "", err
+	}
+
+	n, err := strconv.ParseUint(p, 10, 16)
+	if err != nil || n == 0 {
+		return netip.AddrPort{}, "", fmt.Errorf("invalid port %s", p)
+	}
+
+	if addr, err := netip.ParseAddr(h); err == nil {
+		return netip.AddrPortFrom(addr.Unmap(), uint16(n)), "", nil
+	}
+
+	ips, err := net.LookupIP(h)
+	if err != nil || len(ips) == 0 {
+		return netip.AddrPort{}, "", fmt.Errorf("resolve %s fail %v", h, err)
+	}
+	addr, _ := netip.AddrFromSlice(ips[0])
+	return netip.AddrPortFrom(addr.Unmap(), uint16(n)), h, nil
+}
+
+// probeOne 先确认端口开放, 再识别服务以及 web 信息
+func (rad *Radar) probeOne(target string, opt ProbeOption, cfg scan.Config, ps *policyScope) (*Service, error) {
+	ap, hostname, err := probeAddr(target)
+	if err != nil {
+		return nil, err
+	}
+	if !ps.Permit(net.IP(ap.Addr().AsSlice())) {
+		return nil, errProbeScope
+	}
+
+	conn, err := net.DialTimeout("tcp", ap.String(), cfg.DefaultTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("port not open %v", err)
+	}
+	conn.Close()
+
+	pt := plugins.Target{Address: ap, Host: hostname}
+	if pt.Host == "" {
+		pt.Host = "localhost"
+	}
+
+	s := &Service{
+		IP:        net.IP(ap.Addr().AsSlice()),
+		Port:      ap.Port(),
+		Host:      hostname,
+		Transport: "tcp",
+	}
+
+	srv, tried, err := scan.DoTrace(pt, cfg)
+	if err != nil || srv == nil {
+		s.Protocol = plugins.ProtoUnknown
+		s.Plugins = tried
+		return s, nil
+	}
+
+	s.Protocol = srv.Protocol
+	s.TLS = srv.TLS
+	s.Transport = srv.Transport
+	s.Version = srv.Version
+	s.Banner = srv.Raw
+
+	if opt.Httpx && technologies(srv, s) {
+		(&Tx{}).Web(s)
+		if opt.Screenshot {
+			rad.screenshot(s)
+		}
+	}
+	return s, nil
+}
+
+// probe 并发探测少量地址, 同步返回结果, 不经过 pipe/过滤规则/输出
+func (rad *Radar) probe(opt ProbeOption) (*ProbeResult, error) {
+	if len(opt.Targets) == 0 {
+		return nil, errors.New("probe targets is empty")
+	}
+	if len(opt.Targets) > probeMaxTargets {
+		return nil, fmt.Errorf("probe targets over limit %d, please use task", probeMaxTargets)
+	}
+
+	cfg := rad.cfg.Finger()
+	if opt.Timeout > 0 {
+		cfg.DefaultTimeout = time.Duration(opt.Timeout) * time.Millisecond
+	}
+
+	// 与运行中的任务共用截图协程, 引用计数归零时关闭
+	if opt.Screenshot && rad.screen != nil {
+		rad.screen.Acquire()
+		defer rad.screen.Release()
+	}
+
+	// 与扫描任务一样受策略的允许/禁止范围和最大速率限制
+	ps := rad.cfg.Policy.scope()
+	var limit *rate.Limiter
+	if p := rad.cfg.Policy; p != nil && p.MaxRate > 0 {
+		limit = rate.NewLimiter(rate.Limit(p.MaxRate), 1)
+	}
+
+	res := &ProbeResult{Errors: make(map[string]string)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, target := range opt.Targets {
+		if limit != nil {
+			_ = limit.Wait(context.Background())
+		}
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			s, err := rad.probeOne(target, opt, cfg, ps)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				res.Errors[target] = err.Error()
+				return
+			}
+			res.Services = append(res.Services, s)
+		}(target)
+	}
+	wg.Wait()
+
+	var rejected []string
+	for target, msg := range res.Errors {
+		if msg == errProbeScope.Error() {
+			rejected = append(rejected, target)
+		}
+	}
+	if len(rejected) > 0 {
+		sort.Strings(rejected)
+		msg := fmt.Sprintf("probe rejected by policy: target %s out of scope", strings.Join(rejected, ","))
+		audit.NewEvent("PortScanTask.policy").Subject("扫描策略").From(rad.cfg.co.CodeVM()).Msg(msg).Log().Put()
+	}
+	return res, nil
+}
+
+// rr.probe("10.2.3.4:8443", {httpx = true, screenshot = false, timeout = 1000})
+// 第一个参数可以是字符串(逗号分隔)或者列表, 返回服务列表以及失败信息
+func (rad *Radar) probeL(L *lua.LState) int {
+	var opt ProbeOption
+	for _, item := range luaStrings(L.Get(1)) {
+		for _, target := range strings.Split(item, ",") {
+			if target = strings.TrimSpace(target); target != "" {
+				opt.Targets = append(opt.Targets, target)
+			}
+		}
+	}
+	if tab, ok := L.Get(2).(*lua.LTable); ok {
+		tab.Range(func(key string, val lua.LValue) {
+			switch key {
+			case "httpx":
+				opt.Httpx = lua.IsTrue(val)
+			case "screenshot":
+				opt.Screenshot = lua.IsTrue(val)
+			case "timeout":
+				opt.Timeout = lua.IsInt(val)
+			}
+		})
+	}
+
+	res, err := rad.probe(opt)
+	if err != nil {
+		L.RaiseError("radar probe fail %v", err)
+		return 0
+	}
+
+	services := L.CreateTable(len(res.Services), 0)
+	for _, s := range res.Services {
+		services.Append(s)
+	}
+	errs := L.CreateTable(0, len(res.Errors))
+	for target, msg := range res.Errors {
+		errs.RawSetString(target, lua.LString(msg))
+	}
+	L.Push(services)
+	L.Push(errs)
+	return 2
+}
+
+func (rad *Radar) ProbePath() string {
+	return "/api/v1/arr/agent/radar/probe"
+}
+
+// ProbeHandle eg: {"targets": ["10.2.3.4:8443"], "httpx": true, "screenshot": false}
+func (rad *Radar) ProbeHandle(ctx *fasthttp.RequestCtx) error {
+	var opt ProbeOption
+	if err := json.Unmarshal(ctx.PostBody(), &opt); err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return err
+	}
+
+	res, err := rad.probe(opt)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return err
+	}
+
+	body, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.SetBody(body)
+	return nil
+}
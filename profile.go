@@ -0,0 +1,205 @@
+package radar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+	"github.com/vela-ssoc/vela-kit/lua"
+	"github.com/vela-ssoc/vela-radar/util"
+)
+
+// Profile 命名的扫描参数模板, 字段与 runscan 接口相同
+// eg: {"name": "full", "option": {"port": "1-65535", "mode": "syn", "httpx": true, "screenshot": true}}
+type Profile struct {
+	Name   string                 `json:"name"`
+	Option map[string]interface{} `json:"option"`
+}
+
+type profileTable struct {
+	mu    sync.RWMutex
+	items map[string]*Profile
+}
+
+func newProfileTable() *profileTable {
+	return &profileTable{items: make(map[string]*Profile)}
+}
+
+// Put 添加或者替换模板, 字段先在空任务上校验
+func (pt *profileTable) Put(p *Profile) error {
+	if p.Name == "" {
+		return errors.New("profile name is empty")
+	}
+	if err := new(Task).apply(p.Option, true); err != nil {
+		return fmt.Errorf("profile %s: %v", p.Name, err)
+	}
+
+	pt.mu.Lock()
+	pt.items[p.Name] = p
+	pt.mu.Unlock()
+	return nil
+}
+
+func (pt *profileTable) Get(name string) (*Profile, bool) {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	p, ok := pt.items[name]
+	return p, ok
+}
+
+func (pt *profileTable) Remove(name string) bool {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if _, ok := pt.items[name]; !ok {
+		return false
+	}
+	delete(pt.items, name)
+	return true
+}
+
+// List 按名称排序
+func (pt *profileTable) List() []*Profile {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	out := make([]*Profile, 0, len(pt.items))
+	for _, p := range pt.items {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// apply 按字段名排序后设置, 保证 state/state_ports 这类有依赖的字段顺序固定
+// strict 为 true 时不允许未知字段
+func (t *Task) apply(data map[string]interface{}, strict bool) error {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		known, err := t.set(key, data[key])
+		if err != nil {
+			return err
+		}
+		if !known && strict {
+			return errors.New("unknown option " + key)
+		}
+	}
+	return nil
+}
+
+// useProfile 模板作为任务的基础参数, 之后设置的字段覆盖模板
+func (t *Task) useProfile(name string) error {
+	p, ok := t.rad.profiles.Get(name)
+	if !ok {
+		return errors.New("profile not found " + name)
+	}
+	if err := t.apply(p.Option, true); err != nil {
+		return err
+	}
+	t.Profile = name
+	return nil
+}
+
+// task.profile("full") 应用模板, 必须在其他参数之前调用, 否则模板会覆盖已经设置的参数
+func (t *Task) profileL(L *lua.LState) int {
+	if t.Profile != "" || t.Option != t.defaults {
+		t.rad.discard(t)
+		L.RaiseError("task.profile must be called before other options")
+		return 0
+	}
+	if err := t.useProfile(L.CheckString(1)); err != nil {
+		t.rad.discard(t)
+		L.RaiseError("%v", err)
+		return 0
+	}
+	L.Push(t)
+	return 1
+}
+
+// rr.profile("full", {port = "1-65535", mode = "syn", httpx = true}) 添加模板
+// rr.profile("full") 读取模板参数, 不存在时返回 nil
+func (rad *Radar) profileL(L *lua.LState) int {
+	name := L.CheckString(1)
+	if L.GetTop() == 1 {
+		p, ok := rad.profiles.Get(name)
+		if !ok {
+			return 0
+		}
+		L.Push(jsonToLValue(L, p.Option))
+		return 1
+	}
+
+	option, ok := luaToJSON(L.CheckTable(2)).(map[string]interface{})
+	if !ok {
+		L.RaiseError("profile %s option must be a key-value table", name)
+		return 0
+	}
+	if err := rad.profiles.Put(&Profile{Name: name, Option: option}); err != nil {
+		L.RaiseError("%v", err)
+	}
+	return 0
+}
+
+func (rad *Radar) ProfilePath() string {
+	return "/api/v1/arr/agent/radar/profile"
+}
+
+func (rad *Radar) ProfileDeletePath() string {
+	return "/api/v1/arr/agent/radar/profile/delete"
+}
+
+// ProfileListHandle 模板列表, ?name=full 查询单个模板
+func (rad *Radar) ProfileListHandle(ctx *fasthttp.RequestCtx) error {
+	ctx.Response.Header.SetContentType("application/json")
+	name := string(ctx.QueryArgs().Peek("name"))
+	if name == "" {
+		ctx.Response.SetBody(util.ToJsonBytes(rad.profiles.List()))
+		return nil
+	}
+
+	p, ok := rad.profiles.Get(name)
+	if !ok {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		return errors.New("profile not found " + name)
+	}
+	ctx.Response.SetBody(util.ToJsonBytes(p))
+	return nil
+}
+
+// ProfilePutHandle 添加模板, 同名模板被替换
+func (rad *Radar) ProfilePutHandle(ctx *fasthttp.RequestCtx) error {
+	var p Profile
+	if err := json.Unmarshal(ctx.PostBody(), &p); err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return err
+	}
+	if err := rad.profiles.Put(&p); err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return err
+	}
+	ctx.Response.SetBody([]byte("ok"))
+	return nil
+}
+
+// ProfileDeleteHandle 按名称删除模板 eg: {"name": "full"}
+func (rad *Radar) ProfileDeleteHandle(ctx *fasthttp.RequestCtx) error {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return err
+	}
+	if !rad.profiles.Remove(req.Name) {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		return errors.New("profile not found " + req.Name)
+	}
+	ctx.Response.SetBody([]byte("ok"))
+	return nil
+}
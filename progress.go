@@ -0,0 +1,133 @@
+package radar
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 任务的各个阶段, 每个阶段单独计数, 总数随着任务推进增加
+const (
+	PhaseDiscovery  = "discovery"  // 主机发现, 未开启 ping 时进入扫描即完成
+	PhaseProbe      = "probe"      // 端口探测, 探测包发出即完成, syn 模式没有回应的端口同样计数
+	PhaseFinger     = "finger"     // 开放端口的指纹识别
+	PhaseHTTP       = "http"       // web 信息探测
+	PhaseScreenshot = "screenshot" // web 截图
+)
+
+type phase struct {
+	total uint64
+	done  uint64
+	first int64 // 第一次完成的时间, 用于计算速率
+}
+
+func (p *phase) add(n uint64) {
+	atomic.AddUint64(&p.total, n)
+}
+
+// sub 减少总数, 例如不存活或者被排除的主机不再探测端口
+func (p *phase) sub(n uint64) {
+	if n > 0 {
+		atomic.AddUint64(&p.total, ^(n - 1))
+	}
+}
+
+func (p *phase) finish(n uint64) {
+	atomic.CompareAndSwapInt64(&p.first, 0, time.Now().UnixNano())
+	atomic.AddUint64(&p.done, n)
+}
+
+// PhaseInfo 阶段进度, ETA 为按当前速率估算的剩余秒数, -1 表示无法估算
+type PhaseInfo struct {
+	Total   uint64  `json:"total"`
+	Done    uint64  `json:"done"`
+	Percent float64 `json:"percent"`
+	Rate    float64 `json:"rate"` // 每秒完成数
+	ETA     int64   `json:"eta"`
+}
+
+func (p *phase) info(now time.Time) PhaseInfo {
+	pi := PhaseInfo{
+		Total: atomic.LoadUint64(&p.total),
+		Done:  atomic.LoadUint64(&p.done),
+		ETA:   -1,
+	}
+	if pi.Done > pi.Total {
+		pi.Total = pi.Done
+	}
+	if pi.Done == pi.Total {
+		pi.ETA = 0
+	}
+	if pi.Total == 0 {
+		return pi
+	}
+	pi.Percent = percent(pi.Done, pi.Total)
+
+	first := atomic.LoadInt64(&p.first)
+	if first == 0 {
+		return pi
+	}
+	if elapsed := now.Sub(time.Unix(0, first)).Seconds(); elapsed >= 1 {
+		pi.Rate = round2(float64(pi.Done) / elapsed)
+		if pi.Done < pi.Total && pi.Rate > 0 {
+			pi.ETA = int64(float64(pi.Total-pi.Done) / (float64(pi.Done) / elapsed))
+		}
+	}
+	return pi
+}
+
+type progress struct {
+	Discovery  phase
+	Probe      phase
+	Finger     phase
+	HTTP       phase
+	Screenshot phase
+}
+
+func (pg *progress) phases() map[string]*phase {
+	return map[string]*phase{
+		PhaseDiscovery:  &pg.Discovery,
+		PhaseProbe:      &pg.Probe,
+		PhaseFinger:     &pg.Finger,
+		PhaseHTTP:       &pg.HTTP,
+		PhaseScreenshot: &pg.Screenshot,
+	}
+}
+
+// Summary 各阶段进度以及整体进度和 ETA
+// 整体进度按所有阶段的完成数计算, ETA 取各阶段中最大的剩余时间
+func (pg *progress) Summary() (map[string]PhaseInfo, float64, int64) {
+	now := time.Now()
+	out := make(map[string]PhaseInfo)
+	var total, done uint64
+	var eta int64
+	for name, p := range pg.phases() {
+		pi := p.info(now)
+		out[name] = pi
+		total += pi.Total
+		done += pi.Done
+		if pi.ETA < 0 && pi.Done < pi.Total {
+			eta = -1
+		} else if eta >= 0 && pi.ETA > eta {
+			eta = pi.ETA
+		}
+	}
+	return out, percent(done, total), eta
+}
+
+func percent(done, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return round2(float64(done) / float64(total) * 100)
+}
+
+func round2(v float64) float64 {
+	return float64(int64(v*100+0.5)) / 100
+}
+
+func etaMsg(eta int64) string {
+	if eta < 0 {
+		return "unknown"
+	}
+	return (time.Duration(eta) * time.Second).String()
+}
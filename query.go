@@ -0,0 +1,165 @@
+package radar
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/vela-ssoc/vela-kit/lua"
+	"github.com/vela-ssoc/vela-radar/store"
+	"github.com/vela-ssoc/vela-radar/util"
+)
+
+// queryRecord 本地结果库中的一条记录, lua 中可以按字段读取
+type queryRecord struct {
+	*store.Record
+}
+
+func (r *queryRecord) String() string                         { return string(util.ToJsonBytes(r.Record)) }
+func (r *queryRecord) Type() lua.LValueType                   { return lua.LTObject }
+func (r *queryRecord) AssertFloat64() (float64, bool)         { return 0, false }
+func (r *queryRecord) AssertString() (string, bool)           { return "", false }
+func (r *queryRecord) AssertFunction() (*lua.LFunction, bool) { return nil, false }
+func (r *queryRecord) Peek() lua.LValue                       { return r }
+
+func (r *queryRecord) Index(L *lua.LState, key string) lua.LValue {
+	switch key {
+	case "kind":
+		return lua.LString(r.Kind)
+	case "task_id":
+		return lua.LString(r.TaskId)
+	case "ip":
+		return lua.LString(r.IP)
+	case "port":
+		return lua.LNumber(r.Port)
+	case "protocol":
+		return lua.LString(r.Protocol)
+	case "time":
+		return lua.LNumber(r.Time.Unix())
+	case "fingerprints":
+		return luaStringList(L, r.Fingerprints)
+	case "data":
+		return lua.LString(r.Data)
+	}
+	return lua.LNil
+}
+
+// parseQueryTime 支持 unix 秒或者 RFC3339
+func parseQueryTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// setQuery 按字段名设置查询条件, http 参数和 lua 参数共用
+func setQuery(q *store.Query, key, val string) error {
+	var err error
+	switch key {
+	case "kind":
+		q.Kind = val
+	case "task", "task_id":
+		q.TaskId = val
+	case "ip":
+		q.IP = val
+	case "port":
+		q.Port, err = strconv.Atoi(val)
+	case "protocol":
+		q.Protocol = val
+	case "fingerprint":
+		q.Fingerprint = val
+	case "since":
+		q.Since, err = parseQueryTime(val)
+	case "until":
+		q.Until, err = parseQueryTime(val)
+	case "offset":
+		q.Offset, err = strconv.Atoi(val)
+	case "limit":
+		q.Limit, err = strconv.Atoi(val)
+	}
+	if err != nil {
+		return errors.New("query parameter invalid--" + key)
+	}
+	return nil
+}
+
+// rr.query{protocol = "redis", ip = "10.1.2.0/24", limit = 10}, 返回记录列表、总数以及是否还有更多记录(为 true 时总数只是下限)
+func (rad *Radar) queryL(L *lua.LState) int {
+	_, st := rad.outputs()
+	if st == nil {
+		L.RaiseError("radar store not enabled")
+		return 0
+	}
+
+	var q store.Query
+	if tab, ok := L.Get(1).(*lua.LTable); ok {
+		var err error
+		tab.Range(func(key string, value lua.LValue) {
+			if e := setQuery(&q, key, value.String()); e != nil {
+				err = e
+			}
+		})
+		if err != nil {
+			L.RaiseError("%v", err)
+			return 0
+		}
+	}
+
+	page, err := st.Query(q)
+	if err != nil {
+		L.RaiseError("radar query fail %v", err)
+		return 0
+	}
+
+	tab := L.CreateTable(len(page.Items), 0)
+	for _, r := range page.Items {
+		tab.Append(&queryRecord{Record: r})
+	}
+	L.Push(tab)
+	L.Push(lua.LNumber(page.Total))
+	L.Push(lua.LBool(page.HasMore))
+	return 3
+}
+
+func (rad *Radar) QueryPath() string {
+	return "/api/v1/arr/agent/radar/query"
+}
+
+// QueryHandle 查询本地结果库, 参数 task/ip/port/protocol/fingerprint/kind/since/until/offset/limit
+func (rad *Radar) QueryHandle(ctx *fasthttp.RequestCtx) error {
+	_, st := rad.outputs()
+	if st == nil {
+		return errors.New("radar store not enabled")
+	}
+
+	var q store.Query
+	var err error
+	ctx.QueryArgs().VisitAll(func(key, value []byte) {
+		if e := setQuery(&q, string(key), string(value)); e != nil {
+			err = e
+		}
+	})
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return err
+	}
+
+	page, err := st.Query(q)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return err
+	}
+
+	body, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.SetBody(body)
+	return nil
+}
@@ -3,8 +3,11 @@ package radar
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/netip"
 	"reflect"
@@ -12,6 +15,9 @@ import (
 	"sync/atomic"
 
 	"github.com/google/uuid"
+	"github.com/vela-ssoc/vela-radar/report"
+	"github.com/vela-ssoc/vela-radar/rule"
+	"github.com/vela-ssoc/vela-radar/store"
 	"github.com/vela-ssoc/vela-radar/util"
 	"github.com/vela-ssoc/vela-radar/web"
 	"github.com/vela-ssoc/vela-radar/web/finder"
@@ -32,12 +38,19 @@ const (
 
 type Radar struct {
 	lua.SuperVelaData
-	Status   uint32
-	cfg      *Config
-	screen   *web.ScreenshotServer
-	task     *Task
-	lastTask *Task
-	dr       tunnel.Doer
+	Status    uint32
+	cfg       *Config
+	screen    *web.ScreenshotServer
+	task      *Task
+	lastTask  *Task
+	passive   *passive
+	assets    *assetTable
+	omu       sync.RWMutex // 保护 dr、reporters 和 store, 重新加载配置时整体替换
+	reporters []report.Reporter
+	store     *store.Store
+	rules     *rule.Set
+	profiles  *profileTable
+	dr        tunnel.Doer
 }
 
 func (rad *Radar) IsWorking() bool {
@@ -64,6 +77,16 @@ func (rad *Radar) Info() []byte {
 	} else {
 		enc.Raw("last_task", rad.lastTask.info())
 	}
+	if rad.passive != nil {
+		enc.Raw("passive", rad.passive.Bytes())
+	}
+	enc.Raw("report", rad.reportStats())
+	if rad.cfg.Policy != nil {
+		enc.Raw("policy", util.ToJsonBytes(rad.cfg.Policy))
+	}
+	if _, st := rad.outputs(); st != nil {
+		enc.Raw("store", util.ToJsonBytes(st.Stats()))
+	}
 	enc.End("}")
 	return enc.Bytes()
 }
@@ -92,23 +115,37 @@ func (rad *Radar) Catch(err error) {
 }
 
 func (rad *Radar) Screen(tx *Tx, s *Service) {
-	if rad.screen == nil {
+	if !tx.Param.Screenshot || !rad.screenable(s) {
 		return
 	}
 
+	rad.task.progress.Screenshot.add(1)
+	defer rad.task.progress.Screenshot.finish(1)
+	rad.screenshot(s)
+}
+
+func (rad *Radar) screenable(s *Service) bool {
+	if rad.screen == nil {
+		return false
+	}
+
 	if !rad.screen.Avaliable {
-		return
+		return false
 	}
 
 	if s.HTTPInfo == nil {
-		return
+		return false
 	}
 
-	if !tx.Param.Screenshot {
-		return
+	if s.HTTPInfo.Body == "" || s.HTTPInfo.Header == "Content-Type: text/plain\nContent-Length: 0\n" {
+		return false
 	}
+	return true
+}
 
-	if s.HTTPInfo.Body == "" || s.HTTPInfo.Header == "Content-Type: text/plain\nContent-Length: 0\n" {
+// screenshot 对 web 服务截图, 同步等待结果
+func (rad *Radar) screenshot(s *Service) {
+	if !rad.screenable(s) {
 		return
 	}
 
@@ -122,7 +159,9 @@ func (rad *Radar) Screen(tx *Tx, s *Service) {
 		TimeoutCancel: func() {},
 	}
 	//defer target.TimeoutCancel()
-	rad.screen.Push(target)
+	if !rad.screen.Push(target) {
+		return
+	}
 
 	select {
 	//case <-target.TargetCtx.Done():
@@ -143,31 +182,181 @@ func (rad *Radar) Screen(tx *Tx, s *Service) {
 func (rad *Radar) handle(s *Service) {
 	//count
 	atomic.AddUint64(&rad.task.Count_asset, 1)
+	metricServices.With(s.Protocol).Inc()
+
+	var merge *AssetMerge
+	s.AssetId, merge = rad.assets.Correlate(s.IP, identifiers(s))
+	if merge != nil {
+		// 已经上报的结果使用旧ID, 不改写, 发送合并记录由下游关联
+		merge.TaskId = rad.task.Id
+		uri := ""
+		if rad.task.Report {
+			uri = rad.cfg.ReportHostUri
+		}
+		rad.report(report.KindAsset, uri, merge.Bytes())
+	}
 
-	// todo ignore (use cnd )
+	if rad.task.anomaly != nil {
+		if reason := rad.task.anomaly.Service(s); reason != "" {
+			s.Comment = reason
+		}
+	}
+
+	// 过滤规则: 丢弃, 打标签或者只发送到指定输出
+	sink := ""
+	if v := rad.filter(rad.task, report.KindService, s.Bytes()); v != nil {
+		if v.Action == rule.ActionDrop {
+			return
+		}
+		s.Tags = append(s.Tags, v.Tags...)
+		sink = v.Sink
+	}
 
 	rad.cfg.Chains.Do(s, rad.cfg.co, func(err error) {
 		rad.Exception(err)
 	})
+	rad.task.results.AddService(s)
+	rad.task.onService(s)
 
+	uri := ""
 	if rad.task.Report {
-		// todo upload (use tunnel)
-		// res, err := xEnv.Fetch("/api/v1/broker/proxy/siem/api/netapp/mono", bytes.NewReader(s.Bytes()), nil)
-		req, err := http.NewRequest("POST", rad.cfg.ReportUri, bytes.NewReader(s.Bytes()))
-		req.Header.Set("Content-Type", "application/json")
-		if err != nil {
-			xEnv.Errorf("create request fail %v", err)
+		uri = rad.cfg.ReportUri
+	}
+	rad.reportTo(sink, report.KindService, uri, s.Bytes())
+}
+
+// handleHost 主机维度的结果(端口状态统计等), 在任务结束时产生
+func (rad *Radar) handleHost(t *Task, h *Host) {
+	sink := ""
+	if v := rad.filter(t, report.KindHost, h.Bytes()); v != nil {
+		if v.Action == rule.ActionDrop {
 			return
 		}
-		res, err := rad.dr.Do(req)
-		if err != nil {
-			xEnv.Errorf("upload siem info fail %v", err)
-			return
+		h.Tags = append(h.Tags, v.Tags...)
+		sink = v.Sink
+	}
+
+	rad.cfg.Chains.Do(h, rad.cfg.co, func(err error) {
+		rad.Exception(err)
+	})
+	t.results.AddHost(h)
+	t.onHost(h)
+
+	uri := ""
+	if t.Report {
+		uri = rad.cfg.ReportHostUri
+	}
+	rad.reportTo(sink, report.KindHost, uri, h.Bytes())
+}
+
+// report 结果保存到本地库并发送到所有输出, uri 为空时不通过 tunnel 上报
+func (rad *Radar) report(typ string, uri string, body []byte) {
+	rad.reportTo("", typ, uri, body)
+}
+
+// reportTo sink 不为空时只发送到该输出
+func (rad *Radar) reportTo(sink string, typ string, uri string, body []byte) {
+	reporters, st := rad.outputs()
+	if st != nil {
+		// 只放入写入队列, 队列满时丢弃的数量见 store 统计
+		if err := st.Put(typ, body); err != nil && err != store.ErrQueueFull {
+			xEnv.Errorf("radar store %s fail %v", typ, err)
 		}
+	}
 
-		if res.StatusCode != 200 {
-			xEnv.Errorf("upload siem info not ok %v", err)
+	rec := &report.Record{Kind: typ, URI: uri, Body: body}
+	for _, r := range reporters {
+		if sink != "" && r.Name() != sink {
+			continue
 		}
+		if err := r.Report(rec); err != nil {
+			xEnv.Errorf("radar report %s fail %v", r.Name(), err)
+		}
+	}
+}
+
+func (rad *Radar) reportStats() []byte {
+	enc := kind.NewJsonEncoder()
+	enc.Tab("")
+	reporters, _ := rad.outputs()
+	for _, r := range reporters {
+		enc.Raw(r.Name(), util.ToJsonBytes(r.Stats()))
+	}
+	enc.End("}")
+	return enc.Bytes()
+}
+
+// outputs 当前的输出和本地库, 重新加载配置时会被替换, 不要长期持有
+func (rad *Radar) outputs() ([]report.Reporter, *store.Store) {
+	rad.omu.RLock()
+	defer rad.omu.RUnlock()
+	return rad.reporters, rad.store
+}
+
+// closeOutputs 关闭输出以及本地库, 等待队列中的数据发送或者写入 spool
+func (rad *Radar) closeOutputs() {
+	rad.omu.Lock()
+	reporters, st := rad.reporters, rad.store
+	rad.reporters, rad.store = nil, nil
+	rad.omu.Unlock()
+
+	for _, r := range reporters {
+		if err := r.Close(); err != nil {
+			xEnv.Errorf("radar report %s close fail %v", r.Name(), err)
+		}
+	}
+	if st != nil {
+		st.Close()
+	}
+}
+
+// send 通过 tunnel 发送一个批次, 非 2xx 响应视为失败, 除 408/429 之外的 4xx 重试也不会成功
+func (rad *Radar) send(b *report.Batch) error {
+	rad.omu.RLock()
+	dr := rad.dr
+	rad.omu.RUnlock()
+	if dr == nil {
+		return errors.New("report doer not available")
+	}
+
+	req, err := http.NewRequest("POST", b.URI, bytes.NewReader(b.Body))
+	if err != nil {
+		return err
+	}
+	if b.Count > 1 {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if b.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	res, err := dr.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode <= 299:
+		return nil
+	case res.StatusCode >= 400 && res.StatusCode <= 499 &&
+		res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests:
+		return report.Permanent(fmt.Errorf("upload %s rejected, status %d: %s", b.URI, res.StatusCode, msg))
+	default:
+		return fmt.Errorf("upload %s not ok, status %d: %s", b.URI, res.StatusCode, msg)
+	}
+}
+
+// discard 被拒绝的任务不再作为当前任务
+func (rad *Radar) discard(t *Task) {
+	if rad.task == t {
+		rad.task = nil
+	}
+	if t.cancel != nil {
+		t.cancel()
 	}
 }
 
@@ -178,6 +367,14 @@ func (rad *Radar) End() {
 }
 
 func (rad *Radar) Callback(tx *Tx) {
+	// 安全模式不运行指纹插件, 也不做 web 探测和截图
+	if rad.task.safe != nil {
+		if reason := rad.task.safe.Reason(tx.Entry.Ip); reason != "" {
+			rad.handle(rad.safeService(tx, reason))
+			return
+		}
+	}
+
 	addr, _ := netip.AddrFromSlice(tx.Entry.Ip)
 
 	target := plugins.Target{
@@ -187,12 +384,10 @@ func (rad *Radar) Callback(tx *Tx) {
 
 	cfg := rad.cfg.Finger()
 
-	srv, err := scan.Do(target, cfg)
-	if err != nil {
-		return
-	}
-
-	if srv == nil {
+	srv, tried, err := scan.DoTrace(target, cfg)
+	if err != nil || srv == nil {
+		// the port is confirmed open, report it even if no plugin knows the service
+		rad.handle(rad.unknown(tx, target, tried))
 		return
 	}
 
@@ -208,22 +403,84 @@ func (rad *Radar) Callback(tx *Tx) {
 		TaskId:    rad.task.Id,
 	}
 
-	if tx.Param.Httpx && s.Protocol == "http" {
+	rad.names(tx, &s)
+	rad.device(&s)
+
+	if tx.Param.Httpx && technologies(srv, &s) {
+		rad.web(tx, &s)
+	}
+
+	rad.Screen(tx, &s)
+	rad.handle(&s)
+}
+
+// technologies web 服务读取组件标签并清空 banner, 不是 web 服务时返回 false
+func technologies(srv *plugins.Service, s *Service) bool {
+	switch s.Protocol {
+	case "http":
 		var raw plugins.ServiceHTTP
 		json.Unmarshal(srv.Raw, &raw)
 		s.Component = raw.Technologies
-		s.Banner = []byte{}
-		tx.Web(&s)
-	} else if tx.Param.Httpx && s.Protocol == "https" {
+	case "https":
 		var raw plugins.ServiceHTTPS
 		json.Unmarshal(srv.Raw, &raw)
 		s.Component = raw.Technologies
-		s.Banner = []byte{}
-		tx.Web(&s)
+	default:
+		return false
 	}
+	s.Banner = []byte{}
+	return true
+}
 
-	rad.Screen(tx, &s)
-	rad.handle(&s)
+// web 探测 web 信息并记录进度
+func (rad *Radar) web(tx *Tx, s *Service) {
+	rad.task.progress.HTTP.add(1)
+	tx.Web(s)
+	rad.task.progress.HTTP.finish(1)
+}
+
+func (rad *Radar) names(tx *Tx, s *Service) {
+	if !tx.Param.Names || rad.task.names == nil {
+		return
+	}
+	s.Names = rad.task.names.Resolve(s.IP)
+}
+
+func (rad *Radar) device(s *Service) {
+	if rad.task.devices == nil {
+		return
+	}
+	s.Device = rad.task.devices.Get(s.IP)
+}
+
+func (rad *Radar) unknown(tx *Tx, target plugins.Target, tried []string) *Service {
+	s := &Service{
+		IP:        tx.Entry.Ip,
+		Port:      tx.Entry.Port,
+		Protocol:  plugins.ProtoUnknown,
+		Location:  rad.task.Option.Location,
+		Transport: "tcp",
+		TaskId:    rad.task.Id,
+		Plugins:   tried,
+	}
+
+	rad.names(tx, s)
+	rad.device(s)
+
+	b, err := scan.GrabBanner(target, rad.cfg.FxConfig.DefaultTimeout)
+	if err != nil {
+		return s
+	}
+
+	s.Elapsed = b.Elapsed.Milliseconds()
+	if len(b.Raw) > 0 {
+		s.Banner = util.ToJsonBytes(map[string]string{
+			"probe": b.Probe,
+			"hex":   hex.EncodeToString(b.Raw),
+			"text":  util.Printable(b.Raw),
+		})
+	}
+	return s
 }
 
 func (rad *Radar) NewTask(target string) *Task {
@@ -241,8 +498,12 @@ func (rad *Radar) NewTask(target string) *Task {
 			Scan:   10,
 			Finger: 50,
 		},
-		FingerDB: "",
-		MinioCfg: *rad.cfg.MinioCfg,
+		FingerDB:     "",
+		SafeDelay:    safeDefaultDelay,
+		SkipSelf:     true,
+		SkipGateway:  true,
+		SkipBoundary: true,
+		MinioCfg:     *rad.cfg.MinioCfg,
 	}
 	if opt.FingerDB != "" {
 		info, err := xEnv.Third(opt.FingerDB)
@@ -261,20 +522,113 @@ func (rad *Radar) NewTask(target string) *Task {
 		}
 	}
 	ctx, cancel := context.WithCancel(xEnv.Context())
-	t := &Task{Option: opt, Dispatch: rad, ctx: ctx, cancel: cancel, co: xEnv.Clone(rad.cfg.co), rad: rad}
+	t := &Task{Option: opt, defaults: opt, Dispatch: rad, ctx: ctx, cancel: cancel, co: xEnv.Clone(rad.cfg.co), rad: rad, results: newResultTable(), filters: newFilterStats(), done: make(chan struct{})}
 	rad.task = t
 	return t
 }
 
 func NewRadar(cfg *Config) *Radar {
+	rad := &Radar{
+		cfg:      cfg,
+		Status:   Idle,
+		assets:   newAssetTable(),
+		rules:    rule.NewSet(),
+		profiles: newProfileTable(),
+	}
+	// 内置的工控安全模板
+	_ = rad.profiles.Put(&Profile{Name: "ics-safe", Option: map[string]interface{}{
+		"safe": true, "rate": float64(50), "pool_scan": float64(2), "httpx": false, "screenshot": false, "snmp": false,
+	}})
+	rad.openOutputs(cfg)
+	rad.loadRules(nil, cfg)
+	return rad
+}
+
+// reload lua 重新加载时使用新的配置, 输出、spool、本地库以及配置中的规则全部按新配置重建
+// 旧的输出先关闭(队列写入 spool, 本地库释放文件锁), 关闭期间产生的结果只保存到新的 spool
+func (rad *Radar) reload(cfg *Config) {
+	old := rad.cfg
+	rad.closeOutputs()
+	rad.cfg = cfg
+	rad.openOutputs(cfg)
+	rad.loadRules(old, cfg)
+}
+
+// openOutputs 按配置创建上报通道、输出以及本地库
+func (rad *Radar) openOutputs(cfg *Config) {
 	d, err := xEnv.Doer(cfg.ReportDoer)
 	if err != nil {
 		fmt.Println("xEnv.Doer ERR")
 	}
-	rad := &Radar{
-		cfg:    cfg,
-		Status: Idle,
-		dr:     d,
+
+	// 没有单独配置 tunnel 时使用默认的 tunnel 输出
+	sinks := cfg.Sinks
+	hasTunnel := false
+	for _, sc := range sinks {
+		if sc.Type == "tunnel" {
+			hasTunnel = true
+		}
+	}
+	if !hasTunnel {
+		sinks = append([]report.SinkConfig{{Type: "tunnel"}}, sinks...)
+	}
+
+	var reporters []report.Reporter
+	for _, sc := range sinks {
+		opt := cfg.Report
+		if sc.Queue.Batch > 0 {
+			opt.Batch = sc.Queue.Batch
+		}
+		if sc.Queue.Interval > 0 {
+			opt.Interval = sc.Queue.Interval
+		}
+		sc.Queue = opt
+
+		r, err := report.Open(sc, rad.send)
+		if r == nil {
+			xEnv.Errorf("radar %v", err)
+			continue
+		}
+		if err != nil {
+			xEnv.Errorf("report %s spool init fail %v", r.Name(), err)
+		}
+		reporters = append(reporters, r)
+	}
+
+	var st *store.Store
+	if cfg.Store != nil {
+		st, err = store.Open(*cfg.Store)
+		if err != nil {
+			xEnv.Errorf("radar store %s open fail %v", cfg.Store.Path, err)
+			st = nil
+		}
+	}
+
+	rad.omu.Lock()
+	rad.dr, rad.reporters, rad.store = d, reporters, st
+	rad.omu.Unlock()
+}
+
+// configRuleName 配置中没有名称的规则按顺序命名, 重新加载时按名称替换
+func configRuleName(r rule.Rule, i int) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("config-%d", i+1)
+}
+
+// loadRules 删除旧配置中的规则再添加新配置的规则, 通过 http 添加的规则保留
+// 规则的 sink 需要对应已经创建的输出
+func (rad *Radar) loadRules(old, cfg *Config) {
+	if old != nil {
+		for i, r := range old.Rules {
+			rad.rules.Remove(configRuleName(r, i))
+		}
+	}
+	for i, r := range cfg.Rules {
+		r.Name = configRuleName(r, i)
+		if err := rad.putRule(r); err != nil {
+			xEnv.Errorf("radar filter %v", err)
+		}
 	}
-	return rad
 }
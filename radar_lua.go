@@ -19,7 +19,12 @@ func (rad *Radar) Close() error {
 	if rad.task != nil {
 		rad.task.close()
 	}
+	if rad.passive != nil {
+		rad.passive.close()
+		rad.passive = nil
+	}
 	rad.UndoDefine()
+	rad.closeOutputs()
 
 	return nil
 }
@@ -94,6 +99,14 @@ DONE:
 	return 1
 }
 
+// rad.passive{dev = "eth0", scan = true, port = "top100", interval = 60}
+func (rad *Radar) passiveL(L *lua.LState) int {
+	if err := rad.startPassive(newPassiveConfig(L)); err != nil {
+		L.RaiseError("passive listener start fail %v", err)
+	}
+	return 0
+}
+
 // rad.chrome("/aab//cc")
 
 func (rad *Radar) Index(L *lua.LState, key string) lua.LValue {
@@ -112,6 +125,18 @@ func (rad *Radar) Index(L *lua.LState, key string) lua.LValue {
 	case "chrome":
 		return lua.NewFunction(rad.chromeL)
 
+	case "passive":
+		return lua.NewFunction(rad.passiveL)
+
+	case "query":
+		return lua.NewFunction(rad.queryL)
+
+	case "probe":
+		return lua.NewFunction(rad.probeL)
+
+	case "profile":
+		return lua.NewFunction(rad.profileL)
+
 	default:
 		//todo
 	}
@@ -0,0 +1,129 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ElasticWriter 使用 _bulk 接口写入, 非 json 格式的行包装为 {"message": line}
+type ElasticWriter struct {
+	url      string
+	index    string
+	user     string
+	password string
+	client   *http.Client
+}
+
+func NewElasticWriter(url, index, user, password string, timeout time.Duration) (*ElasticWriter, error) {
+	if url == "" {
+		return nil, errors.New("elastic url is empty")
+	}
+	if index == "" {
+		index = "vela-radar-%s"
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &ElasticWriter{
+		url:      strings.TrimSuffix(url, "/") + "/_bulk",
+		index:    index,
+		user:     user,
+		password: password,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (e *ElasticWriter) indexName() string {
+	if strings.Contains(e.index, "%s") {
+		return fmt.Sprintf(e.index, time.Now().Format("2006.01.02"))
+	}
+	return e.index
+}
+
+func (e *ElasticWriter) Send(b *Batch) error {
+	items := lines(b)
+	if len(items) == 0 {
+		return nil
+	}
+
+	action, _ := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": e.indexName()}})
+
+	var buf bytes.Buffer
+	for _, line := range items {
+		buf.Write(action)
+		buf.WriteByte('\n')
+		if json.Valid([]byte(line)) && strings.HasPrefix(line, "{") {
+			buf.WriteString(line)
+		} else {
+			doc, _ := json.Marshal(map[string]string{"kind": b.URI, "message": line})
+			buf.Write(doc)
+		}
+		buf.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.url, &buf)
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if e.user != "" {
+		req.SetBasicAuth(e.user, e.password)
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	switch {
+	case res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("elastic bulk status %d: %s", res.StatusCode, truncate(body))
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		return Permanent(fmt.Errorf("elastic bulk status %d: %s", res.StatusCode, truncate(body)))
+	}
+
+	var reply struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if json.Unmarshal(body, &reply) != nil || !reply.Errors {
+		return nil
+	}
+
+	// 部分文档被拒绝(mapping 错误等), 重试会产生重复数据, 不再重试
+	for _, item := range reply.Items {
+		for _, r := range item {
+			if r.Status > 299 {
+				return Permanent(fmt.Errorf("elastic bulk rejected %s: %s", r.Error.Type, r.Error.Reason))
+			}
+		}
+	}
+	return nil
+}
+
+func (e *ElasticWriter) Close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+func truncate(body []byte) string {
+	if len(body) > 256 {
+		body = body[:256]
+	}
+	return string(body)
+}
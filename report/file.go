@@ -0,0 +1,110 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	fileDefaultMaxSize = 100 << 20
+	fileDefaultBackups = 5
+)
+
+// FileWriter 按行写入本地文件, 超过 maxSize 时轮转为 path.1 ... path.N
+type FileWriter struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	fd      *os.File
+	size    int64
+}
+
+func NewFileWriter(path string, maxSize int64, backups int) (*FileWriter, error) {
+	if path == "" {
+		return nil, errors.New("file path is empty")
+	}
+	if maxSize <= 0 {
+		maxSize = fileDefaultMaxSize
+	}
+	if backups <= 0 {
+		backups = fileDefaultBackups
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	w := &FileWriter{path: path, maxSize: maxSize, backups: backups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *FileWriter) open() error {
+	fd, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	w.fd, w.size = fd, info.Size()
+	return nil
+}
+
+func (w *FileWriter) rotate() error {
+	if err := w.fd.Close(); err != nil {
+		return err
+	}
+	w.fd = nil
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", w.path, w.backups))
+	for i := w.backups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+	}
+	if err := os.Rename(w.path, w.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return w.open()
+}
+
+func (w *FileWriter) Send(b *Batch) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.fd == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+
+	if w.size > 0 && w.size+int64(len(b.Body)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.fd.Write(b.Body)
+	w.size += int64(n)
+	return err
+}
+
+func (w *FileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fd == nil {
+		return nil
+	}
+	err := w.fd.Close()
+	w.fd = nil
+	return err
+}
@@ -0,0 +1,168 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Filter 字段过滤, 所有字段都匹配才输出, 同一字段的多个值任意匹配即可
+type Filter struct {
+	fields map[string]map[string]bool
+}
+
+func NewFilter(fields map[string][]string) *Filter {
+	f := &Filter{fields: make(map[string]map[string]bool, len(fields))}
+	for key, values := range fields {
+		set := make(map[string]bool, len(values))
+		for _, v := range values {
+			set[strings.ToLower(v)] = true
+		}
+		f.fields[key] = set
+	}
+	return f
+}
+
+func (f *Filter) Empty() bool {
+	return f == nil || len(f.fields) == 0
+}
+
+func (f *Filter) Match(doc map[string]interface{}) bool {
+	if f.Empty() {
+		return true
+	}
+
+	for key, set := range f.fields {
+		v, ok := lookup(doc, key)
+		if !ok {
+			return false
+		}
+
+		matched := false
+		if arr, ok := v.([]interface{}); ok {
+			// 数组字段(component 等)任意元素匹配
+			for _, item := range arr {
+				if set[strings.ToLower(text(item))] {
+					matched = true
+					break
+				}
+			}
+		} else {
+			matched = set[strings.ToLower(text(v))]
+		}
+
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func decode(body []byte) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("report record decode fail %v", err)
+	}
+	return doc, nil
+}
+
+// lookup 按 a.b.c 形式读取嵌套字段
+func lookup(doc map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// text 字段的文本形式, 对象和数组使用 json
+func text(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		chunk, _ := json.Marshal(val)
+		return string(chunk)
+	}
+}
+
+func isJSONFormat(format string) bool {
+	return format == "" || format == "json"
+}
+
+// Format 把记录格式化为单行文本
+// kv: 按字段名排序的 key=value, 空值忽略; 其他按模板替换 ${field}
+func Format(format string, doc map[string]interface{}) []byte {
+	if format == "kv" {
+		return formatKV(doc)
+	}
+
+	var buf bytes.Buffer
+	s := format
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			buf.WriteString(s)
+			break
+		}
+		j := strings.Index(s[i:], "}")
+		if j < 0 {
+			buf.WriteString(s)
+			break
+		}
+		buf.WriteString(s[:i])
+		if v, ok := lookup(doc, s[i+2:i+j]); ok {
+			buf.WriteString(oneline(text(v)))
+		}
+		s = s[i+j+1:]
+	}
+	return buf.Bytes()
+}
+
+func formatKV(doc map[string]interface{}) []byte {
+	keys := make([]string, 0, len(doc))
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		v := text(doc[k])
+		if v == "" || v == "[]" || v == "{}" || v == "null" {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		if strings.ContainsAny(v, " \"=\r\n\t") {
+			v = strconv.Quote(v)
+		}
+		buf.WriteString(v)
+	}
+	return buf.Bytes()
+}
+
+// oneline 模板中的值不能包含换行
+func oneline(s string) string {
+	return strings.NewReplacer("\r", `\r`, "\n", `\n`).Replace(s)
+}
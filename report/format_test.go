@@ -0,0 +1,33 @@
+package report
+
+import "testing"
+
+func TestFilterAndFormat(t *testing.T) {
+	doc, err := decode([]byte(`{"ip":"10.0.0.1","port":443,"protocol":"https","component":["nginx"],"http_info":{"title":"a\nb"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		fields map[string][]string
+		match  bool
+	}{
+		{nil, true},
+		{map[string][]string{"protocol": {"http", "HTTPS"}}, true},
+		{map[string][]string{"port": {"443"}, "component": {"nginx"}}, true},
+		{map[string][]string{"http_info.title": {"x"}}, false},
+		{map[string][]string{"missing": {"x"}}, false},
+	}
+	for i, c := range cases {
+		if got := NewFilter(c.fields).Match(doc); got != c.match {
+			t.Errorf("case %d: want %v, got %v", i, c.match, got)
+		}
+	}
+
+	if got := string(Format("${ip}:${port} ${http_info.title}", doc)); got != `10.0.0.1:443 a\nb` {
+		t.Errorf("bad template output %q", got)
+	}
+	if got := string(Format("kv", doc)); got != `component="[\"nginx\"]" http_info="{\"title\":\"a\\nb\"}" ip=10.0.0.1 port=443 protocol=https` {
+		t.Errorf("bad kv output %q", got)
+	}
+}
@@ -0,0 +1,62 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaWriter 每行一条消息, 消息头 kind 为记录类型
+type KafkaWriter struct {
+	w       *kafka.Writer
+	timeout time.Duration
+}
+
+func NewKafkaWriter(brokers []string, topic string, timeout time.Duration) (*KafkaWriter, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("kafka brokers is empty")
+	}
+	if topic == "" {
+		return nil, errors.New("kafka topic is empty")
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.LeastBytes{},
+		RequiredAcks: kafka.RequireOne,
+		WriteTimeout: timeout,
+		// 批量由上层队列完成
+		BatchSize:    1,
+		BatchTimeout: time.Millisecond,
+	}
+	return &KafkaWriter{w: w, timeout: timeout}, nil
+}
+
+func (k *KafkaWriter) Send(b *Batch) error {
+	items := lines(b)
+	if len(items) == 0 {
+		return nil
+	}
+
+	msgs := make([]kafka.Message, len(items))
+	for i, line := range items {
+		msgs[i] = kafka.Message{
+			Value:   []byte(line),
+			Headers: []kafka.Header{{Key: "kind", Value: []byte(b.URI)}},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), k.timeout)
+	defer cancel()
+	return k.w.WriteMessages(ctx, msgs...)
+}
+
+func (k *KafkaWriter) Close() error {
+	return k.w.Close()
+}
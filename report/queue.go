@@ -0,0 +1,412 @@
+package report
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Batch 一次上报的数据, Body 为 NDJSON, Gzip 时为压缩后的数据
+type Batch struct {
+	URI   string
+	Body  []byte
+	Gzip  bool
+	Count int
+}
+
+// Sender 发送一个批次, 返回 nil 表示对端已经确认, 返回 Permanent 包装的错误表示不需要重试
+type Sender func(b *Batch) error
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 包装不可重试的错误, 例如数据格式被对端拒绝
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+type Option struct {
+	Queue      int           // 内存队列长度, 满了之后直接写入 spool
+	Batch      int           // 每批最多条数
+	Interval   time.Duration // 不满一批时最长等待时间
+	Gzip       bool          // 是否压缩
+	Retry      int           // 单个批次的重试次数, 超过后写入 spool
+	Backoff    time.Duration // 第一次重试的等待时间, 之后翻倍
+	MaxBackoff time.Duration
+	SpoolDir   string // 为空不使用 spool, 发送失败的数据直接丢弃
+	SpoolSize  int64  // spool 目录最大字节数
+	Replay     int    // 单个 spool 文件最多补发次数, 超过后移到一边, 不再阻塞后面的批次
+}
+
+func DefaultOption() Option {
+	return Option{
+		Queue:      10000,
+		Batch:      1,
+		Interval:   5 * time.Second,
+		Retry:      3,
+		Backoff:    time.Second,
+		MaxBackoff: time.Minute,
+		SpoolDir:   "radar_spool",
+		SpoolSize:  256 << 20,
+		Replay:     20,
+	}
+}
+
+// Stats 投递统计
+type Stats struct {
+	Queued       uint64    `json:"queued"`        // 进入队列的条数
+	Sent         uint64    `json:"sent"`          // 发送成功的条数
+	Batches      uint64    `json:"batches"`       // 发送成功的批次数
+	Retries      uint64    `json:"retries"`       // 重试次数
+	Failed       uint64    `json:"failed"`        // 重试后仍然失败的批次数
+	Spooled      uint64    `json:"spooled"`       // 写入 spool 的批次数
+	Replayed     uint64    `json:"replayed"`      // 从 spool 补发成功的批次数
+	Dropped      uint64    `json:"dropped"`       // 丢弃的条数
+	Pending      int       `json:"pending"`       // 内存队列中等待的条数
+	SpoolPending int       `json:"spool_pending"` // spool 中等待的批次数
+	LastError    string    `json:"last_error"`
+	LastSuccess  time.Time `json:"last_success"`
+}
+
+type item struct {
+	uri  string
+	body []byte
+}
+
+// Queue 异步上报, 内存队列 -> 按地址分批 -> 重试 -> 本地 spool
+type Queue struct {
+	opt   Option
+	send  Sender
+	spool *Spool
+	queue chan item
+	done  chan struct{}
+	wg    sync.WaitGroup
+	once  sync.Once
+
+	queued, sent, batches, retries, failed, spooled, replayed, dropped uint64
+
+	mu          sync.Mutex
+	lastError   string
+	lastSuccess time.Time
+}
+
+// NewQueue 创建并启动队列, spool 目录不可用时返回错误, 但队列仍然可以使用
+func NewQueue(opt Option, send Sender) (*Queue, error) {
+	def := DefaultOption()
+	if opt.Queue <= 0 {
+		opt.Queue = def.Queue
+	}
+	if opt.Batch <= 0 {
+		opt.Batch = def.Batch
+	}
+	if opt.Interval <= 0 {
+		opt.Interval = def.Interval
+	}
+	if opt.Backoff <= 0 {
+		opt.Backoff = def.Backoff
+	}
+	if opt.MaxBackoff < opt.Backoff {
+		opt.MaxBackoff = def.MaxBackoff
+	}
+	if opt.Replay <= 0 {
+		opt.Replay = def.Replay
+	}
+
+	r := &Queue{
+		opt:   opt,
+		send:  send,
+		queue: make(chan item, opt.Queue),
+		done:  make(chan struct{}),
+	}
+
+	var err error
+	if opt.SpoolDir != "" {
+		r.spool, err = NewSpool(opt.SpoolDir, opt.SpoolSize)
+	}
+
+	r.wg.Add(1)
+	go r.loop()
+	if r.spool != nil {
+		r.wg.Add(1)
+		go r.replay()
+	}
+	return r, err
+}
+
+// Push 非阻塞入队, 队列满时直接写入 spool
+func (r *Queue) Push(uri string, body []byte) {
+	select {
+	case <-r.done:
+		r.overflow(uri, body)
+		return
+	default:
+	}
+
+	select {
+	case r.queue <- item{uri: uri, body: body}:
+		atomic.AddUint64(&r.queued, 1)
+	default:
+		r.overflow(uri, body)
+	}
+}
+
+func (r *Queue) overflow(uri string, body []byte) {
+	b := r.encode(uri, [][]byte{body})
+	r.save(b)
+}
+
+func (r *Queue) loop() {
+	defer r.wg.Done()
+
+	pending := make(map[string][][]byte)
+	tk := time.NewTicker(r.opt.Interval)
+	defer tk.Stop()
+
+	flush := func(uri string, closing bool) {
+		bodies := pending[uri]
+		if len(bodies) == 0 {
+			return
+		}
+		delete(pending, uri)
+		for len(bodies) > 0 {
+			n := len(bodies)
+			if n > r.opt.Batch {
+				n = r.opt.Batch
+			}
+			r.deliver(r.encode(uri, bodies[:n]), closing)
+			bodies = bodies[n:]
+		}
+	}
+
+	for {
+		select {
+		case it := <-r.queue:
+			pending[it.uri] = append(pending[it.uri], it.body)
+			if len(pending[it.uri]) >= r.opt.Batch {
+				flush(it.uri, false)
+			}
+
+		case <-tk.C:
+			for uri := range pending {
+				flush(uri, false)
+			}
+
+		case <-r.done:
+			// 关闭时把队列中剩余的数据尝试发送一次, 失败的写入 spool
+			for {
+				select {
+				case it := <-r.queue:
+					pending[it.uri] = append(pending[it.uri], it.body)
+					continue
+				default:
+				}
+				break
+			}
+			for uri := range pending {
+				flush(uri, true)
+			}
+			return
+		}
+	}
+}
+
+// encode 多条数据合并为 NDJSON
+func (r *Queue) encode(uri string, bodies [][]byte) *Batch {
+	var buf bytes.Buffer
+	for _, body := range bodies {
+		buf.Write(body)
+		buf.WriteByte('\n')
+	}
+
+	b := &Batch{URI: uri, Body: buf.Bytes(), Count: len(bodies)}
+	if !r.opt.Gzip {
+		return b
+	}
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	if _, err := w.Write(b.Body); err != nil || w.Close() != nil {
+		return b
+	}
+	b.Body = gz.Bytes()
+	b.Gzip = true
+	return b
+}
+
+func (r *Queue) backoff(n int) time.Duration {
+	d := r.opt.Backoff << uint(n)
+	if d <= 0 || d > r.opt.MaxBackoff {
+		d = r.opt.MaxBackoff
+	}
+	return d
+}
+
+// sleep 等待 d, 关闭时立即返回 false
+func (r *Queue) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+func (r *Queue) deliver(b *Batch, closing bool) {
+	for attempt := 0; ; attempt++ {
+		err := r.send(b)
+		if err == nil {
+			r.success(b)
+			return
+		}
+		r.setError(err)
+		if IsPermanent(err) {
+			r.drop(b)
+			return
+		}
+
+		if closing || attempt >= r.opt.Retry {
+			break
+		}
+		atomic.AddUint64(&r.retries, 1)
+		if !r.sleep(r.backoff(attempt)) {
+			break
+		}
+	}
+
+	atomic.AddUint64(&r.failed, 1)
+	r.save(b)
+}
+
+func (r *Queue) save(b *Batch) {
+	if r.spool == nil {
+		atomic.AddUint64(&r.dropped, uint64(b.Count))
+		return
+	}
+	if err := r.spool.Put(b); err != nil {
+		r.setError(err)
+		atomic.AddUint64(&r.dropped, uint64(b.Count))
+		return
+	}
+	atomic.AddUint64(&r.spooled, 1)
+}
+
+// replay 按时间顺序补发 spool 中的批次, 失败时指数退避
+// 同一个文件失败 opt.Replay 次之后移到一边, 避免一个批次阻塞整个 spool
+func (r *Queue) replay() {
+	defer r.wg.Done()
+
+	fails := 0
+	for {
+		name, b, err := r.spool.Oldest()
+		switch {
+		case err != nil && name != "":
+			// 损坏的文件直接删除
+			r.setError(err)
+			r.spool.Remove(name)
+			continue
+		case b == nil:
+			fails = 0
+			if !r.sleep(r.opt.Interval) {
+				return
+			}
+			continue
+		}
+
+		if err = r.send(b); err != nil {
+			r.setError(err)
+			if IsPermanent(err) {
+				r.spool.Remove(name)
+				r.drop(b)
+				fails = 0
+				continue
+			}
+			fails++
+			if fails >= r.opt.Replay {
+				r.spool.Reject(name)
+				r.drop(b)
+				fails = 0
+				continue
+			}
+			if !r.sleep(r.backoff(fails - 1)) {
+				return
+			}
+			continue
+		}
+
+		fails = 0
+		r.spool.Remove(name)
+		atomic.AddUint64(&r.replayed, 1)
+		r.success(b)
+
+		select {
+		case <-r.done:
+			return
+		default:
+		}
+	}
+}
+
+// drop 对端明确拒绝的批次, 重试也不会成功, 直接丢弃
+func (r *Queue) drop(b *Batch) {
+	atomic.AddUint64(&r.failed, 1)
+	atomic.AddUint64(&r.dropped, uint64(b.Count))
+}
+
+func (r *Queue) success(b *Batch) {
+	atomic.AddUint64(&r.sent, uint64(b.Count))
+	atomic.AddUint64(&r.batches, 1)
+	r.mu.Lock()
+	r.lastSuccess = time.Now()
+	r.mu.Unlock()
+}
+
+func (r *Queue) setError(err error) {
+	r.mu.Lock()
+	r.lastError = err.Error()
+	r.mu.Unlock()
+}
+
+func (r *Queue) Stats() Stats {
+	s := Stats{
+		Queued:   atomic.LoadUint64(&r.queued),
+		Sent:     atomic.LoadUint64(&r.sent),
+		Batches:  atomic.LoadUint64(&r.batches),
+		Retries:  atomic.LoadUint64(&r.retries),
+		Failed:   atomic.LoadUint64(&r.failed),
+		Spooled:  atomic.LoadUint64(&r.spooled),
+		Replayed: atomic.LoadUint64(&r.replayed),
+		Dropped:  atomic.LoadUint64(&r.dropped),
+		Pending:  len(r.queue),
+	}
+	if r.spool != nil {
+		s.SpoolPending = r.spool.Len()
+	}
+	r.mu.Lock()
+	s.LastError = r.lastError
+	s.LastSuccess = r.lastSuccess
+	r.mu.Unlock()
+	return s
+}
+
+// Close 停止接收, 剩余数据发送一次, 失败的写入 spool
+func (r *Queue) Close() {
+	r.once.Do(func() {
+		close(r.done)
+		r.wg.Wait()
+	})
+}
@@ -0,0 +1,132 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSender struct {
+	mu      sync.Mutex
+	fail    bool
+	batches []*Batch
+}
+
+func (f *fakeSender) send(b *Batch) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return errors.New("tunnel down")
+	}
+	f.batches = append(f.batches, b)
+	return nil
+}
+
+func (f *fakeSender) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, b := range f.batches {
+		n += b.Count
+	}
+	return n
+}
+
+func TestQueue_Batch(t *testing.T) {
+	f := &fakeSender{}
+	r, err := NewQueue(Option{Batch: 3, Interval: time.Hour}, f.send)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		r.Push("/a", []byte(`{"i":1}`))
+	}
+	r.Close()
+
+	if len(f.batches) != 1 || f.batches[0].Count != 3 {
+		t.Fatalf("want one batch of 3, got %d batches", len(f.batches))
+	}
+	if !bytes.Equal(f.batches[0].Body, []byte("{\"i\":1}\n{\"i\":1}\n{\"i\":1}\n")) {
+		t.Errorf("bad ndjson body %q", f.batches[0].Body)
+	}
+}
+
+func TestQueue_Spool(t *testing.T) {
+	dir := t.TempDir()
+	f := &fakeSender{fail: true}
+	opt := Option{Batch: 1, Interval: 10 * time.Millisecond, Retry: 1, Backoff: time.Millisecond, SpoolDir: dir}
+
+	r, err := NewQueue(opt, f.send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Push("/a", []byte(`{"i":1}`))
+	r.Push("/a", []byte(`{"i":2}`))
+	r.Close()
+
+	if st := r.Stats(); st.Sent != 0 || st.SpoolPending != 2 {
+		t.Fatalf("want 2 spooled batches, got %+v", st)
+	}
+
+	// 重启后从 spool 补发
+	f.fail = false
+	r, err = NewQueue(opt, f.send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for f.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.Close()
+
+	if st := r.Stats(); st.Replayed != 2 || st.SpoolPending != 0 {
+		t.Fatalf("want 2 replayed batches, got %+v", st)
+	}
+}
+
+func TestQueue_ReplayLimit(t *testing.T) {
+	dir := t.TempDir()
+	f := &fakeSender{fail: true}
+	opt := Option{Batch: 1, Interval: 10 * time.Millisecond, Retry: 1, Backoff: time.Millisecond,
+		MaxBackoff: time.Millisecond, SpoolDir: dir, Replay: 3}
+
+	r, err := NewQueue(opt, f.send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Push("/a", []byte(`{"i":1}`))
+
+	// 一直失败的批次被移到一边, spool 不再阻塞
+	deadline := time.Now().Add(2 * time.Second)
+	for r.Stats().Dropped == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.Close()
+
+	if st := r.Stats(); st.SpoolPending != 0 || st.Dropped != 1 {
+		t.Fatalf("want rejected batch, got %+v", st)
+	}
+	rejected, err := r.spool.list(rejectExt)
+	if err != nil || len(rejected) != 1 {
+		t.Fatalf("want one rejected file, got %d %v", len(rejected), err)
+	}
+}
+
+func TestQueue_Permanent(t *testing.T) {
+	dir := t.TempDir()
+	opt := Option{Batch: 1, Interval: 10 * time.Millisecond, Retry: 3, Backoff: time.Millisecond, SpoolDir: dir}
+	r, err := NewQueue(opt, func(*Batch) error { return Permanent(errors.New("bad request")) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Push("/a", []byte(`{"i":1}`))
+	r.Close()
+
+	if st := r.Stats(); st.SpoolPending != 0 || st.Dropped != 1 || st.Retries != 0 {
+		t.Fatalf("want dropped without retry, got %+v", st)
+	}
+}
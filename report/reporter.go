@@ -0,0 +1,206 @@
+package report
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 记录类型
+const (
+	KindService = "service"
+	KindHost    = "host"
+	KindPassive = "passive"
+	KindAsset   = "asset_merge" // 资产ID变化的合并记录
+)
+
+// Record 一条待输出的结果, Body 为 json
+type Record struct {
+	Kind string
+	URI  string // tunnel 上报地址, 为空时 tunnel 不发送
+	Body []byte
+}
+
+// Reporter 结果输出, Report 不能阻塞扫描流程
+type Reporter interface {
+	Name() string
+	Type() string
+	Report(rec *Record) error
+	Stats() Stats
+	Close() error
+}
+
+// Writer 把一个批次写到具体的目标, Batch.Body 为按行分隔的格式化结果
+type Writer interface {
+	Send(b *Batch) error
+	Close() error
+}
+
+// SinkConfig 单个输出的配置, 由 vela.radar{sinks = {...}} 设置
+type SinkConfig struct {
+	Type   string              // tunnel, file, syslog, kafka, elastic
+	Name   string              // 为空时使用 Type
+	Kinds  []string            // 只输出这些类型的记录, 为空输出全部
+	Filter map[string][]string // 字段 -> 允许的值, 字段支持 http_info.title 形式
+	Format string              // json, kv 或者 ${ip}:${port} 形式的模板
+	Queue  Option
+
+	// file
+	Path    string
+	MaxSize int64 // 单个文件最大字节数
+	Backups int   // 保留的历史文件数
+
+	// syslog
+	Addr     string // udp://host:514 或者 tcp://host:514
+	Facility int
+	AppName  string
+	Hostname string
+
+	// kafka
+	Brokers []string
+	Topic   string
+
+	// elastic
+	URL      string
+	Index    string // 包含 %s 时按天替换为 2006.01.02
+	User     string
+	Password string
+
+	Timeout time.Duration
+}
+
+func (cfg *SinkConfig) name() string {
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+	return cfg.Type
+}
+
+// Sink 通用的输出实现: 过滤 -> 格式化 -> 队列 -> Writer
+// tunnel 按上报地址分批, 其他输出使用记录类型作为批次地址
+type Sink struct {
+	name   string
+	typ    string
+	kinds  map[string]bool
+	filter *Filter
+	format string
+	tunnel bool
+	writer Writer
+	queue  *Queue
+}
+
+// Open 按配置创建输出, tunnel 类型使用 send 发送
+func Open(cfg SinkConfig, send Sender) (Reporter, error) {
+	var w Writer
+	var err error
+
+	tunnel := false
+	switch cfg.Type {
+	case "tunnel":
+		if send == nil {
+			return nil, fmt.Errorf("tunnel sender not available")
+		}
+		w, tunnel = senderWriter(send), true
+	case "file":
+		w, err = NewFileWriter(cfg.Path, cfg.MaxSize, cfg.Backups)
+	case "syslog":
+		w, err = NewSyslogWriter(cfg.Addr, cfg.Facility, cfg.AppName, cfg.Hostname, cfg.Timeout)
+	case "kafka":
+		w, err = NewKafkaWriter(cfg.Brokers, cfg.Topic, cfg.Timeout)
+	case "elastic":
+		w, err = NewElasticWriter(cfg.URL, cfg.Index, cfg.User, cfg.Password, cfg.Timeout)
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", cfg.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sink %s open fail %v", cfg.name(), err)
+	}
+
+	s := &Sink{
+		name:   cfg.name(),
+		typ:    cfg.Type,
+		filter: NewFilter(cfg.Filter),
+		format: cfg.Format,
+		tunnel: tunnel,
+		writer: w,
+	}
+	if len(cfg.Kinds) > 0 {
+		s.kinds = make(map[string]bool, len(cfg.Kinds))
+		for _, k := range cfg.Kinds {
+			s.kinds[k] = true
+		}
+	}
+
+	opt := cfg.Queue
+	if !tunnel {
+		// 其他输出需要逐行处理, 不压缩, spool 使用独立目录
+		opt.Gzip = false
+		if opt.SpoolDir != "" {
+			opt.SpoolDir = filepath.Join(opt.SpoolDir, s.name)
+		}
+	}
+
+	s.queue, err = NewQueue(opt, w.Send)
+	return s, err
+}
+
+func (s *Sink) Name() string { return s.name }
+func (s *Sink) Type() string { return s.typ }
+
+func (s *Sink) Report(rec *Record) error {
+	if s.tunnel && rec.URI == "" {
+		return nil
+	}
+	if s.kinds != nil && !s.kinds[rec.Kind] {
+		return nil
+	}
+
+	var doc map[string]interface{}
+	if !s.filter.Empty() || !isJSONFormat(s.format) {
+		var err error
+		if doc, err = decode(rec.Body); err != nil {
+			return err
+		}
+	}
+	if !s.filter.Match(doc) {
+		return nil
+	}
+
+	body := rec.Body
+	if !isJSONFormat(s.format) {
+		body = Format(s.format, doc)
+	}
+
+	uri := rec.Kind
+	if s.tunnel {
+		uri = rec.URI
+	}
+	s.queue.Push(uri, body)
+	return nil
+}
+
+func (s *Sink) Stats() Stats {
+	return s.queue.Stats()
+}
+
+func (s *Sink) Close() error {
+	s.queue.Close()
+	return s.writer.Close()
+}
+
+type senderWriter Sender
+
+func (fn senderWriter) Send(b *Batch) error { return fn(b) }
+func (fn senderWriter) Close() error        { return nil }
+
+// lines 按行拆分批次, 忽略空行
+func lines(b *Batch) []string {
+	var out []string
+	for _, line := range strings.Split(string(b.Body), "\n") {
+		if line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
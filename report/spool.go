@@ -0,0 +1,163 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	spoolExt  = ".spool"
+	rejectExt = ".rejected" // 多次补发失败的文件, 保留用于排查, 计入容量并且优先删除
+)
+
+// Spool 上报失败的批次保存在本地目录, 重启后继续发送
+// 文件内容: 第一行为上报地址, 第二行为 "条数 gzip|plain", 之后为批次的原始数据
+type Spool struct {
+	mu      sync.Mutex
+	dir     string
+	maxSize int64
+}
+
+func NewSpool(dir string, maxSize int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Spool{dir: dir, maxSize: maxSize}, nil
+}
+
+// Put 保存一个批次, 超过容量时删除最旧的文件
+func (sp *Spool) Put(b *Batch) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	var buf bytes.Buffer
+	encoding := "plain"
+	if b.Gzip {
+		encoding = "gzip"
+	}
+	fmt.Fprintf(&buf, "%s\n%d %s\n", b.URI, b.Count, encoding)
+	buf.Write(b.Body)
+
+	name := filepath.Join(sp.dir, fmt.Sprintf("%d%s", time.Now().UnixNano(), spoolExt))
+	if err := os.WriteFile(name+".tmp", buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	sp.trim()
+	return nil
+}
+
+func (sp *Spool) files() ([]os.DirEntry, error) {
+	return sp.list(spoolExt)
+}
+
+func (sp *Spool) list(ext string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(sp.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := entries[:0]
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ext) {
+			files = append(files, e)
+		}
+	}
+	// 文件名为纳秒时间戳, 按名称排序即按时间排序
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	return files, nil
+}
+
+// trim 删除最旧的文件直到总大小不超过 maxSize, 先删除被拒绝的文件
+func (sp *Spool) trim() {
+	if sp.maxSize <= 0 {
+		return
+	}
+	rejected, err := sp.list(rejectExt)
+	if err != nil {
+		return
+	}
+	files, err := sp.files()
+	if err != nil {
+		return
+	}
+	files = append(rejected, files...)
+
+	var total int64
+	sizes := make([]int64, len(files))
+	for i, f := range files {
+		if info, err := f.Info(); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	for i := 0; total > sp.maxSize && i < len(files)-1; i++ {
+		if os.Remove(filepath.Join(sp.dir, files[i].Name())) == nil {
+			total -= sizes[i]
+		}
+	}
+}
+
+// Oldest 最旧的批次, 没有时返回 nil
+func (sp *Spool) Oldest() (string, *Batch, error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	files, err := sp.files()
+	if err != nil || len(files) == 0 {
+		return "", nil, err
+	}
+
+	name := filepath.Join(sp.dir, files[0].Name())
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return name, nil, err
+	}
+
+	parts := bytes.SplitN(data, []byte{'\n'}, 3)
+	if len(parts) != 3 {
+		return name, nil, errors.New("invalid spool file")
+	}
+
+	b := &Batch{URI: string(parts[0]), Body: parts[2]}
+	var encoding string
+	if _, err = fmt.Sscanf(string(parts[1]), "%d %s", &b.Count, &encoding); err != nil {
+		return name, nil, fmt.Errorf("invalid spool file header %v", err)
+	}
+	b.Gzip = encoding == "gzip"
+	return name, b, nil
+}
+
+func (sp *Spool) Remove(name string) {
+	sp.mu.Lock()
+	_ = os.Remove(name)
+	sp.mu.Unlock()
+}
+
+// Reject 把多次补发失败的文件改名移到一边, 不再参与补发
+func (sp *Spool) Reject(name string) {
+	sp.mu.Lock()
+	if err := os.Rename(name, strings.TrimSuffix(name, spoolExt)+rejectExt); err != nil {
+		_ = os.Remove(name)
+	}
+	sp.mu.Unlock()
+}
+
+// Len 等待发送的批次数
+func (sp *Spool) Len() int {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	files, err := sp.files()
+	if err != nil {
+		return 0
+	}
+	return len(files)
+}
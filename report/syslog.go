@@ -0,0 +1,127 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	syslogDefaultFacility = 16 // local0
+	syslogSeverityInfo    = 6
+)
+
+// SyslogWriter RFC5424 格式的 syslog, tcp 使用 RFC6587 长度前缀分帧
+// MSGID 为记录类型(service/host/passive)
+type SyslogWriter struct {
+	mu       sync.Mutex
+	network  string
+	addr     string
+	facility int
+	app      string
+	hostname string
+	timeout  time.Duration
+	conn     net.Conn
+}
+
+func NewSyslogWriter(addr string, facility int, app, hostname string, timeout time.Duration) (*SyslogWriter, error) {
+	if addr == "" {
+		return nil, errors.New("syslog addr is empty")
+	}
+
+	network := "udp"
+	if strings.Contains(addr, "://") {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, err
+		}
+		network, addr = u.Scheme, u.Host
+	}
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("syslog network %q not support", network)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "514")
+	}
+
+	if facility <= 0 || facility > 23 {
+		facility = syslogDefaultFacility
+	}
+	if app == "" {
+		app = "vela-radar"
+	}
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	if hostname == "" {
+		hostname = "-"
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	return &SyslogWriter{
+		network:  network,
+		addr:     addr,
+		facility: facility,
+		app:      app,
+		hostname: hostname,
+		timeout:  timeout,
+	}, nil
+}
+
+// message <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (w *SyslogWriter) message(msgid, msg string) string {
+	if msgid == "" {
+		msgid = "-"
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		w.facility*8+syslogSeverityInfo,
+		time.Now().Format(time.RFC3339Nano),
+		w.hostname, w.app, os.Getpid(), msgid, msg)
+}
+
+func (w *SyslogWriter) Send(b *Batch) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.network, w.addr, w.timeout)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+
+	for _, line := range lines(b) {
+		msg := w.message(b.URI, line)
+		if w.network == "tcp" {
+			msg = fmt.Sprintf("%d %s", len(msg), msg)
+		}
+
+		_ = w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+		if _, err := w.conn.Write([]byte(msg)); err != nil {
+			// 连接断开后下次重新建立, 整个批次重发
+			w.conn.Close()
+			w.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
@@ -0,0 +1,56 @@
+package radar
+
+import (
+	"sync"
+)
+
+// 单个任务在内存中保留的最大服务数, 超过后只计数, 导出时提示结果不完整
+const taskResultLimit = 50000
+
+// resultTable 任务的扫描结果, 用于导出
+type resultTable struct {
+	mu       sync.Mutex
+	services []*Service
+	hosts    []*Host
+	dropped  int
+}
+
+func newResultTable() *resultTable {
+	return &resultTable{}
+}
+
+func (rt *resultTable) AddService(s *Service) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if len(rt.services) >= taskResultLimit {
+		rt.dropped++
+		return
+	}
+	rt.services = append(rt.services, s)
+}
+
+func (rt *resultTable) AddHost(h *Host) {
+	rt.mu.Lock()
+	rt.hosts = append(rt.hosts, h)
+	rt.mu.Unlock()
+}
+
+// Snapshot 当前结果的副本以及因为超过上限而丢弃的服务数
+func (rt *resultTable) Snapshot() ([]*Service, []*Host, int) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return append([]*Service(nil), rt.services...), append([]*Host(nil), rt.hosts...), rt.dropped
+}
+
+// taskById 当前任务或者上一次任务, id 为空时优先返回当前任务
+func (rad *Radar) taskById(id string) *Task {
+	for _, t := range []*Task{rad.task, rad.lastTask} {
+		if t == nil {
+			continue
+		}
+		if id == "" || t.Id == id {
+			return t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,384 @@
+// Package rule 结果过滤规则使用的表达式
+//
+// eg: protocol = redis and not ip cidr 10.0.0.0/8
+//
+//	port in 5000,5001 or http_info.title ~ "(?i)printer"
+//
+// 字段为结果 json 中的 a.b.c 路径, 数组字段任意元素匹配即可
+// 运算符: = != ~(正则) !~ > >= < <= in(逗号分隔) cidr(逗号分隔) contains(子串)
+// 比较忽略大小写, 可以使用 and/or/not 以及括号组合
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Expr 编译后的表达式
+type Expr interface {
+	Match(doc map[string]interface{}) bool
+}
+
+type andExpr struct{ left, right Expr }
+
+func (e *andExpr) Match(doc map[string]interface{}) bool {
+	return e.left.Match(doc) && e.right.Match(doc)
+}
+
+type orExpr struct{ left, right Expr }
+
+func (e *orExpr) Match(doc map[string]interface{}) bool {
+	return e.left.Match(doc) || e.right.Match(doc)
+}
+
+type notExpr struct{ expr Expr }
+
+func (e *notExpr) Match(doc map[string]interface{}) bool {
+	return !e.expr.Match(doc)
+}
+
+type cmpExpr struct {
+	field  string
+	op     string
+	values []string // 小写
+	num    float64
+	re     *regexp.Regexp
+	nets   []*net.IPNet
+}
+
+func (e *cmpExpr) Match(doc map[string]interface{}) bool {
+	v, ok := Lookup(doc, e.field)
+	if !ok {
+		// 字段不存在时只有否定的比较成立
+		return e.op == "!=" || e.op == "!~"
+	}
+
+	items := []interface{}{v}
+	if arr, ok := v.([]interface{}); ok {
+		items = arr
+	}
+
+	// 否定比较要求所有元素都不匹配
+	switch e.op {
+	case "!=":
+		return !e.any(items, "=")
+	case "!~":
+		return !e.any(items, "~")
+	}
+	return e.any(items, e.op)
+}
+
+func (e *cmpExpr) any(items []interface{}, op string) bool {
+	for _, item := range items {
+		if e.one(Text(item), op) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *cmpExpr) one(s string, op string) bool {
+	switch op {
+	case "=", "in":
+		s = strings.ToLower(s)
+		for _, v := range e.values {
+			if s == v {
+				return true
+			}
+		}
+	case "contains":
+		return strings.Contains(strings.ToLower(s), e.values[0])
+	case "~":
+		return e.re.MatchString(s)
+	case "cidr":
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return false
+		}
+		for _, n := range e.nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+	case ">", ">=", "<", "<=":
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return false
+		}
+		switch op {
+		case ">":
+			return n > e.num
+		case ">=":
+			return n >= e.num
+		case "<":
+			return n < e.num
+		default:
+			return n <= e.num
+		}
+	}
+	return false
+}
+
+// Lookup 按 a.b.c 形式读取嵌套字段
+func Lookup(doc map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// Text 字段的文本形式, 对象使用 json
+func Text(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		chunk, _ := json.Marshal(val)
+		return string(chunk)
+	}
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+func tokenize(src string) ([]token, error) {
+	var out []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			out = append(out, token{text: string(c)})
+			i++
+		case c == '"' || c == '\'':
+			var buf strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				buf.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, errors.New("unterminated string")
+			}
+			out = append(out, token{text: buf.String(), quoted: true})
+			i = j + 1
+		case strings.IndexByte("=!~<>", c) >= 0:
+			j := i + 1
+			if j < len(src) && (src[j] == '=' || src[j] == '~') {
+				j++
+			}
+			out = append(out, token{text: src[i:j]})
+			i = j
+		default:
+			j := i
+			for j < len(src) && strings.IndexByte(" \t\r\n()=!~<>\"'", src[j]) < 0 {
+				j++
+			}
+			out = append(out, token{text: src[i:j]})
+			i = j
+		}
+	}
+	return out, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// keyword 当前 token 是否为指定的关键字(不区分大小写)
+func (p *parser) keyword(words ...string) bool {
+	t, ok := p.peek()
+	if !ok || t.quoted {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(t.text, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or", "||") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and", "&&") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.keyword("not", "!") {
+		p.pos++
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{e}, nil
+	}
+
+	if p.keyword("(") {
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			return nil, errors.New("missing )")
+		}
+		p.pos++
+		return e, nil
+	}
+	return p.parseCmp()
+}
+
+var operators = map[string]bool{
+	"=": true, "==": true, "!=": true, "~": true, "!~": true,
+	">": true, ">=": true, "<": true, "<=": true,
+	"in": true, "cidr": true, "contains": true,
+}
+
+func (p *parser) parseCmp() (Expr, error) {
+	field, ok := p.peek()
+	if !ok {
+		return nil, errors.New("unexpected end of expression")
+	}
+	if field.quoted || field.text == ")" {
+		return nil, fmt.Errorf("expect field, got %q", field.text)
+	}
+	p.pos++
+
+	opTok, ok := p.peek()
+	op := strings.ToLower(opTok.text)
+	if !ok || opTok.quoted || !operators[op] {
+		return nil, fmt.Errorf("expect operator after %s", field.text)
+	}
+	p.pos++
+	if op == "==" {
+		op = "="
+	}
+
+	val, ok := p.peek()
+	if !ok || (!val.quoted && (val.text == "(" || val.text == ")")) {
+		return nil, fmt.Errorf("expect value after %s %s", field.text, op)
+	}
+	p.pos++
+
+	e := &cmpExpr{field: field.text, op: op}
+	switch op {
+	case "~", "!~":
+		re, err := regexp.Compile(val.text)
+		if err != nil {
+			return nil, fmt.Errorf("bad regexp %q: %v", val.text, err)
+		}
+		e.re = re
+	case ">", ">=", "<", "<=":
+		n, err := strconv.ParseFloat(val.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s need a number, got %q", field.text, op, val.text)
+		}
+		e.num = n
+	case "cidr":
+		for _, item := range strings.Split(val.text, ",") {
+			item = strings.TrimSpace(item)
+			if !strings.Contains(item, "/") {
+				if strings.Contains(item, ":") {
+					item += "/128"
+				} else {
+					item += "/32"
+				}
+			}
+			_, n, err := net.ParseCIDR(item)
+			if err != nil {
+				return nil, fmt.Errorf("bad cidr %q", item)
+			}
+			e.nets = append(e.nets, n)
+		}
+	case "in":
+		for _, item := range strings.Split(val.text, ",") {
+			e.values = append(e.values, strings.ToLower(strings.TrimSpace(item)))
+		}
+	default:
+		e.values = []string{strings.ToLower(val.text)}
+	}
+	return e, nil
+}
+
+// Parse 编译表达式
+func Parse(src string) (Expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty expression")
+	}
+
+	p := &parser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.peek(); ok {
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+	return e, nil
+}
@@ -0,0 +1,179 @@
+package rule
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 命中后的动作
+const (
+	ActionDrop  = "drop"  // 丢弃, 不进入 pipe, 输出和本地库
+	ActionTag   = "tag"   // 追加标签后继续匹配后面的规则
+	ActionRoute = "route" // 只发送到指定的输出
+)
+
+// Rule 过滤规则, Kind 为空时对 service 和 host 都生效
+type Rule struct {
+	Name   string   `json:"name"`
+	Expr   string   `json:"expr"`
+	Kind   []string `json:"kind"`
+	Action string   `json:"action"`
+	Tag    string   `json:"tag,omitempty"`
+	Sink   string   `json:"sink,omitempty"`
+	Hits   uint64   `json:"hits"`
+
+	expr Expr
+}
+
+// Compile 检查参数并编译表达式
+func (r *Rule) Compile() error {
+	if r.Action == "" {
+		r.Action = ActionDrop
+	}
+	switch r.Action {
+	case ActionDrop:
+	case ActionTag:
+		if r.Tag == "" {
+			return errors.New("tag rule need tag")
+		}
+	case ActionRoute:
+		if r.Sink == "" {
+			return errors.New("route rule need sink")
+		}
+	default:
+		return fmt.Errorf("rule action %q not support, use drop/tag/route", r.Action)
+	}
+
+	e, err := Parse(r.Expr)
+	if err != nil {
+		return fmt.Errorf("rule %s: %v", r.Name, err)
+	}
+	r.expr = e
+	return nil
+}
+
+func (r *Rule) match(kind string, doc map[string]interface{}) bool {
+	if len(r.Kind) > 0 {
+		ok := false
+		for _, k := range r.Kind {
+			if strings.EqualFold(k, kind) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return r.expr.Match(doc)
+}
+
+// Verdict 一条记录的匹配结果, Rule 为决定 Action 的规则
+type Verdict struct {
+	Action string
+	Rule   string
+	Sink   string
+	Tags   []string
+	Tagged []string // 追加了标签的规则
+}
+
+// Set 按顺序匹配的规则列表, 可以并发修改
+type Set struct {
+	mu    sync.RWMutex
+	rules []*Rule
+	seq   int
+}
+
+func NewSet() *Set {
+	return &Set{}
+}
+
+// Put 添加规则, 同名规则替换原来的规则并保持位置
+func (s *Set) Put(r Rule) error {
+	if err := r.Compile(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Name == "" {
+		s.seq++
+		r.Name = fmt.Sprintf("rule-%d", s.seq)
+	}
+	for i, old := range s.rules {
+		if old.Name == r.Name {
+			s.rules[i] = &r
+			return nil
+		}
+	}
+	s.rules = append(s.rules, &r)
+	return nil
+}
+
+func (s *Set) Remove(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range s.rules {
+		if r.Name == name {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.rules)
+}
+
+// List 规则以及命中次数
+func (s *Set) List() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Rule, 0, len(s.rules))
+	for _, r := range s.rules {
+		c := *r
+		c.Hits = atomic.LoadUint64(&r.Hits)
+		out = append(out, c)
+	}
+	return out
+}
+
+// Eval 依次匹配, tag 规则累积标签, 遇到 drop/route 规则停止; 都没有命中时返回 nil
+func (s *Set) Eval(kind string, doc map[string]interface{}) *Verdict {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var v *Verdict
+	for _, r := range s.rules {
+		if !r.match(kind, doc) {
+			continue
+		}
+		atomic.AddUint64(&r.Hits, 1)
+		if v == nil {
+			v = &Verdict{}
+		}
+
+		if r.Action == ActionTag {
+			v.Tags = append(v.Tags, r.Tag)
+			v.Tagged = append(v.Tagged, r.Name)
+			continue
+		}
+		v.Action = r.Action
+		v.Rule = r.Name
+		v.Sink = r.Sink
+		return v
+	}
+	if v != nil {
+		v.Action = ActionTag
+	}
+	return v
+}
@@ -0,0 +1,88 @@
+package rule
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func doc(t *testing.T, s string) map[string]interface{} {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestParse(t *testing.T) {
+	d := doc(t, `{"ip":"10.1.2.3","port":9100,"protocol":"HTTP","component":["nginx","php"],
+		"http_info":{"title":"HP LaserJet Printer","status_code":200}}`)
+
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{`protocol = http`, true},
+		{`protocol == "https"`, false},
+		{`port in 9100,515,631`, true},
+		{`ip cidr 10.0.0.0/8,192.168.0.0/16`, true},
+		{`ip cidr 10.1.2.4`, false},
+		{`http_info.title ~ "(?i)laserjet"`, true},
+		{`http_info.status_code >= 400`, false},
+		{`component = PHP`, true},
+		{`component != php`, false},
+		{`component contains ngi`, true},
+		{`http_info.server != nginx`, true},
+		{`protocol = http and not (port = 80 or port = 443)`, true},
+		{`protocol = redis || port > 9000 && ip cidr 10.0.0.0/8`, true},
+		{`! protocol = http`, false},
+	}
+	for _, c := range cases {
+		e, err := Parse(c.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+		if got := e.Match(d); got != c.want {
+			t.Errorf("%s: want %v, got %v", c.expr, c.want, got)
+		}
+	}
+
+	for _, bad := range []string{``, `port`, `port in`, `port > abc`, `(port = 1`, `port = 1 port = 2`, `title ~ "("`, `ip cidr x`} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("%q should fail", bad)
+		}
+	}
+}
+
+func TestSet_Eval(t *testing.T) {
+	s := NewSet()
+	for _, r := range []Rule{
+		{Name: "printer", Expr: `port in 9100,515`, Action: ActionTag, Tag: "printer"},
+		{Name: "self", Expr: `ip = 10.0.0.1`, Kind: []string{"service"}},
+		{Name: "redis", Expr: `protocol = redis`, Action: ActionRoute, Sink: "kafka"},
+	} {
+		if err := s.Put(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put(Rule{Expr: "port = 1", Action: ActionRoute}); err == nil {
+		t.Error("route without sink should fail")
+	}
+
+	v := s.Eval("service", doc(t, `{"ip":"10.0.0.1","port":9100}`))
+	if v == nil || v.Action != ActionDrop || v.Rule != "self" || len(v.Tags) != 1 || v.Tags[0] != "printer" {
+		t.Errorf("unexpected verdict %+v", v)
+	}
+	if v = s.Eval("host", doc(t, `{"ip":"10.0.0.1"}`)); v != nil {
+		t.Errorf("service rule should not match hosts, got %+v", v)
+	}
+	if v = s.Eval("service", doc(t, `{"ip":"10.0.0.2","protocol":"redis"}`)); v == nil || v.Action != ActionRoute || v.Sink != "kafka" {
+		t.Errorf("unexpected verdict %+v", v)
+	}
+
+	if !s.Remove("self") || s.Len() != 2 {
+		t.Error("remove fail")
+	}
+	if hits := s.List()[0].Hits; hits != 1 {
+		t.Errorf("printer hits want 1, got %d", hits)
+	}
+}
@@ -0,0 +1,217 @@
+package radar
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vela-ssoc/vela-radar/fingerprintx/plugins"
+	"github.com/vela-ssoc/vela-radar/fingerprintx/scan"
+	"github.com/vela-ssoc/vela-radar/util"
+)
+
+const safeDefaultDelay = 200 // 安全模式下同一主机两次探测的间隔(ms)
+
+// icsPorts 常见工控协议端口, 用于安全模式下推测协议以及端口排序
+var icsPorts = map[uint16]string{
+	102:   "s7comm",
+	502:   "modbus",
+	789:   "crimson",
+	1089:  "ff-annunciation",
+	1911:  "fox",
+	1962:  "pcworx",
+	2222:  "ethernet-ip-io",
+	2404:  "iec-104",
+	2455:  "codesys",
+	4000:  "ge-emerson",
+	4840:  "opc-ua",
+	4911:  "fox",
+	5007:  "melsec",
+	9600:  "omron-fins",
+	18245: "ge-srtp",
+	20000: "dnp3",
+	20547: "proconos",
+	34962: "profinet",
+	44818: "ethernet-ip",
+	47808: "bacnet",
+}
+
+// icsShared 与常见 IT 服务共用的端口(alt-ssh, webmin/usermin 等), 只凭端口不能判断为工控设备
+var icsShared = map[uint16]bool{
+	2222:  true,
+	4000:  true,
+	5007:  true,
+	9600:  true,
+	20000: true,
+}
+
+// icsVendors 工控设备厂商关键字, 按单词匹配组播发现到的厂商/型号/服务器信息
+var icsVendors = regexp.MustCompile(`(?i)\b(siemens|simatic|rockwell|allen-bradley|schneider|modicon|` +
+	`omron|mitsubishi|honeywell|abb|emerson|yokogawa|beckhoff|phoenix contact|wago|moxa|hirschmann|` +
+	`ge fanuc|delta electronics|advantech|b&r|koyo|niagara|tridium)\b`)
+
+// safeTable 安全模式的主机, 只做端口开放检查和被动 banner 读取, 不发送协议载荷
+type safeTable struct {
+	mu     sync.Mutex
+	all    bool
+	auto   bool
+	ranges *util.IPSet
+	delay  time.Duration
+	hosts  map[string]string // ip -> 原因
+}
+
+func newSafeTable(opt Option) *safeTable {
+	delay := opt.SafeDelay
+	if delay <= 0 {
+		delay = safeDefaultDelay
+	}
+	return &safeTable{
+		all:    opt.Safe,
+		auto:   opt.SafeAuto,
+		ranges: util.NewIPSet(opt.SafeTarget),
+		delay:  time.Duration(delay) * time.Millisecond,
+		hosts:  make(map[string]string),
+	}
+}
+
+// Check 主机是否处于安全模式
+func (st *safeTable) Check(ip net.IP) bool {
+	if st.all || st.ranges.Contains(ip) {
+		return true
+	}
+	st.mu.Lock()
+	_, ok := st.hosts[ip.String()]
+	st.mu.Unlock()
+	return ok
+}
+
+func (st *safeTable) Mark(ip net.IP, reason string) {
+	st.mu.Lock()
+	if _, ok := st.hosts[ip.String()]; !ok {
+		st.hosts[ip.String()] = reason
+	}
+	st.mu.Unlock()
+}
+
+// Reason 进入安全模式的原因, 不是安全模式返回空
+func (st *safeTable) Reason(ip net.IP) string {
+	st.mu.Lock()
+	reason, ok := st.hosts[ip.String()]
+	st.mu.Unlock()
+	switch {
+	case ok:
+		return reason
+	case st.all:
+		return "task"
+	case st.ranges.Contains(ip):
+		return "target"
+	}
+	return ""
+}
+
+// Inspect 按组播发现到的设备信息判断是否为工控设备
+func (st *safeTable) Inspect(ip net.IP, devices *deviceTable) {
+	if !st.auto || devices == nil {
+		return
+	}
+	d := devices.Get(ip)
+	if d == nil {
+		return
+	}
+	text := strings.Join([]string{d.Vendor, d.Model, d.Server, d.Type}, " ")
+	if v := icsVendors.FindString(text); v != "" {
+		st.Mark(ip, "vendor "+strings.ToLower(v))
+	}
+}
+
+// Port 开放工控专用端口的主机进入安全模式, 共用端口需要组播发现到的厂商信息
+func (st *safeTable) Port(ip net.IP, p uint16) {
+	if !st.auto || icsShared[p] {
+		return
+	}
+	if name, ok := icsPorts[p]; ok {
+		st.Mark(ip, fmt.Sprintf("port %d/%s", p, name))
+	}
+}
+
+// Throttle 安全模式的主机每次探测前等待
+func (st *safeTable) Throttle(ip net.IP) {
+	if st.Check(ip) {
+		time.Sleep(st.delay)
+	}
+}
+
+func (st *safeTable) Summary() map[string]interface{} {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	hosts := make(map[string]string, len(st.hosts))
+	for k, v := range st.hosts {
+		hosts[k] = v
+	}
+	return map[string]interface{}{
+		"all":   st.all,
+		"auto":  st.auto,
+		"delay": st.delay.Milliseconds(),
+		"hosts": hosts,
+	}
+}
+
+// icsFirst 工控端口放到最前面, 尽早发现工控主机
+func icsFirst(ports []uint16) []uint16 {
+	out := make([]uint16, 0, len(ports))
+	for _, p := range ports {
+		if _, ok := icsPorts[p]; ok {
+			out = append(out, p)
+		}
+	}
+	for _, p := range ports {
+		if _, ok := icsPorts[p]; !ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// safeService 安全模式下只读取服务主动发送的 banner, 协议按端口推测
+func (rad *Radar) safeService(tx *Tx, reason string) *Service {
+	addr, _ := netip.AddrFromSlice(tx.Entry.Ip)
+	target := plugins.Target{
+		Address: netip.AddrPortFrom(addr.Unmap(), tx.Entry.Port),
+		Host:    "localhost",
+	}
+
+	s := &Service{
+		IP:        tx.Entry.Ip,
+		Port:      tx.Entry.Port,
+		Protocol:  plugins.ProtoUnknown,
+		Location:  rad.task.Option.Location,
+		Transport: "tcp",
+		TaskId:    rad.task.Id,
+		Comment:   "safe mode: " + reason,
+	}
+	if name, ok := icsPorts[tx.Entry.Port]; ok {
+		s.Protocol = name
+	}
+
+	rad.names(tx, s)
+	rad.device(s)
+
+	b, err := scan.PassiveBanner(target, rad.cfg.FxConfig.DefaultTimeout)
+	if err != nil {
+		return s
+	}
+	s.Elapsed = b.Elapsed.Milliseconds()
+	if len(b.Raw) > 0 {
+		s.Banner = util.ToJsonBytes(map[string]string{
+			"probe": b.Probe,
+			"hex":   hex.EncodeToString(b.Raw),
+			"text":  util.Printable(b.Raw),
+		})
+	}
+	return s
+}
@@ -0,0 +1,160 @@
+package radar
+
+import (
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jackpal/gateway"
+	"github.com/vela-ssoc/vela-kit/iputil"
+	"github.com/vela-ssoc/vela-radar/port/syn"
+	"github.com/vela-ssoc/vela-radar/util"
+)
+
+// 自动排除的地址类别
+const (
+	skipSelf     = "self"     // 本机网卡地址
+	skipGateway  = "gateway"  // 到目标的网关以及默认网关
+	skipBoundary = "boundary" // 本机网卡所在网段的网络地址和广播地址
+)
+
+// selfTable 任务自动排除的地址, 扫描这些地址没有意义, 网关还容易触发入侵检测规则
+type selfTable struct {
+	mu     sync.Mutex
+	addrs  map[string]string // ip -> 类别
+	counts map[string]int    // 类别 -> 跳过的数量
+}
+
+func newSelfTable(opt Option, items []string) *selfTable {
+	st := &selfTable{
+		addrs:  make(map[string]string),
+		counts: make(map[string]int),
+	}
+
+	if opt.SkipSelf || opt.SkipBoundary {
+		for _, ipn := range localNets() {
+			if opt.SkipSelf {
+				st.put(ipn.IP, skipSelf)
+			}
+			// 只有本机网卡所在的网段才能确定真实的边界, 目标 CIDR 只是扫描范围, 不一定是子网
+			if opt.SkipBoundary {
+				ones, _ := ipn.Mask.Size()
+				st.boundary(ipn.IP, ones)
+			}
+		}
+	}
+
+	if opt.SkipGateway {
+		st.gateways(items)
+	}
+	return st
+}
+
+// localNets 本机网卡的地址以及所在网段
+func localNets() []*net.IPNet {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		xEnv.Errorf("radar list interface addrs fail %v", err)
+		return nil
+	}
+	var nets []*net.IPNet
+	for _, addr := range addrs {
+		if ipn, ok := addr.(*net.IPNet); ok {
+			nets = append(nets, ipn)
+		}
+	}
+	return nets
+}
+
+// put 同一个地址只记录第一个类别
+func (st *selfTable) put(ip net.IP, class string) {
+	if ip == nil || ip.IsUnspecified() {
+		return
+	}
+	key := ip.String()
+	if _, ok := st.addrs[key]; !ok {
+		st.addrs[key] = class
+	}
+}
+
+// boundary 记录 ipv4 网段的网络地址和广播地址, /31 /32 没有边界地址
+func (st *selfTable) boundary(ip net.IP, ones int) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok || !addr.Unmap().Is4() || ones >= 31 {
+		return
+	}
+	p, err := addr.Unmap().Prefix(ones)
+	if err != nil {
+		return
+	}
+	st.put(p.Addr().AsSlice(), skipBoundary)
+	st.put(util.PrefixRange(p).Hi.AsSlice(), skipBoundary)
+}
+
+// gateways 按目标的第一个地址查询路由, 同一个 /24 只查询一次, 查询失败时使用默认网关
+func (st *selfTable) gateways(items []string) {
+	seen := make(map[string]bool)
+	found := false
+	for _, item := range items {
+		_, first, err := iputil.NewIter(strings.TrimSpace(item))
+		if err != nil || first.To4() == nil {
+			continue
+		}
+		key := first.Mask(net.CIDRMask(24, 32)).String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		_, _, gw, _, err := syn.GetRouterV4(first)
+		if err != nil || gw == nil {
+			continue
+		}
+		st.put(gw, skipGateway)
+		found = true
+	}
+
+	if found {
+		return
+	}
+	if gw, err := gateway.DiscoverGateway(); err == nil {
+		st.put(gw, skipGateway)
+	}
+}
+
+// Check 地址需要跳过时返回类别并计数
+func (st *selfTable) Check(ip net.IP) string {
+	if st == nil {
+		return ""
+	}
+	class, ok := st.addrs[ip.String()]
+	if !ok {
+		return ""
+	}
+	st.mu.Lock()
+	st.counts[class]++
+	st.mu.Unlock()
+	return class
+}
+
+func (st *selfTable) Summary() map[string]interface{} {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	counts := map[string]int{skipSelf: 0, skipGateway: 0, skipBoundary: 0}
+	for k, v := range st.counts {
+		counts[k] = v
+	}
+	addrs := make(map[string][]string)
+	for ip, class := range st.addrs {
+		addrs[class] = append(addrs[class], ip)
+	}
+	for _, v := range addrs {
+		sort.Strings(v)
+	}
+	return map[string]interface{}{
+		"skipped": counts,
+		"addrs":   addrs,
+	}
+}
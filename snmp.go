@@ -0,0 +1,91 @@
+package radar
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vela-ssoc/vela-radar/host"
+	"github.com/vela-ssoc/vela-radar/port"
+)
+
+const maxSNMPTargets = 4096 // 单个任务通过 ARP/路由表最多追加的目标数
+
+// snmpTable 任务内 SNMP 读取结果的统计以及学习到的邻居ip
+type snmpTable struct {
+	mu      sync.Mutex
+	hosts   int
+	learned map[string]bool
+	order   []string
+}
+
+func newSNMPTable() *snmpTable {
+	return &snmpTable{learned: make(map[string]bool)}
+}
+
+func (st *snmpTable) add(info *host.SNMPInfo, learn bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.hosts++
+	if !learn {
+		return
+	}
+	for _, ip := range info.Neighbors() {
+		key := ip.String()
+		if st.learned[key] || len(st.order) >= maxSNMPTargets {
+			continue
+		}
+		st.learned[key] = true
+		st.order = append(st.order, key)
+	}
+}
+
+// Targets 学习到的且不在任务目标中的ip
+func (st *snmpTable) Targets(items []string) []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var targets []string
+	for _, ip := range st.order {
+		if !inTargets(items, net.ParseIP(ip)) {
+			targets = append(targets, ip)
+		}
+	}
+	return targets
+}
+
+func (st *snmpTable) Summary() map[string]interface{} {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return map[string]interface{}{
+		"hosts":   st.hosts,
+		"learned": len(st.order),
+	}
+}
+
+// querySNMP 读取主机的 SNMP 信息, 成功时作为 udp/161 服务上报
+func (t *Task) querySNMP(ip net.IP) {
+	info, err := host.QuerySNMP(ip, 161, t.rad.cfg.SNMP, time.Duration(t.Option.Timeout)*time.Millisecond)
+	if err != nil {
+		if t.rad.cfg.Debug || t.Debug {
+			xEnv.Infof("snmp %s fail %v", ip, err)
+		}
+		return
+	}
+	t.snmp.add(info, t.Option.SNMPLearn)
+
+	tx := &Tx{Entry: port.OpenIpPort{Ip: ip, Port: 161}, Param: t.Option}
+	s := &Service{
+		IP:        ip,
+		Port:      161,
+		Protocol:  "snmp",
+		Transport: "udp",
+		Version:   info.Version,
+		Location:  t.Option.Location,
+		TaskId:    t.Id,
+		SNMP:      info,
+	}
+	t.rad.names(tx, s)
+	t.rad.device(s)
+	t.rad.handle(s)
+}
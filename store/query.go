@@ -0,0 +1,240 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	queryDefaultLimit = 100
+	queryMaxLimit     = 1000
+)
+
+// Query 查询条件, 空值表示不限制, 结果按时间倒序
+type Query struct {
+	Kind        string    `json:"kind"`
+	TaskId      string    `json:"task_id"`
+	IP          string    `json:"ip"` // ip 或者 CIDR
+	Port        int       `json:"port"`
+	Protocol    string    `json:"protocol"`
+	Fingerprint string    `json:"fingerprint"`
+	Since       time.Time `json:"since"`
+	Until       time.Time `json:"until"`
+	Offset      int       `json:"offset"`
+	Limit       int       `json:"limit"`
+}
+
+// Page 分页结果, 统计到 offset+limit 为止不再继续遍历
+// HasMore 为 true 表示还有更多记录, 此时 Total 只是下限
+type Page struct {
+	Total   int       `json:"total"`
+	HasMore bool      `json:"has_more"`
+	Items   []*Record `json:"items"`
+}
+
+type matcher struct {
+	q      Query
+	subnet *net.IPNet
+}
+
+func (m *matcher) timeOK(rk []byte) bool {
+	t := recordTime(rk)
+	if !m.q.Since.IsZero() && t.Before(m.q.Since) {
+		return false
+	}
+	if !m.q.Until.IsZero() && t.After(m.q.Until) {
+		return false
+	}
+	return true
+}
+
+// simple 唯一的条件就是遍历使用的索引, 不在当前页的记录不需要解码
+func (m *matcher) simple() bool {
+	q := m.q
+	n := 0
+	for _, set := range []bool{q.Kind != "", q.TaskId != "", q.IP != "", q.Port != 0, q.Protocol != "", q.Fingerprint != ""} {
+		if set {
+			n++
+		}
+	}
+	return n <= 1
+}
+
+func (m *matcher) match(r *Record) bool {
+	q := m.q
+	if q.Kind != "" && r.Kind != q.Kind {
+		return false
+	}
+	if q.TaskId != "" && r.TaskId != q.TaskId {
+		return false
+	}
+	if m.subnet != nil {
+		ip := net.ParseIP(r.IP)
+		if ip == nil || !m.subnet.Contains(ip) {
+			return false
+		}
+	} else if q.IP != "" && r.IP != q.IP {
+		return false
+	}
+	if q.Port != 0 && int(r.Port) != q.Port {
+		return false
+	}
+	if q.Protocol != "" && !strings.EqualFold(r.Protocol, q.Protocol) {
+		return false
+	}
+	if q.Fingerprint != "" {
+		found := false
+		for _, fp := range r.Fingerprints {
+			if strings.EqualFold(fp, q.Fingerprint) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// index 选择最有区分度的索引, 没有可用索引时返回空
+func (m *matcher) index() (string, string) {
+	q := m.q
+	switch {
+	case q.IP != "" && m.subnet == nil:
+		return idxIP, q.IP
+	case q.TaskId != "":
+		return idxTask, q.TaskId
+	case q.Fingerprint != "":
+		return idxFinger, strings.ToLower(q.Fingerprint)
+	case q.Port != 0:
+		return idxPort, strconv.Itoa(q.Port)
+	case q.Protocol != "":
+		return idxProtocol, strings.ToLower(q.Protocol)
+	case q.Kind != "":
+		return idxKind, q.Kind
+	}
+	return "", ""
+}
+
+// Query 按条件分页查询
+func (s *Store) Query(q Query) (*Page, error) {
+	if q.Limit <= 0 {
+		q.Limit = queryDefaultLimit
+	}
+	if q.Limit > queryMaxLimit {
+		q.Limit = queryMaxLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	m := &matcher{q: q}
+	if strings.Contains(q.IP, "/") {
+		_, subnet, err := net.ParseCIDR(q.IP)
+		if err != nil {
+			return nil, err
+		}
+		m.subnet = subnet
+	}
+
+	page := &Page{Items: []*Record{}}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		records := tx.Bucket(bucketRecords)
+
+		// visit 返回 false 表示已经找到下一页的记录, 停止遍历
+		end := q.Offset + q.Limit
+		simple := m.simple()
+		visit := func(rk, data []byte) bool {
+			if !m.timeOK(rk) {
+				return true
+			}
+			inPage := page.Total >= q.Offset && page.Total < end
+			var r Record
+			if inPage || !simple {
+				if json.Unmarshal(data, &r) != nil || !m.match(&r) {
+					return true
+				}
+			}
+			if page.Total >= end {
+				page.HasMore = true
+				return false
+			}
+			if inPage {
+				page.Items = append(page.Items, &r)
+			}
+			page.Total++
+			return true
+		}
+
+		// CIDR 查询遍历 ip 索引, 只读取网段内的记录
+		if m.subnet != nil && m.q.TaskId == "" {
+			prefix := []byte(idxIP + "\x00")
+			var keys [][]byte
+			c := tx.Bucket(bucketIndex).Cursor()
+			for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+				rest := k[len(prefix):]
+				i := bytes.IndexByte(rest, 0)
+				if i < 0 || len(rest)-i-1 != 16 {
+					continue
+				}
+				rk := rest[i+1:]
+				if ip := net.ParseIP(string(rest[:i])); ip != nil && m.subnet.Contains(ip) && m.timeOK(rk) {
+					keys = append(keys, rk)
+				}
+			}
+			sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) > 0 })
+			for _, rk := range keys {
+				if data := records.Get(rk); data != nil && !visit(rk, data) {
+					break
+				}
+			}
+			return nil
+		}
+
+		field, value := m.index()
+		if field == "" {
+			// 记录key以时间开头, 按 Until/Since 定位范围
+			c := records.Cursor()
+			k, v := c.Last()
+			if !q.Until.IsZero() {
+				if k, v = c.Seek(recordKey(q.Until.Add(time.Nanosecond), 0)); k != nil {
+					k, v = c.Prev()
+				} else {
+					k, v = c.Last()
+				}
+			}
+			for ; k != nil; k, v = c.Prev() {
+				if !q.Since.IsZero() && recordTime(k).Before(q.Since) {
+					break
+				}
+				if !visit(k, v) {
+					break
+				}
+			}
+			return nil
+		}
+
+		// 同一索引值下的记录key按时间递增, 倒序遍历
+		prefix := indexKey(field, value, nil)
+		var keys [][]byte
+		c := tx.Bucket(bucketIndex).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, k[len(prefix):])
+		}
+		for i := len(keys) - 1; i >= 0; i-- {
+			if data := records.Get(keys[i]); data != nil && !visit(keys[i], data) {
+				break
+			}
+		}
+		return nil
+	})
+	return page, err
+}
@@ -0,0 +1,429 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketRecords = []byte("records")
+	bucketIndex   = []byte("index")
+	bucketMeta    = []byte("meta")
+	keyCount      = []byte("count")
+)
+
+// 索引字段
+const (
+	idxKind     = "kind"
+	idxTask     = "task"
+	idxIP       = "ip"
+	idxPort     = "port"
+	idxProtocol = "proto"
+	idxFinger   = "fp"
+)
+
+const (
+	pruneInterval = 10 * time.Minute
+	pruneChunk    = 1000
+	writeQueue    = 4096 // 等待写入的记录数, 超过时丢弃
+	writeBatch    = 256  // 一个事务最多写入的记录数
+)
+
+var (
+	ErrQueueFull = errors.New("store write queue full")
+	ErrClosed    = errors.New("store closed")
+)
+
+type Option struct {
+	Path       string
+	MaxAge     time.Duration // 超过该时间的记录被删除, 0 不限制
+	MaxRecords int           // 超过该数量时删除最旧的记录, 0 不限制
+}
+
+func DefaultOption() Option {
+	return Option{
+		Path:       "radar.db",
+		MaxAge:     30 * 24 * time.Hour,
+		MaxRecords: 1000000,
+	}
+}
+
+// Record 本地保存的一条结果, Data 为原始 json
+type Record struct {
+	Kind         string          `json:"kind"`
+	TaskId       string          `json:"task_id"`
+	IP           string          `json:"ip"`
+	Port         uint16          `json:"port"`
+	Protocol     string          `json:"protocol"`
+	Fingerprints []string        `json:"fingerprints"` // component 以及 web 指纹
+	Time         time.Time       `json:"time"`
+	Data         json.RawMessage `json:"data"`
+}
+
+// indexes 记录的所有索引值
+func (r *Record) indexes() [][2]string {
+	idx := [][2]string{{idxKind, r.Kind}}
+	if r.TaskId != "" {
+		idx = append(idx, [2]string{idxTask, r.TaskId})
+	}
+	if r.IP != "" {
+		idx = append(idx, [2]string{idxIP, r.IP})
+	}
+	if r.Port != 0 {
+		idx = append(idx, [2]string{idxPort, strconv.Itoa(int(r.Port))})
+	}
+	if r.Protocol != "" {
+		idx = append(idx, [2]string{idxProtocol, strings.ToLower(r.Protocol)})
+	}
+	for _, fp := range r.Fingerprints {
+		idx = append(idx, [2]string{idxFinger, strings.ToLower(fp)})
+	}
+	return idx
+}
+
+// Store 基于 bbolt 的本地结果库, 写入在后台协程中合并提交, 不阻塞扫描
+// records: 时间(8字节) + 序号(8字节) -> Record
+// index:   字段 \x00 值 \x00 记录key -> 空
+type Store struct {
+	db      *bolt.DB
+	opt     Option
+	queue   chan *Record
+	flush   chan chan struct{}
+	dropped uint64
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+func Open(opt Option) (*Store, error) {
+	if opt.Path == "" {
+		return nil, errors.New("store path is empty")
+	}
+
+	db, err := bolt.Open(opt.Path, 0o600, &bolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketRecords, bucketIndex, bucketMeta} {
+			if _, e := tx.CreateBucketIfNotExists(name); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &Store{
+		db:      db,
+		opt:     opt,
+		queue:   make(chan *Record, writeQueue),
+		flush:   make(chan chan struct{}),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.pruneLoop()
+	go s.writeLoop()
+	return s, nil
+}
+
+func indexKey(field, value string, rk []byte) []byte {
+	key := make([]byte, 0, len(field)+len(value)+2+len(rk))
+	key = append(key, field...)
+	key = append(key, 0)
+	key = append(key, value...)
+	key = append(key, 0)
+	return append(key, rk...)
+}
+
+func recordKey(t time.Time, seq uint64) []byte {
+	rk := make([]byte, 16)
+	binary.BigEndian.PutUint64(rk, uint64(t.UnixNano()))
+	binary.BigEndian.PutUint64(rk[8:], seq)
+	return rk
+}
+
+func recordTime(rk []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(rk[:8])))
+}
+
+func addCount(tx *bolt.Tx, delta int64) {
+	meta := tx.Bucket(bucketMeta)
+	var n int64
+	if v := meta.Get(keyCount); len(v) == 8 {
+		n = int64(binary.BigEndian.Uint64(v))
+	}
+	n += delta
+	if n < 0 {
+		n = 0
+	}
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(n))
+	_ = meta.Put(keyCount, v)
+}
+
+// parse 从结果 json 中提取索引字段
+func parse(kind string, body []byte) (*Record, error) {
+	var doc struct {
+		IP        string   `json:"ip"`
+		Port      uint16   `json:"port"`
+		Protocol  string   `json:"protocol"`
+		TaskId    string   `json:"task_id"`
+		Component []string `json:"component"`
+		HTTPInfo  *struct {
+			Fingerprints []string `json:"fingerprints"`
+		} `json:"http_info"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+
+	r := &Record{
+		Kind:         kind,
+		TaskId:       doc.TaskId,
+		IP:           doc.IP,
+		Port:         doc.Port,
+		Protocol:     doc.Protocol,
+		Fingerprints: doc.Component,
+		Time:         time.Now(),
+		Data:         append(json.RawMessage(nil), body...),
+	}
+	if doc.HTTPInfo != nil {
+		r.Fingerprints = append(r.Fingerprints, doc.HTTPInfo.Fingerprints...)
+	}
+	return r, nil
+}
+
+// Put 保存一条结果, 只解析并放入写入队列, 队列满时丢弃并返回 ErrQueueFull
+func (s *Store) Put(kind string, body []byte) error {
+	r, err := parse(kind, body)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-s.done:
+		return ErrClosed
+	default:
+	}
+
+	select {
+	case s.queue <- r:
+		return nil
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+		return ErrQueueFull
+	}
+}
+
+// Flush 等待已经放入队列的记录写入完成
+func (s *Store) Flush() {
+	ch := make(chan struct{})
+	select {
+	case s.flush <- ch:
+		<-ch
+	case <-s.stopped:
+	}
+}
+
+func (s *Store) writeLoop() {
+	defer close(s.stopped)
+	for {
+		select {
+		case r := <-s.queue:
+			s.write(s.take([]*Record{r}))
+		case ch := <-s.flush:
+			s.drain()
+			close(ch)
+		case <-s.done:
+			s.drain()
+			return
+		}
+	}
+}
+
+// take 不阻塞地从队列中取出记录, 一批最多 writeBatch 条
+func (s *Store) take(batch []*Record) []*Record {
+	for len(batch) < writeBatch {
+		select {
+		case r := <-s.queue:
+			batch = append(batch, r)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// drain 写入队列中剩余的记录
+func (s *Store) drain() {
+	for batch := s.take(nil); len(batch) > 0; batch = s.take(nil) {
+		s.write(batch)
+	}
+}
+
+// write 一批记录在同一个事务中提交
+func (s *Store) write(batch []*Record) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		records := tx.Bucket(bucketRecords)
+		index := tx.Bucket(bucketIndex)
+		for _, r := range batch {
+			seq, err := records.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			rk := recordKey(r.Time, seq)
+			data, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			if err = records.Put(rk, data); err != nil {
+				return err
+			}
+
+			for _, kv := range r.indexes() {
+				if err = index.Put(indexKey(kv[0], kv[1], rk), nil); err != nil {
+					return err
+				}
+			}
+		}
+		addCount(tx, int64(len(batch)))
+		return nil
+	})
+	if err != nil {
+		atomic.AddUint64(&s.dropped, uint64(len(batch)))
+	}
+}
+
+func (s *Store) remove(tx *bolt.Tx, rk []byte, data []byte) error {
+	var r Record
+	if err := json.Unmarshal(data, &r); err == nil {
+		index := tx.Bucket(bucketIndex)
+		for _, kv := range r.indexes() {
+			_ = index.Delete(indexKey(kv[0], kv[1], rk))
+		}
+	}
+	addCount(tx, -1)
+	return tx.Bucket(bucketRecords).Delete(rk)
+}
+
+// Count 记录总数
+func (s *Store) Count() int {
+	var n int
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketMeta).Get(keyCount); len(v) == 8 {
+			n = int(binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+	return n
+}
+
+// Prune 按保留时间以及最大数量删除最旧的记录, 返回删除的数量
+func (s *Store) Prune() (int, error) {
+	deadline := time.Time{}
+	if s.opt.MaxAge > 0 {
+		deadline = time.Now().Add(-s.opt.MaxAge)
+	}
+
+	removed := 0
+	for {
+		over := 0
+		if s.opt.MaxRecords > 0 {
+			over = s.Count() - s.opt.MaxRecords
+		}
+
+		n := 0
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			// 先收集再删除, 避免遍历时修改游标所在的 bucket
+			var keys, values [][]byte
+			c := tx.Bucket(bucketRecords).Cursor()
+			for k, v := c.First(); k != nil && len(keys) < pruneChunk; k, v = c.Next() {
+				if len(keys) >= over && (deadline.IsZero() || !recordTime(k).Before(deadline)) {
+					break
+				}
+				keys = append(keys, append([]byte(nil), k...))
+				values = append(values, append([]byte(nil), v...))
+			}
+
+			for i := range keys {
+				if err := s.remove(tx, keys[i], values[i]); err != nil {
+					return err
+				}
+				n++
+			}
+			return nil
+		})
+		removed += n
+		if err != nil || n < pruneChunk {
+			return removed, err
+		}
+	}
+}
+
+func (s *Store) pruneLoop() {
+	_, _ = s.Prune()
+
+	tk := time.NewTicker(pruneInterval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-tk.C:
+			_, _ = s.Prune()
+		}
+	}
+}
+
+// Stats 记录数以及数据库文件大小
+func (s *Store) Stats() map[string]interface{} {
+	st := map[string]interface{}{
+		"path":        s.opt.Path,
+		"records":     s.Count(),
+		"max_records": s.opt.MaxRecords,
+		"max_age":     s.opt.MaxAge.String(),
+		"pending":     len(s.queue),
+		"dropped":     atomic.LoadUint64(&s.dropped),
+	}
+	if info, err := os.Stat(s.opt.Path); err == nil {
+		st["size"] = info.Size()
+	}
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		if k, _ := tx.Bucket(bucketRecords).Cursor().First(); k != nil {
+			st["oldest"] = recordTime(k)
+		}
+		return nil
+	})
+	return st
+}
+
+func (s *Store) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		<-s.stopped
+		err = s.db.Close()
+	})
+	return err
+}
+
+// hasPrefix 用于遍历同一索引值下的记录
+func hasPrefix(k, prefix []byte) bool {
+	return bytes.HasPrefix(k, prefix)
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	s, err := Open(Option{Path: filepath.Join(t.TempDir(), "radar.db"), MaxRecords: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	bodies := []string{
+		`{"ip":"10.1.2.3","port":6379,"protocol":"redis","task_id":"t1"}`,
+		`{"ip":"10.1.2.3","port":80,"protocol":"http","task_id":"t1","http_info":{"fingerprints":["Nginx"]}}`,
+		`{"ip":"10.1.2.4","port":22,"protocol":"ssh","task_id":"t2"}`,
+		`{"ip":"10.1.3.1","port":6379,"protocol":"redis","task_id":"t2"}`,
+	}
+	for _, b := range bodies {
+		if err = s.Put("service", []byte(b)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Flush()
+
+	cases := []struct {
+		q     Query
+		total int
+	}{
+		{Query{}, 4},
+		{Query{Protocol: "REDIS"}, 2},
+		{Query{IP: "10.1.2.3"}, 2},
+		{Query{IP: "10.1.2.0/24"}, 3},
+		{Query{Fingerprint: "nginx"}, 1},
+		{Query{TaskId: "t2", Port: 22}, 1},
+		{Query{Until: time.Now().Add(-time.Hour)}, 0},
+		{Query{Since: time.Now().Add(-time.Hour)}, 4},
+		{Query{IP: "10.1.2.0/24", Protocol: "redis"}, 1},
+	}
+	for i, c := range cases {
+		page, err := s.Query(c.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != c.total {
+			t.Errorf("case %d: want %d, got %d", i, c.total, page.Total)
+		}
+	}
+
+	// 最新的记录在前, 统计到下一页的第一条为止
+	page, _ := s.Query(Query{Limit: 1, Offset: 1})
+	if len(page.Items) != 1 || page.Items[0].IP != "10.1.2.4" {
+		t.Errorf("bad pagination %+v", page.Items)
+	}
+	if page.Total != 2 || !page.HasMore {
+		t.Errorf("want total 2 with more, got %d %v", page.Total, page.HasMore)
+	}
+	if page, _ = s.Query(Query{Protocol: "redis", Limit: 2}); page.Total != 2 || page.HasMore {
+		t.Errorf("last page should not have more, got %d %v", page.Total, page.HasMore)
+	}
+
+	if n, err := s.Prune(); err != nil || n != 1 {
+		t.Fatalf("want 1 pruned, got %d %v", n, err)
+	}
+	if page, _ = s.Query(Query{Protocol: "redis"}); page.Total != 1 || s.Count() != 3 {
+		t.Errorf("prune should drop the oldest record, got %d redis and %d total", page.Total, s.Count())
+	}
+}
@@ -2,11 +2,11 @@ package radar
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/vela-ssoc/vela-kit/audit"
@@ -86,6 +86,7 @@ const (
 	Task_Status_Paused_Artificial
 	Task_Status_Error
 	Task_Status_Unknown
+	Task_Status_Stopped
 )
 
 var Task_Status_Strings = [...]string{
@@ -94,7 +95,9 @@ var Task_Status_Strings = [...]string{
 	"Success",
 	"paused_by_program",
 	"paused_artificial",
+	"Error",
 	"Unknown",
+	"Stopped",
 }
 
 func (s Task_Status) Detail() string {
@@ -104,11 +107,11 @@ func (s Task_Status) Detail() string {
 type Task struct {
 	Name           string
 	Id             string
+	Profile        string // 使用的参数模板
+	defaults       Option // 创建时的默认参数, 用来判断 profile 之前是否已经设置过参数
 	Debug          bool
 	Report         bool
 	Status         Task_Status
-	Count_all      uint64
-	Count_success  uint64
 	Count_asset    uint64
 	Start_time     time.Time
 	End_time       time.Time
@@ -122,6 +125,20 @@ type Task struct {
 	executionTimeMonitorStopChan chan struct{}
 	rad                          *Radar
 	Option                       Option
+	hosts                        *hostTable
+	paths                        *pathTable
+	names                        *nameTable
+	devices                      *deviceTable
+	snmp                         *snmpTable
+	anomaly                      *anomalyTable
+	safe                         *safeTable
+	self                         *selfTable
+	results                      *resultTable
+	progress                     progress
+	filters                      *filterStats
+	hooks                        *taskHooks
+	done                         chan struct{} // 任务结束时关闭
+	doneOnce                     sync.Once
 	Dispatch                     Dispatch
 	Worker                       Worker
 	WaitGroup                    WaitGroup
@@ -150,6 +167,7 @@ func (t *Task) info() []byte {
 	enc.Tab("")
 	enc.KV("name", t.Name)
 	enc.KV("id", t.Id)
+	enc.KV("profile", t.Profile)
 	enc.KV("debug", t.Debug)
 	enc.KV("report", t.Report)
 	enc.KV("status", t.Status)
@@ -158,10 +176,50 @@ func (t *Task) info() []byte {
 	enc.KV("end_time", t.End_time)
 	enc.KV("timeuse_second", timeuse_second)
 	enc.KV("timeuse_msg", timeuse_msg)
-	enc.KV("task_all_num", t.Count_all)
-	enc.KV("task_success_num", t.Count_success)
+	phases, overall, eta := t.progress.Summary()
+	if t.Status == Task_Status_Success {
+		overall, eta = 100, 0
+	}
+	enc.KV("task_all_num", phases[PhaseProbe].Total)
+	enc.KV("task_success_num", phases[PhaseProbe].Done)
 	enc.KV("task_asset_num", t.Count_asset)
-	enc.KV("task_process", fmt.Sprintf("%0.2f", float64(t.Count_success)/float64(t.Count_all)*100))
+	enc.KV("task_process", fmt.Sprintf("%0.2f", overall))
+	enc.KV("eta_second", eta)
+	enc.KV("eta_msg", etaMsg(eta))
+	enc.Raw("progress", util.ToJsonBytes(phases))
+	if t.hosts != nil && t.Option.State {
+		hosts, open, closed, filtered := t.hosts.Summary()
+		enc.Raw("port_state", util.ToJsonBytes(map[string]interface{}{
+			"hosts":    hosts,
+			"open":     open,
+			"closed":   closed,
+			"filtered": filtered,
+		}))
+	}
+	if t.paths != nil {
+		enc.Raw("paths", t.paths.Bytes())
+	}
+	if t.devices != nil {
+		enc.Raw("discover", util.ToJsonBytes(map[string]interface{}{
+			"devices":     t.devices.Len(),
+			"new_targets": t.devices.extra,
+		}))
+	}
+	if t.snmp != nil {
+		enc.Raw("snmp", util.ToJsonBytes(t.snmp.Summary()))
+	}
+	if t.anomaly != nil {
+		enc.Raw("anomaly", util.ToJsonBytes(t.anomaly.Summary()))
+	}
+	if t.safe != nil {
+		enc.Raw("safe", util.ToJsonBytes(t.safe.Summary()))
+	}
+	if t.self != nil {
+		enc.Raw("self_exclude", util.ToJsonBytes(t.self.Summary()))
+	}
+	if t.filters != nil {
+		enc.Raw("filter", t.filters.Bytes())
+	}
 	enc.Raw("option", util.ToJsonBytes(t.Option))
 	enc.End("}")
 	return enc.Bytes()
@@ -186,8 +244,16 @@ func (t *Task) get_timeuse_second() (float64, string) {
 func (t *Task) end() {
 	t.End_time = time.Now()
 	t.CalculateTimeUse()
-	t.Status = Task_Status_Success
+	if t.ctx.Err() != nil {
+		t.Status = Task_Status_Stopped
+		metricTasks.With("stopped").Inc()
+	} else {
+		t.Status = Task_Status_Success
+		metricTasks.With("success").Inc()
+	}
 	audit.NewEvent("PortScanTask.end").Subject("调试信息").From(t.co.CodeVM()).Msg(fmt.Sprintf("scan task succeed, id=%s, time use:%s", t.Id, t.Timeuse_msg)).Log().Put()
+	t.onFinish()
+	t.finish()
 	t.Dispatch.End()
 	if t.rad.cfg.Debug || t.Debug {
 		xEnv.Infof("task end")
@@ -199,14 +265,104 @@ func (t *Task) endWithErr(msg string) {
 	t.End_time = time.Now()
 	t.CalculateTimeUse()
 	t.Status = Task_Status_Error
+	metricTasks.With("error").Inc()
 	audit.NewEvent("PortScanTask.error").Subject("调试信息").From(t.co.CodeVM()).Msg(msg).Log().Put()
+	t.onError(msg)
 	close(t.executionTimeMonitorStopChan)
+	t.finish()
 	t.Dispatch.End()
 	if t.rad.cfg.Debug || t.Debug {
 		xEnv.Infof("task end with error : %s", msg)
 	}
 }
 
+func (t *Task) finish() {
+	t.doneOnce.Do(func() { close(t.done) })
+}
+
+// Finished 任务是否已经结束(成功, 失败或者被停止)
+func (t *Task) Finished() bool {
+	select {
+	case <-t.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait 等待任务结束, timeout 小于等于0时一直等待, 超时返回 false
+func (t *Task) Wait(timeout time.Duration) bool {
+	if timeout <= 0 {
+		<-t.done
+		return true
+	}
+
+	tm := time.NewTimer(timeout)
+	defer tm.Stop()
+	select {
+	case <-t.done:
+		return true
+	case <-tm.C:
+		return false
+	}
+}
+
+// Pause 人工暂停, http 接口和 lua 共用
+func (t *Task) Pause() error {
+	switch t.Status {
+	case Task_Status_Running:
+		t.Status = Task_Status_Paused_Artificial
+	case Task_Status_Paused_Artificial:
+		return errors.New("任务已经处于暂停状态")
+	case Task_Status_Paused_By_Program:
+		t.Status = Task_Status_Paused_Artificial
+	default:
+		return errors.New("无法暂停任务, 任务现在是[" + t.Status.Detail() + "] 状态")
+	}
+	return nil
+}
+
+// Resume 恢复人工暂停的任务, 处于排除时间范围内时返回提示信息
+func (t *Task) Resume() (string, error) {
+	switch t.Status {
+	case Task_Status_Running:
+		return "", errors.New("task is already running")
+	case Task_Status_Paused_Artificial:
+		isInTimeRange, err := util.IsWithinRange(t.Option.ExcludeTimeRange)
+		if err != nil {
+			return "", errors.New("无法恢复任务, 排除时间范围设置错误")
+		}
+		if !isInTimeRange {
+			t.Status = Task_Status_Running
+		} else {
+			t.Status = Task_Status_Paused_By_Program
+			return "ok, 但是处于排除时间范围内，不能立即恢复执行, 需等待到排除时间外执行", nil
+		}
+	case Task_Status_Paused_By_Program:
+		t.Status = Task_Status_Paused_Artificial
+	default:
+		return "", errors.New("无法恢复任务, 任务现在是[" + t.Status.Detail() + "] 状态")
+	}
+	return "ok", nil
+}
+
+// Stop 停止任务, 已经下发的目标扫描完成后结束, 状态为 Stopped
+func (t *Task) Stop() error {
+	if t.Finished() {
+		return errors.New("任务已经结束")
+	}
+	t.cancel()
+	return nil
+}
+
+// paused 任务处于暂停状态, 被停止的任务不再等待
+func (t *Task) paused() bool {
+	if t.ctx.Err() != nil {
+		return false
+	}
+	return t.Status == Task_Status_Paused_By_Program || t.Status == Task_Status_Paused_Artificial
+}
+
 func (t *Task) CalculateTimeUse() {
 	timeuse := time.Since(t.Start_time)
 	timeuseMsg := fmt.Sprintf("%d小时%02d分钟%02d秒", int(timeuse.Hours()), int(timeuse.Minutes())%60, int(timeuse.Seconds())%60)
@@ -217,7 +373,8 @@ func (t *Task) CalculateTimeUse() {
 func (t *Task) executionMonitor() {
 	// 可做全局监视器debug用
 	t.executionTimeMonitorStopChan = make(chan struct{})
-	if t.Option.ExcludeTimeRange.Daily == "" {
+	policy := t.rad.cfg.Policy
+	if t.Option.ExcludeTimeRange.Daily == "" && (policy == nil || len(policy.Hours) == 0) {
 		if t.rad.cfg.Debug || t.Debug {
 			xEnv.Infof("没有设置排除时间，直接执行")
 		}
@@ -237,6 +394,10 @@ func (t *Task) executionMonitor() {
 				xEnv.Errorf("task execution time monitor fail %v", err)
 				return
 			}
+			// 策略允许的时间段之外同样暂停
+			if !policy.InHours(time.Now()) {
+				isInTimeRange = true
+			}
 			if t.Status != Task_Status_Paused_Artificial && isInTimeRange {
 				t.Status = Task_Status_Paused_By_Program
 			} else if t.Status != Task_Status_Paused_Artificial && !isInTimeRange {
@@ -259,25 +420,54 @@ func (t *Task) GenRun() {
 		return
 	}
 
-	if t.rad.screen != nil {
-		t.rad.screen.Start()
+	if t.Option.Screenshot && t.rad.screen != nil {
+		t.rad.screen.Acquire()
+		defer t.rad.screen.Release()
 	}
 
 	audit.NewEvent("PortScanTask.start").Subject("调试信息").From(t.co.CodeVM()).Msg(fmt.Sprintf("scan task start, id=%s", t.Id)).Log().Put()
 	//fmt.Printf("scan task start, id=%s config: %s", t.Id, string(t.info()))
-	var ss Scanner
 	var err error
 	t.WaitGroup = WaitGroup{}
 	// parse ip
 	items := strings.Split(t.Option.Target, ",")
-	excluded_ip_map := util.IpstrWithCommaToMap(t.Option.ExcludedTarget)
+	excluded := util.NewIPSet(t.Option.ExcludedTarget)
 	// 解析端口字符串并且优先发送 TopTcpPorts 中的端口, eg: 1-65535,top1000
 	ports, err := port.ShuffleParseAndMergeTopPorts(t.Option.Port)
 	if err != nil {
 		t.endWithErr(fmt.Sprintf("task port range parse fail %v", err))
 		return
 	}
-	for n, ip := range items {
+	if t.Option.Names {
+		t.names = newNameTable(host.NameOption{
+			DNSServer: t.rad.cfg.DNSServer,
+			Timeout:   time.Duration(t.Option.Timeout) * time.Millisecond,
+		})
+	}
+	if t.Option.Anomaly {
+		t.anomaly = newAnomalyTable(ports, t.Option.AnomalyCap)
+	}
+	t.safe = newSafeTable(t.Option)
+	if t.Option.SafeAuto {
+		ports = icsFirst(ports)
+	}
+	if t.Option.State || t.Option.Trace != "" || t.Option.Names || t.Option.Anomaly {
+		t.hosts, err = newHostTable(ports, t.Option.State, t.Option.StatePorts)
+		if err != nil {
+			t.endWithErr(fmt.Sprintf("task state ports parse fail %v", err))
+			return
+		}
+	}
+	// 组播发现, 新发现的ip作为额外目标, 合并成一批扫描
+	var discovered []string
+	if t.Option.Discover != "" {
+		discovered = t.rad.filterTargets(t, "discover", t.discoverDevices(items))
+	}
+	targets := make([]string, 0, len(items)+len(discovered))
+	targets = append(append(targets, items...), discovered...)
+	// 本机/网关/网络地址和广播地址
+	t.self = newSelfTable(t.Option, targets)
+	for n, ip := range targets {
 		if t.rad.cfg.Debug || t.Debug {
 			xEnv.Infof("get Target[%d] %s", n, ip)
 		}
@@ -287,14 +477,21 @@ func (t *Task) GenRun() {
 			return
 		}
 
-		t.Count_all = t.Count_all + it.TotalNum()*uint64(len(ports))
+		t.progress.Discovery.add(it.TotalNum())
+		t.progress.Probe.add(it.TotalNum() * uint64(len(ports)))
+	}
+
+	if t.Option.SNMP {
+		t.snmp = newSNMPTable()
 	}
 
 	// end init, start running
 	t.Status = Task_Status_Running
+
 	fingerPool, _ := thread.NewPoolWithFunc(t.Option.Pool.Finger, func(v interface{}) {
 		defer t.WaitGroup.FingerPrint.Done()
-		defer atomic.AddUint64(&t.Count_success, 1)
+		defer t.progress.Finger.finish(1)
+		defer metricPoolDepth.With("finger").Dec()
 
 		entry := v.(port.OpenIpPort)
 		t.Dispatch.Callback(&Tx{Entry: entry, Param: t.Option})
@@ -304,113 +501,243 @@ func (t *Task) GenRun() {
 	defer fingerPool.Release()
 
 	call := func(v port.OpenIpPort) {
-		// atomic.AddUint64(&t.Count_success, 1)
-		if v.Ip == nil {
-			atomic.AddUint64(&t.Count_success, 1)
+		pass := true
+		if t.anomaly != nil {
+			var canary bool
+			if canary, pass = t.anomaly.Record(v); canary {
+				// 随机高端口探测结果不计入进度
+				return
+			}
+		}
+		if t.hosts != nil {
+			t.hosts.Record(v)
+		}
+		if v.State == port.Open {
+			t.safe.Port(v.Ip, v.Port)
+		}
+		// 端口探测进度在发包时计数, 这里只处理需要识别指纹的开放端口
+		if v.State != port.Open || !pass {
 			return
-
 		}
-		// atomic.AddUint64(&t.FingerPrint_count_all, 1)
+		t.progress.Finger.add(1)
 		t.WaitGroup.FingerPrint.Add(1)
+		metricPoolDepth.With("finger").Inc()
 		_ = fingerPool.Invoke(v)
 	}
 
-	for _, ip := range items {
-		it, startIp, err := iputil.NewIter(ip)
-		if err != nil {
-			t.endWithErr(fmt.Sprintf("task ip range[%s] parse fail (scanning): %v", ip, err))
-			return
+	// 扫描器在每一批目标结束后关闭, 不会累积 pcap 句柄和接收协程
+	var ss Scanner
+	newScanner := func(first net.IP) (Scanner, error) {
+		opt := port.Option{
+			Rate:    t.Option.Rate,
+			Timeout: t.Option.Timeout,
+			States:  t.Option.State,
+			Trace:   t.Option.Trace != "",
 		}
-		switch t.Option.Mode {
-		case "syn":
-			ss, err = syn.NewSynScanner(startIp, call, port.Option{
-				Rate:    t.Option.Rate,
-				Timeout: t.Option.Timeout,
-			})
-		default:
-			ss, err = tcp.NewTcpScanner(call, port.Option{
-				Rate:    t.Option.Rate,
-				Timeout: t.Option.Timeout,
-			})
+		if t.Option.Mode == "syn" {
+			return syn.NewSynScanner(first, call, opt)
 		}
+		return tcp.NewTcpScanner(call, opt)
+	}
 
-		// port scan func
-		scanner := func(ip net.IP) {
-			n := len(ports)
-			if n == 1 {
-				ss.WaitLimiter() // limit rate
-				ss.Scan(ip, ports[0])
-				return
+	// port scan func
+	scanner := func(ip net.IP) {
+		if t.hosts != nil {
+			t.hosts.Touch(ip)
+		}
+		t.safe.Inspect(ip, t.devices)
+		probe := func(p uint16) {
+			t.safe.Throttle(ip) // 安全模式的主机单独限速
+			ss.WaitLimiter()    // limit rate
+			if t.anomaly != nil {
+				t.anomaly.Probe(ip)
 			}
-
-			for i := 0; i < n; i++ {
+			ss.Scan(ip, p)
+			t.progress.Probe.finish(1)
+		}
+		// 先探测随机高端口, 全部开放的主机只保留少量结果
+		if t.anomaly != nil {
+			canaries := t.anomaly.Canaries(ip)
+			for _, p := range canaries {
 				ss.WaitLimiter() // limit rate
-				ss.Scan(ip, ports[i])
+				ss.Scan(ip, p)
 			}
+			if len(canaries) > 0 {
+				time.Sleep(time.Duration(t.Option.Timeout) * time.Millisecond)
+				t.anomaly.CheckCanaries(ip)
+			}
+		}
+		// 设备公布的服务端口
+		if t.devices != nil {
+			extra := t.devices.Ports(ip, ports)
+			t.progress.Probe.add(uint64(len(extra)))
+			if t.hosts != nil {
+				t.hosts.Extra(ip, len(extra))
+			}
+			for _, p := range extra {
+				probe(p)
+			}
+		}
+		n := len(ports)
+		if n == 1 {
+			probe(ports[0])
+			return
 		}
 
-		// host group scan func
-		scan, _ := thread.NewPoolWithFunc(t.Option.Pool.Scan, func(v interface{}) {
-			defer t.WaitGroup.Scan.Done()
-			ip := v.(net.IP)
-			for t.Status == Task_Status_Paused_By_Program || t.Status == Task_Status_Paused_Artificial {
-				time.Sleep(3 * time.Second)
+		for i := 0; i < n; i++ {
+			probe(ports[i])
+		}
+	}
+
+	// host group scan func
+	scan, _ := thread.NewPoolWithFunc(t.Option.Pool.Scan, func(v interface{}) {
+		defer t.WaitGroup.Scan.Done()
+		defer metricPoolDepth.With("scan").Dec()
+		ip := v.(net.IP)
+		for t.paused() {
+			time.Sleep(3 * time.Second)
+		}
+		scanner(ip)
+		if t.snmp != nil && !t.safe.Check(ip) {
+			t.querySNMP(ip)
+		}
+	})
+	defer scan.Release()
+
+	// Pool - ping and port scan
+	ping, _ := thread.NewPoolWithFunc(t.Option.Pool.Ping, func(v interface{}) {
+		ip := v.(net.IP)
+		for t.paused() {
+			time.Sleep(3 * time.Second)
+		}
+		ok := host.IsLive(ip.String(), false, 800*time.Millisecond)
+		t.WaitGroup.Ping.Done()
+		t.progress.Discovery.finish(1)
+		metricPoolDepth.With("ping").Dec()
+		if ok {
+			metricPing.With("alive").Inc()
+		} else {
+			metricPing.With("dead").Inc()
+		}
+
+		if ok && t.names != nil {
+			t.names.Resolve(ip)
+		}
+
+		if ok {
+			t.WaitGroup.Scan.Add(1)
+			metricPoolDepth.With("scan").Inc()
+			_ = scan.Invoke(ip)
+		} else {
+			t.progress.Probe.sub(uint64(len(ports)))
+		}
+	})
+	defer ping.Release()
+
+	// batch 使用同一个扫描器扫描一批地址, 结束后等待探测完成并关闭扫描器, 任务被停止时返回 false
+	batch := func(first net.IP, total uint64, get func(uint64) net.IP) bool {
+		var err error
+		if ss, err = newScanner(first); err != nil {
+			t.Msg = fmt.Sprintf("create scanner for %s fail %v", first, err)
+			xEnv.Errorf("task %s %s", t.Id, t.Msg)
+			t.progress.Discovery.finish(total)
+			t.progress.Probe.sub(total * uint64(len(ports)))
+			return true
+		}
+		defer func() {
+			t.WaitGroup.Ping.Wait()
+			t.WaitGroup.Scan.Wait()
+			ss.Wait()
+			ss.Close()
+		}()
+
+		// 路径探测, 在第一个扫描器上进行, syn 模式复用扫描器的抓包句柄
+		if t.Option.Trace != "" && t.paths == nil {
+			t.discoverPaths(targets, ports[0], ss)
+		}
+
+		for i := uint64(0); i < total; i++ { // ip index
+			select {
+			case <-t.ctx.Done():
+				xEnv.Infof("kill task...")
+				return false
+			default:
 			}
-			scanner(ip)
-		})
-		defer scan.Release()
 
-		// Pool - ping and port scan
-		ping, _ := thread.NewPoolWithFunc(t.Option.Pool.Ping, func(v interface{}) {
-			ip := v.(net.IP)
-			for t.Status == Task_Status_Paused_By_Program || t.Status == Task_Status_Paused_Artificial {
+			ip := get(i)
+			for t.paused() {
 				time.Sleep(3 * time.Second)
 			}
-			ok := host.IsLive(ip.String(), false, 800*time.Millisecond)
-			t.WaitGroup.Ping.Done()
-
-			if ok {
+			// 黑名单ip
+			if excluded.Contains(ip) || t.self.Check(ip) != "" {
+				t.progress.Discovery.finish(1)
+				t.progress.Probe.sub(uint64(len(ports)))
+			} else if t.Option.Ping {
+				t.WaitGroup.Ping.Add(1)
+				metricPoolDepth.With("ping").Inc()
+				_ = ping.Invoke(ip)
+			} else {
+				t.progress.Discovery.finish(1)
 				t.WaitGroup.Scan.Add(1)
+				metricPoolDepth.With("scan").Inc()
 				_ = scan.Invoke(ip)
-			} else {
-				// atomic.AddUint64(&t.Count_success, uint64(len(ports)))
-				atomic.AddUint64(&t.Count_success, 1)
-				atomic.AddUint64(&t.Count_all, uint64(1-len(ports)))
 			}
-		})
-		defer ping.Release()
+		}
+		return true
+	}
 
-		shuffle := util.NewShuffle(it.TotalNum())    // shuffle
-		for i := uint64(0); i < it.TotalNum(); i++ { // ip index
-			select {
-			case <-t.ctx.Done():
-				// t.cancel()
-				xEnv.Infof("kill task...")
-				goto done
-			default:
-				ip := make(net.IP, len(it.GetIpByIndex(0)))
-				copy(ip, it.GetIpByIndex(shuffle.Get(i))) // Note: dup copy []byte when concurrent (GetIpByIndex not to do dup copy)
-				// 黑名单ip
-				for t.Status == Task_Status_Paused_By_Program || t.Status == Task_Status_Paused_Artificial {
-					time.Sleep(3 * time.Second)
-				}
-				if excluded_ip_map[ip.String()] {
-					// atomic.AddUint64(&t.Count_success, uint64(len(ports)))
-					atomic.AddUint64(&t.Count_success, 1)
-					atomic.AddUint64(&t.Count_all, uint64(1-len(ports)))
-				} else if t.Option.Ping {
-					t.WaitGroup.Ping.Add(1)
-					_ = ping.Invoke(ip)
-				} else {
-					t.WaitGroup.Scan.Add(1)
-					_ = scan.Invoke(ip)
-				}
+	// extraBatch 组播发现/SNMP 学习到的零散ip, 按所在网段分组, 每组一个扫描器
+	extraBatch := func(ips []string) bool {
+		for _, group := range linkGroups(ips) {
+			group := group
+			if !batch(group[0], uint64(len(group)), func(i uint64) net.IP { return group[i] }) {
+				return false
+			}
+		}
+		return true
+	}
+
+	run := func() {
+		for _, item := range items {
+			it, startIp, err := iputil.NewIter(item)
+			if err != nil {
+				xEnv.Errorf("task ip range[%s] parse fail (scanning): %v", item, err)
+				continue
+			}
+			shuffle := util.NewShuffle(it.TotalNum()) // shuffle
+			ok := batch(startIp, it.TotalNum(), func(i uint64) net.IP {
+				// Note: dup copy []byte when concurrent (GetIpByIndex not to do dup copy)
+				src := it.GetIpByIndex(shuffle.Get(i))
+				ip := make(net.IP, len(src))
+				copy(ip, src)
+				return ip
+			})
+			if !ok {
+				return
 			}
 		}
+
+		if len(discovered) > 0 && !extraBatch(discovered) {
+			return
+		}
+
+		// 所有目标扫描完成后, 追加一轮从 ARP/路由表学习到的新目标
+		if t.Option.SNMPLearn && t.snmp != nil {
+			learned := t.rad.filterTargets(t, "snmp", t.snmp.Targets(targets))
+			if len(learned) == 0 {
+				return
+			}
+			if t.rad.cfg.Debug || t.Debug {
+				xEnv.Infof("task %s snmp learned %d new targets", t.Id, len(learned))
+			}
+			t.progress.Discovery.add(uint64(len(learned)))
+			t.progress.Probe.add(uint64(len(learned) * len(ports)))
+			extraBatch(learned)
+		}
 	}
+	run()
 
-done:
-	t.WaitGroup.Wait(ss, t.rad.cfg.Debug || t.Debug)
+	t.WaitGroup.FingerPrint.Wait()
 	if t.rad.cfg.Debug || t.Debug {
 		xEnv.Infof("wg.Wait end")
 		// fmt.Printf("task end\n")
@@ -420,10 +747,9 @@ done:
 	if t.rad.cfg.Debug || t.Debug {
 		xEnv.Infof("executionTimeMonitorStopChan closed")
 	}
-	if t.rad.task.Option.Screenshot && t.rad.screen != nil {
-		t.rad.screen.Close()
-		if t.rad.cfg.Debug || t.Debug {
-			xEnv.Infof("ScreenshotServer closed")
+	if t.hosts != nil {
+		for _, h := range t.hosts.Hosts(t) {
+			t.rad.handleHost(t, h)
 		}
 	}
 	t.end()
@@ -1,6 +1,7 @@
 package radar
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,13 +9,109 @@ import (
 )
 
 func (t *Task) runL(L *lua.LState) int {
+	if err := t.rad.enforce(t, "lua"); err != nil {
+		t.rad.discard(t)
+		L.RaiseError("%v", err)
+		return 0
+	}
 	t.Id = uuid.NewString()
 	t.Start_time = time.Now()
 	go t.GenRun()
 	go t.executionMonitor()
+	go t.progressMonitor()
+	return 0
+}
+
+// exportL eg: task.export("html", "report/radar.html"), 失败时返回错误信息
+func (t *Task) exportL(L *lua.LState) int {
+	format := L.CheckString(1)
+	path := L.CheckString(2)
+	if err := t.ExportFile(format, path); err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
+	return 0
+}
+
+// task.status() 任务状态 Init/Running/Success/paused_by_program/paused_artificial/Error/Stopped
+func (t *Task) statusL(L *lua.LState) int {
+	L.Push(lua.LString(t.Status.Detail()))
+	return 1
+}
+
+// task.progress() 总进度百分比, 剩余秒数以及各阶段进度
+func (t *Task) progressL(L *lua.LState) int {
+	phases, overall, eta := t.progress.Summary()
+	if t.Status == Task_Status_Success {
+		overall, eta = 100, 0
+	}
+
+	tab := L.CreateTable(0, 3)
+	tab.RawSetString("percent", lua.LNumber(overall))
+	tab.RawSetString("eta", lua.LNumber(eta))
+	detail := L.CreateTable(0, len(phases))
+	for name, p := range phases {
+		item := L.CreateTable(0, 5)
+		item.RawSetString("total", lua.LNumber(p.Total))
+		item.RawSetString("done", lua.LNumber(p.Done))
+		item.RawSetString("percent", lua.LNumber(p.Percent))
+		item.RawSetString("rate", lua.LNumber(p.Rate))
+		item.RawSetString("eta", lua.LNumber(p.ETA))
+		detail.RawSetString(name, item)
+	}
+	tab.RawSetString("phases", detail)
+	L.Push(tab)
+	return 1
+}
+
+// task.pause()/resume()/stop() 与 http 接口的逻辑相同, 失败时返回错误信息
+func (t *Task) pauseL(L *lua.LState) int {
+	if err := t.Pause(); err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
+	return 0
+}
+
+func (t *Task) resumeL(L *lua.LState) int {
+	if _, err := t.Resume(); err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
+	return 0
+}
+
+func (t *Task) stopL(L *lua.LState) int {
+	if err := t.Stop(); err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
 	return 0
 }
 
+// task.wait(60) 等待任务结束, 单位秒, 不传或者为0时一直等待, 返回是否已经结束
+func (t *Task) waitL(L *lua.LState) int {
+	timeout := time.Duration(L.IsInt(1)) * time.Second
+	L.Push(lua.LBool(t.Wait(timeout)))
+	return 1
+}
+
+// task.results() 返回服务列表以及主机记录列表
+func (t *Task) resultsL(L *lua.LState) int {
+	services, hosts, _ := t.results.Snapshot()
+	st := L.CreateTable(len(services), 0)
+	for _, s := range services {
+		st.Append(s)
+	}
+	ht := L.CreateTable(len(hosts), 0)
+	for _, h := range hosts {
+		ht.Append(h)
+	}
+	L.Push(st)
+	L.Push(ht)
+	return 2
+}
+
 func (t *Task) portL(L *lua.LState) int {
 	port := L.CheckString(1)
 	t.Option.Port = port
@@ -131,6 +228,103 @@ func (t *Task) reportL(L *lua.LState) int {
 	return 1
 }
 
+// task.state(true, "22,80,443") 记录 closed/filtered 端口状态, 第二个参数为逐端口记录的端口范围
+func (t *Task) stateL(L *lua.LState) int {
+	enable := L.IsTrue(1)
+	ports := lua.IsString(L.Get(2))
+	if err := t.Option.set_state(enable, ports); err != nil {
+		L.RaiseError("set_state fail %v", err)
+		return 0
+	}
+	L.Push(t)
+	return 1
+}
+
+// task.trace("tcp", 30) 对每个 /24 网段做路径探测
+func (t *Task) traceL(L *lua.LState) int {
+	mode := L.CheckString(1)
+	hops := L.IsInt(2)
+	if err := t.Option.set_trace(mode, hops); err != nil {
+		L.RaiseError("set_trace fail %v", err)
+		return 0
+	}
+	L.Push(t)
+	return 1
+}
+
+func (t *Task) namesL(L *lua.LState) int {
+	t.Option.Names = L.IsTrue(1)
+	L.Push(t)
+	return 1
+}
+
+// task.snmp(true, true) 读取 SNMP 信息, 第二个参数为是否把 ARP/路由表中的新ip追加为目标
+func (t *Task) snmpL(L *lua.LState) int {
+	t.Option.SNMP = L.IsTrue(1)
+	t.Option.SNMPLearn = L.IsTrue(2)
+	L.Push(t)
+	return 1
+}
+
+// task.anomaly(true, 20) tarpit/蜜罐检测, 被标记的主机最多保留 20 个开放端口
+func (t *Task) anomalyL(L *lua.LState) int {
+	t.Option.set_anomaly(L.IsTrue(1), L.IsInt(2))
+	L.Push(t)
+	return 1
+}
+
+// task.safe(true, 500) 整个任务使用安全模式, 同一主机每 500ms 探测一个端口
+// task.safe("10.10.0.0/16,10.20.1.1-10") 指定ip范围使用安全模式
+func (t *Task) safeL(L *lua.LState) int {
+	switch v := L.Get(1).(type) {
+	case lua.LBool:
+		t.Option.Safe = bool(v)
+	case lua.LString:
+		t.Option.SafeTarget = string(v)
+	default:
+		L.RaiseError("safe must bool or ip range string , got %s", v.Type().String())
+		return 0
+	}
+	if L.GetTop() > 1 {
+		t.Option.set_safe_delay(L.IsInt(2))
+	}
+	L.Push(t)
+	return 1
+}
+
+// task.safeAuto(true) 开启工控端口/厂商的自动识别, 默认关闭
+func (t *Task) safeAutoL(L *lua.LState) int {
+	t.Option.SafeAuto = L.IsTrue(1)
+	L.Push(t)
+	return 1
+}
+
+// task.skip(true, false, true) 依次设置是否跳过 本机地址/网关/网络地址和广播地址, 默认都跳过, 省略的参数不修改
+func (t *Task) skipL(L *lua.LState) int {
+	flags := []*bool{&t.Option.SkipSelf, &t.Option.SkipGateway, &t.Option.SkipBoundary}
+	for i, v := range flags {
+		if L.GetTop() > i {
+			*v = L.IsTrue(i + 1)
+		}
+	}
+	L.Push(t)
+	return 1
+}
+
+// task.discover("ssdp,mdns,wsd") 组播发现局域网设备, 参数为空等同于 all
+func (t *Task) discoverL(L *lua.LState) int {
+	protocols := "all"
+	if L.GetTop() > 0 {
+		protocols = L.CheckString(1)
+	}
+	if err := t.Option.set_discover(protocols); err != nil {
+		L.RaiseError("set_discover fail %v", err)
+		return 0
+	}
+	L.Push(t)
+	return 1
+}
+
 func (t *Task) Index(L *lua.LState, key string) lua.LValue {
 	switch key {
 	case "exclude":
@@ -161,8 +355,82 @@ func (t *Task) Index(L *lua.LState, key string) lua.LValue {
 		return lua.NewFunction(t.fingerDBL)
 	case "excludeTimeRange":
 		return lua.NewFunction(t.excludeTimeRangeL)
+	case "state":
+		return lua.NewFunction(t.stateL)
+	case "trace":
+		return lua.NewFunction(t.traceL)
+	case "names":
+		return lua.NewFunction(t.namesL)
+	case "discover":
+		return lua.NewFunction(t.discoverL)
+	case "snmp":
+		return lua.NewFunction(t.snmpL)
+	case "anomaly":
+		return lua.NewFunction(t.anomalyL)
+	case "safe":
+		return lua.NewFunction(t.safeL)
+	case "safeAuto":
+		return lua.NewFunction(t.safeAutoL)
+	case "skip":
+		return lua.NewFunction(t.skipL)
+	case "export":
+		return lua.NewFunction(t.exportL)
 	case "run":
 		return lua.NewFunction(t.runL)
+	case "status":
+		return lua.NewFunction(t.statusL)
+	case "progress":
+		return lua.NewFunction(t.progressL)
+	case "pause":
+		return lua.NewFunction(t.pauseL)
+	case "resume":
+		return lua.NewFunction(t.resumeL)
+	case "stop":
+		return lua.NewFunction(t.stopL)
+	case "wait":
+		return lua.NewFunction(t.waitL)
+	case "results":
+		return lua.NewFunction(t.resultsL)
+	case "profile":
+		return lua.NewFunction(t.profileL)
+	case "on_service":
+		return lua.NewFunction(t.onServiceL)
+	case "on_host":
+		return lua.NewFunction(t.onHostL)
+	case "on_progress":
+		return lua.NewFunction(t.onProgressL)
+	case "on_finish":
+		return lua.NewFunction(t.onFinishL)
+	case "on_error":
+		return lua.NewFunction(t.onErrorL)
+
+	// 只读字段, 与上面设置参数的方法同名的字段不提供
+	case "id":
+		return lua.LString(t.Id)
+	case "name":
+		return lua.LString(t.Name)
+	case "target":
+		return lua.LString(t.Option.Target)
+	case "start_time":
+		return lua.LNumber(t.Start_time.Unix())
+	case "end_time":
+		if t.End_time.IsZero() {
+			return lua.LNumber(0)
+		}
+		return lua.LNumber(t.End_time.Unix())
+	case "msg":
+		return lua.LString(t.Msg)
+	case "asset_num":
+		return lua.LNumber(atomic.LoadUint64(&t.Count_asset))
+	case "task_process":
+		_, overall, _ := t.progress.Summary()
+		if t.Status == Task_Status_Success {
+			overall = 100
+		}
+		return lua.LNumber(overall)
+	case "eta":
+		_, _, eta := t.progress.Summary()
+		return lua.LNumber(eta)
 	default:
 		return lua.LNil
 	}
@@ -0,0 +1,162 @@
+package radar
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vela-ssoc/vela-kit/iputil"
+	"github.com/vela-ssoc/vela-radar/port"
+	"github.com/vela-ssoc/vela-radar/port/syn"
+	"github.com/vela-ssoc/vela-radar/util"
+)
+
+const (
+	maxTraceNets   = 256 // 单个任务最多探测的 /24 网段数
+	maxTraceWorker = 16
+	traceWait      = 3 * time.Second
+)
+
+// pathTable 每个 /24 网段的路径探测结果
+type pathTable struct {
+	mu   sync.RWMutex
+	nets map[string]*syn.TraceResult
+}
+
+func newPathTable() *pathTable {
+	return &pathTable{nets: make(map[string]*syn.TraceResult)}
+}
+
+func netKey(ip net.IP) string {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d.%d.%d.0/24", ip4[0], ip4[1], ip4[2])
+}
+
+func (pt *pathTable) Get(ip net.IP) *syn.TraceResult {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	return pt.nets[netKey(ip)]
+}
+
+func (pt *pathTable) set(key string, r *syn.TraceResult) {
+	pt.mu.Lock()
+	pt.nets[key] = r
+	pt.mu.Unlock()
+}
+
+func (pt *pathTable) Bytes() []byte {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	return util.ToJsonBytes(pt.nets)
+}
+
+// representatives 每个 /24 网段取第一个目标地址作为代表
+func representatives(items []string, limit int) (map[string]net.IP, error) {
+	reps := make(map[string]net.IP)
+	for _, item := range items {
+		it, _, err := iputil.NewIter(item)
+		if err != nil {
+			return nil, err
+		}
+
+		total := it.TotalNum()
+		for i := uint64(0); i < total; {
+			ip := it.GetIpByIndex(i).To4()
+			if ip == nil {
+				break
+			}
+			key := netKey(ip)
+			if _, ok := reps[key]; !ok {
+				if len(reps) >= limit {
+					return reps, nil
+				}
+				dup := make(net.IP, 4)
+				copy(dup, ip)
+				reps[key] = dup
+			}
+			// 跳到下一个 /24
+			i += uint64(256 - int(ip[3]))
+		}
+	}
+	return reps, nil
+}
+
+// tracer 支持 traceroute 的扫描器
+type tracer interface {
+	Trace(dstIp net.IP, mode string, dport uint16, maxHops int, timeout time.Duration) (*syn.TraceResult, error)
+}
+
+// discoverPaths 路径探测阶段, 对每个 /24 网段的代表地址做 traceroute
+// syn 扫描器已经接收 traceroute 的响应, 直接复用; tcp 模式没有抓包句柄才单独打开一个
+func (t *Task) discoverPaths(items []string, dport uint16, scanner Scanner) {
+	t.paths = newPathTable()
+	reps, err := representatives(items, maxTraceNets)
+	if err != nil {
+		xEnv.Errorf("task %s trace target parse fail %v", t.Id, err)
+		return
+	}
+	if len(reps) >= maxTraceNets {
+		xEnv.Infof("task %s trace only the first %d /24 networks", t.Id, maxTraceNets)
+	}
+
+	var first net.IP
+	for _, ip := range reps {
+		first = ip
+		break
+	}
+	if first == nil {
+		return
+	}
+
+	ss, ok := scanner.(tracer)
+	if !ok || t.Option.Mode != "syn" {
+		s, err := syn.NewSynScanner(first, func(port.OpenIpPort) {}, port.Option{
+			Rate:    t.Option.Rate,
+			Timeout: t.Option.Timeout,
+			Trace:   true,
+		})
+		if err != nil {
+			xEnv.Errorf("task %s trace scanner init fail %v", t.Id, err)
+			return
+		}
+		defer s.Close()
+		ss = s
+	}
+
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, maxTraceWorker)
+	for key, ip := range reps {
+		select {
+		case <-t.ctx.Done():
+			goto done
+		default:
+		}
+
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(key string, ip net.IP) {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+			r, err := ss.Trace(ip, t.Option.Trace, dport, t.Option.TraceHops, traceWait)
+			if err != nil {
+				if t.rad.cfg.Debug || t.Debug {
+					xEnv.Infof("trace %s fail %v", ip, err)
+				}
+				return
+			}
+			t.paths.set(key, r)
+		}(key, ip)
+	}
+
+done:
+	wg.Wait()
+	if t.rad.cfg.Debug || t.Debug {
+		xEnv.Infof("task %s path discovery end, %d networks", t.Id, len(reps))
+	}
+}
@@ -0,0 +1,238 @@
+package util
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IPRange 连续的地址区间 [Lo, Hi], ipv4 与 ipv6 不会出现在同一个区间
+type IPRange struct {
+	Lo netip.Addr
+	Hi netip.Addr
+}
+
+// ParseIPRange 支持 ip, CIDR, a-b 以及 192.168.1.10-20
+func ParseIPRange(s string) (IPRange, error) {
+	s = strings.TrimSpace(s)
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return PrefixRange(p), nil
+	}
+	if a, err := netip.ParseAddr(s); err == nil {
+		return IPRange{Lo: a.Unmap(), Hi: a.Unmap()}, nil
+	}
+
+	i := strings.LastIndexByte(s, '-')
+	if i < 0 {
+		return IPRange{}, fmt.Errorf("invalid ip range %s", s)
+	}
+	lo, err := netip.ParseAddr(strings.TrimSpace(s[:i]))
+	if err != nil {
+		return IPRange{}, fmt.Errorf("invalid ip range %s", s)
+	}
+	lo = lo.Unmap()
+	end := strings.TrimSpace(s[i+1:])
+	hi, err := netip.ParseAddr(end)
+	if err != nil && lo.Is4() {
+		n, e := strconv.ParseUint(end, 10, 8)
+		if e != nil {
+			return IPRange{}, fmt.Errorf("invalid ip range %s", s)
+		}
+		b := lo.As4()
+		b[3] = byte(n)
+		hi, err = netip.AddrFrom4(b), nil
+	}
+	hi = hi.Unmap()
+	if err != nil || hi.BitLen() != lo.BitLen() || hi.Less(lo) {
+		return IPRange{}, fmt.Errorf("invalid ip range %s", s)
+	}
+	return IPRange{Lo: lo, Hi: hi}, nil
+}
+
+// PrefixRange CIDR 对应的区间
+func PrefixRange(p netip.Prefix) IPRange {
+	if p.Addr().Is4In6() && p.Bits() >= 96 {
+		p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	p = p.Masked()
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - uint(i%8))
+	}
+	hi, _ := netip.AddrFromSlice(b)
+	return IPRange{Lo: p.Addr(), Hi: hi}
+}
+
+func (r IPRange) Contains(a netip.Addr) bool {
+	return r.Lo.Compare(a) <= 0 && a.Compare(r.Hi) <= 0
+}
+
+// Covers 区间 o 是否完全在 r 中
+func (r IPRange) Covers(o IPRange) bool {
+	return r.Lo.BitLen() == o.Lo.BitLen() && r.Lo.Compare(o.Lo) <= 0 && o.Hi.Compare(r.Hi) <= 0
+}
+
+func (r IPRange) String() string {
+	if r.Lo == r.Hi {
+		return r.Lo.String()
+	}
+	if cidrs := r.CIDRs(); len(cidrs) == 1 {
+		return cidrs[0]
+	}
+	return r.Lo.String() + "-" + r.Hi.String()
+}
+
+// CIDRs 把区间拆分为最少的 CIDR
+func (r IPRange) CIDRs() []string {
+	bits := r.Lo.BitLen()
+	lo := new(big.Int).SetBytes(r.Lo.AsSlice())
+	hi := new(big.Int).SetBytes(r.Hi.AsSlice())
+	one := big.NewInt(1)
+
+	var out []string
+	for lo.Cmp(hi) <= 0 {
+		size := 0
+		for size < bits {
+			next := size + 1
+			mask := new(big.Int).Sub(new(big.Int).Lsh(one, uint(next)), one)
+			if new(big.Int).And(lo, mask).Sign() != 0 {
+				break
+			}
+			if new(big.Int).Add(lo, mask).Cmp(hi) > 0 {
+				break
+			}
+			size = next
+		}
+		buf := make([]byte, bits/8)
+		lo.FillBytes(buf)
+		a, _ := netip.AddrFromSlice(buf)
+		out = append(out, netip.PrefixFrom(a, bits-size).String())
+		lo.Add(lo, new(big.Int).Lsh(one, uint(size)))
+	}
+	return out
+}
+
+// IPSet 有序且合并过的地址区间, 按区间二分查找
+// 排除整个 /8 或者 ipv6 网段也只占用一个区间, 不需要展开成单个ip
+type IPSet struct {
+	ranges []IPRange
+}
+
+// NewIPSet 解析逗号分隔的 ip/CIDR/范围, 无法解析的项忽略
+func NewIPSet(s string) *IPSet {
+	set := &IPSet{}
+	for _, item := range strings.Split(s, ",") {
+		if r, err := ParseIPRange(item); err == nil {
+			set.ranges = append(set.ranges, r)
+		}
+	}
+	set.normalize()
+	return set
+}
+
+// ParseIPSet 与 NewIPSet 相同, 遇到无法解析的项返回错误
+func ParseIPSet(s string) (*IPSet, error) {
+	set := &IPSet{}
+	for _, item := range strings.Split(s, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		r, err := ParseIPRange(item)
+		if err != nil {
+			return nil, err
+		}
+		set.ranges = append(set.ranges, r)
+	}
+	set.normalize()
+	return set, nil
+}
+
+// Add 添加区间, 构造完成之后不要与 Contains 并发调用
+func (s *IPSet) Add(r IPRange) {
+	s.ranges = append(s.ranges, r)
+	s.normalize()
+}
+
+// normalize 排序并合并重叠以及相邻的区间
+func (s *IPSet) normalize() {
+	if len(s.ranges) < 2 {
+		return
+	}
+	sort.Slice(s.ranges, func(i, j int) bool { return s.ranges[i].Lo.Less(s.ranges[j].Lo) })
+
+	out := s.ranges[:1]
+	for _, r := range s.ranges[1:] {
+		last := &out[len(out)-1]
+		next := last.Hi.Next()
+		if r.Lo.BitLen() == last.Lo.BitLen() && (!next.IsValid() || r.Lo.Compare(next) <= 0) {
+			if last.Hi.Less(r.Hi) {
+				last.Hi = r.Hi
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	s.ranges = out
+}
+
+func (s *IPSet) ContainsAddr(a netip.Addr) bool {
+	if s == nil || len(s.ranges) == 0 {
+		return false
+	}
+	a = a.Unmap()
+	i := sort.Search(len(s.ranges), func(i int) bool { return a.Compare(s.ranges[i].Hi) <= 0 })
+	return i < len(s.ranges) && s.ranges[i].Contains(a)
+}
+
+func (s *IPSet) Contains(ip net.IP) bool {
+	a, ok := netip.AddrFromSlice(ip)
+	return ok && s.ContainsAddr(a)
+}
+
+// Intersect 区间 r 与集合的交集
+func (s *IPSet) Intersect(r IPRange) []IPRange {
+	if s == nil {
+		return nil
+	}
+	var out []IPRange
+	for _, v := range s.ranges {
+		if v.Lo.BitLen() != r.Lo.BitLen() || v.Hi.Less(r.Lo) || r.Hi.Less(v.Lo) {
+			continue
+		}
+		c := r
+		if c.Lo.Less(v.Lo) {
+			c.Lo = v.Lo
+		}
+		if v.Hi.Less(c.Hi) {
+			c.Hi = v.Hi
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func (s *IPSet) Ranges() []IPRange {
+	if s == nil {
+		return nil
+	}
+	return s.ranges
+}
+
+func (s *IPSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.ranges)
+}
+
+func (s *IPSet) String() string {
+	items := make([]string, 0, s.Len())
+	for _, r := range s.Ranges() {
+		items = append(items, r.String())
+	}
+	return strings.Join(items, ",")
+}
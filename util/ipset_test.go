@@ -0,0 +1,65 @@
+package util
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestIPSet_Contains(t *testing.T) {
+	set, err := ParseIPSet("10.0.0.0/8, 192.168.1.10-20,172.16.0.1-172.16.0.3,172.16.0.4,2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"10.0.0.0":        true,
+		"10.255.255.255":  true,
+		"11.0.0.0":        false,
+		"192.168.1.9":     false,
+		"192.168.1.15":    true,
+		"192.168.1.20":    true,
+		"192.168.1.21":    false,
+		"172.16.0.4":      true,
+		"172.16.0.5":      false,
+		"::ffff:10.1.2.3": true,
+		"2001:db8:ffff::": true,
+		"2001:db9::":      false,
+	}
+	for ip, want := range cases {
+		if got := set.Contains(net.ParseIP(ip)); got != want {
+			t.Errorf("contains %s got %v", ip, got)
+		}
+	}
+
+	// 相邻的区间合并
+	if got := set.String(); got != "10.0.0.0/8,172.16.0.1-172.16.0.4,192.168.1.10-192.168.1.20,2001:db8::/32" {
+		t.Errorf("string got %s", got)
+	}
+
+	if _, err := ParseIPSet("10.0.0.1,bad"); err == nil {
+		t.Error("invalid item should fail")
+	}
+	if NewIPSet("10.0.0.1,bad").Len() != 1 {
+		t.Error("invalid item should be skipped")
+	}
+	if (*IPSet)(nil).Contains(net.ParseIP("10.0.0.1")) {
+		t.Error("nil set should be empty")
+	}
+}
+
+func TestIPRange_CIDRs(t *testing.T) {
+	r, err := ParseIPRange("10.0.0.3-10.0.0.17")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(r.CIDRs(), ","); got != "10.0.0.3/32,10.0.0.4/30,10.0.0.8/29,10.0.0.16/31" {
+		t.Errorf("cidrs got %s", got)
+	}
+
+	wide, _ := ParseIPRange("10.0.0.0/8")
+	parts := NewIPSet("10.1.0.0/16").Intersect(wide)
+	if len(parts) != 1 || parts[0].String() != "10.1.0.0/16" {
+		t.Errorf("intersect got %v", parts)
+	}
+}
@@ -2,7 +2,9 @@ package util
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"strings"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -40,3 +42,41 @@ func UploadToMinio(cfg *MinioCfg, objectName string, content io.Reader, fileSize
 	//log.Printf("Successfully uploaded %s to MinIO. Size: %d bytes\n", objectName, n.Size)
 	return cfg.Endpoint_preview + "/" + cfg.BucketName + "/" + objectName, nil
 }
+
+// MinioObjectName 从 UploadToMinio 返回的地址中取出对象名, 不是该配置上传的地址返回空
+func MinioObjectName(cfg *MinioCfg, url string) string {
+	if cfg == nil || cfg.Endpoint == "" {
+		return ""
+	}
+	prefix := cfg.Endpoint_preview + "/" + cfg.BucketName + "/"
+	if !strings.HasPrefix(url, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(url, prefix)
+}
+
+// DownloadFromMinio 读取对象内容, 超过 limit 字节返回错误
+func DownloadFromMinio(ctx context.Context, cfg *MinioCfg, objectName string, limit int64) ([]byte, error) {
+	minioClient, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := minioClient.GetObject(ctx, cfg.BucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	buf, err := io.ReadAll(io.LimitReader(obj, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) > limit {
+		return nil, fmt.Errorf("object %s larger than %d bytes", objectName, limit)
+	}
+	return buf, nil
+}
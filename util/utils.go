@@ -2,9 +2,6 @@ package util
 
 import (
 	"encoding/json"
-	"strings"
-
-	"github.com/vela-ssoc/vela-kit/iputil"
 )
 
 func ToJsonStr(i interface{}) string {
@@ -24,22 +21,15 @@ func ToJsonBytes(i interface{}) []byte {
 	return jsonBytes
 }
 
-func IpstrWithCommaToMap(ipstr string) map[string]bool {
-	result := make(map[string]bool)
-
-	items := strings.Split(ipstr, ",")
-	for _, ip := range items {
-		if iputil.IsIPv4(ip) {
-			result[ip] = true
+// Printable keeps printable ascii and line breaks, everything else becomes '.'
+func Printable(raw []byte) string {
+	buf := make([]byte, len(raw))
+	for i, c := range raw {
+		if (c >= 0x20 && c < 0x7f) || c == '\r' || c == '\n' || c == '\t' {
+			buf[i] = c
 		} else {
-			ip_set, err := iputil.GenIpSet(ip)
-			if err != nil {
-				continue
-			}
-			for _, _ip := range ip_set {
-				result[_ip.String()] = true
-			}
+			buf[i] = '.'
 		}
 	}
-	return result
+	return string(buf)
 }
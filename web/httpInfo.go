@@ -24,7 +24,24 @@ const (
 
 var httpClient *http.Client
 
-func ProbeHttpInfo(url2 string, dialTimeout time.Duration) (httpInfo *port.HttpInfo, isDailErr bool) {
+// ProbeHttpInfo 获取 web 服务信息, 记录耗时以及结果
+func ProbeHttpInfo(url2 string, dialTimeout time.Duration) (*port.HttpInfo, bool) {
+	start := time.Now()
+	httpInfo, isDailErr := probeHttpInfo(url2, dialTimeout)
+	metricProbeSeconds.With().ObserveSince(start)
+
+	switch {
+	case httpInfo != nil:
+		metricProbes.With("ok").Inc()
+	case isDailErr:
+		metricProbes.With("dial_error").Inc()
+	default:
+		metricProbes.With("error").Inc()
+	}
+	return httpInfo, isDailErr
+}
+
+func probeHttpInfo(url2 string, dialTimeout time.Duration) (httpInfo *port.HttpInfo, isDailErr bool) {
 
 	if httpClient == nil {
 		httpClient = newHttpClient(dialTimeout)
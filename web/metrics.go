@@ -0,0 +1,14 @@
+package web
+
+import "github.com/vela-ssoc/vela-radar/metrics"
+
+var (
+	metricProbeSeconds = metrics.NewHistogram("radar_http_probe_seconds",
+		"Duration of probing a web service, redirects and favicon included.", nil)
+	metricProbes = metrics.NewCounter("radar_http_probes_total",
+		"HTTP probes by result (ok, dial_error, error).", "result")
+	metricScreenshotSeconds = metrics.NewHistogram("radar_screenshot_seconds",
+		"Duration of taking and uploading a screenshot.", nil, "result")
+	metricScreenshotWaiting = metrics.NewGauge("radar_screenshot_waiting",
+		"Screenshot requests waiting for a free browser tab.")
+)
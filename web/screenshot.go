@@ -61,11 +61,13 @@ type ScreenshotTask struct {
 type ScreenshotServer struct {
 	Cfg               *ScreenshotCfg
 	ctx               context.Context
-	navigateWaitgroup sync.WaitGroup
+	navigateWaitgroup *sync.WaitGroup // 每次启动单独计数, 关闭时只等待这一批截图协程
 	state             uint32
 	Avaliable         bool
 	chrome            []chromedp.ExecAllocatorOption
 	queue             chan *ScreenshotTask
+	mu                sync.RWMutex // 保护 queue 以及 refs
+	refs              int          // 正在使用截图的任务/探测数量
 	Logger            vela.Log
 }
 
@@ -108,7 +110,42 @@ func NewScreenServer(ctx context.Context, cfg *ScreenshotCfg, log vela.Log) (*Sc
 	return screen, nil
 }
 
+// Acquire 任务或者探测开始使用截图, 第一个使用者启动截图协程
+func (st *ScreenshotServer) Acquire() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.refs++
+	if st.queue == nil {
+		st.start()
+	}
+}
+
+// Release 最后一个使用者结束时关闭截图协程
+func (st *ScreenshotServer) Release() {
+	st.mu.Lock()
+	if st.refs > 0 {
+		st.refs--
+	}
+	if st.refs > 0 {
+		st.mu.Unlock()
+		return
+	}
+	wg := st.stop()
+	st.mu.Unlock()
+	st.wait(wg)
+}
+
+// Start 启动截图协程, 已经启动时不做处理
 func (st *ScreenshotServer) Start() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.queue == nil {
+		st.start()
+	}
+	return nil
+}
+
+func (st *ScreenshotServer) start() {
 	level := st.Logger.LoggerLevel()
 	if st.Cfg.Debug {
 		_ = level.Set("debug")
@@ -117,15 +154,15 @@ func (st *ScreenshotServer) Start() error {
 	}
 	st.Logger.Infof("[+]ScreenshotServer starting...")
 	st.queue = make(chan *ScreenshotTask)
+	st.navigateWaitgroup = new(sync.WaitGroup)
 	for i := 0; i < st.Cfg.Thread; i++ {
-		go st.navigate(i, st.chrome)
+		st.navigateWaitgroup.Add(1)
+		go st.navigate(i, st.chrome, st.queue, st.navigateWaitgroup)
 	}
-	return nil
 }
 
-func (st *ScreenshotServer) navigate(workerNum int, option []chromedp.ExecAllocatorOption) {
-	st.navigateWaitgroup.Add(1)
-	defer st.navigateWaitgroup.Done()
+func (st *ScreenshotServer) navigate(workerNum int, option []chromedp.ExecAllocatorOption, queue chan *ScreenshotTask, wg *sync.WaitGroup) {
+	defer wg.Done()
 	sctx, sCancel := context.WithCancel(context.Background())
 	pCtx, pCancel := chromedp.NewExecAllocator(sctx, option...)
 	ctx, cancel := chromedp.NewContext(pCtx) // Chrome tab ctx
@@ -229,36 +266,62 @@ func (st *ScreenshotServer) navigate(workerNum int, option []chromedp.ExecAlloca
 		return nil
 	}
 
-	for target := range st.queue {
+	for target := range queue {
 		st.Logger.Debugf("[+]ScreenshotServer navigate [%d] start screen (URL:%s)", workerNum, target.Url)
-		_ = screen(target)
+		start := time.Now()
+		if err := screen(target); err != nil {
+			metricScreenshotSeconds.With("fail").ObserveSince(start)
+		} else {
+			metricScreenshotSeconds.With("ok").ObserveSince(start)
+		}
 		st.Logger.Debugf("[+]ScreenshotServer navigate [%d] end screen  (URL:%s)", workerNum, target.Url)
 	}
 	st.Logger.Infof("[+]ScreenshotServer navigate [%d] closed", workerNum)
 }
 
-func (st *ScreenshotServer) Push(target *ScreenshotTask) {
-	if st.Avaliable {
-		st.queue <- target
+// Push 提交截图任务, 截图协程没有启动或者不可用时返回 false, 调用方不需要等待结果
+// 持有读锁发送, Close 会等待已经提交的任务被截图协程取走
+func (st *ScreenshotServer) Push(target *ScreenshotTask) bool {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	if !st.Avaliable || st.queue == nil {
+		return false
 	}
+	metricScreenshotWaiting.With().Inc()
+	st.queue <- target
+	metricScreenshotWaiting.With().Dec()
+	return true
 }
 
+// Close 直接关闭截图协程, 不考虑引用计数
 func (st *ScreenshotServer) Close() {
-	defer func() {
-		if e := recover(); e != nil {
-			st.Logger.Errorf("ScreenshotServer Closer ERR:%v", e)
-		}
-	}()
+	st.mu.Lock()
+	wg := st.stop()
+	st.refs = 0
+	st.mu.Unlock()
+	st.wait(wg)
+}
+
+// stop 关闭队列, 需要持有写锁, 返回需要等待的截图协程
+func (st *ScreenshotServer) stop() *sync.WaitGroup {
 	if st.queue == nil {
 		st.Logger.Infof("ScreenshotServer queue为nil")
-		return
+		return nil
 	}
 	if len(st.queue) == 0 {
 		st.Logger.Infof("ScreenshotServer queue队列为空")
 	}
 	close(st.queue)
+	st.queue = nil
 	st.Logger.Infof("ScreenshotServer queue closed")
-	st.navigateWaitgroup.Wait()
+	return st.navigateWaitgroup
+}
+
+func (st *ScreenshotServer) wait(wg *sync.WaitGroup) {
+	if wg == nil {
+		return
+	}
+	wg.Wait()
 	st.Logger.Infof("ScreenshotServer ended")
 }
 